@@ -0,0 +1,14 @@
+// Package api embeds the OpenAPI description of the HTTP API and its
+// documentation page.
+//
+// openapi.json is maintained by hand. routes.TestRouterMatchesSpec fails when
+// a route is added or removed without updating it.
+package api
+
+import _ "embed"
+
+//go:embed openapi.json
+var Spec []byte
+
+//go:embed docs.html
+var DocsPage []byte
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+// CacheStats are the server's menu cache counters since it started.
+type CacheStats struct {
+	Hits          uint64 `json:"hits"`
+	StaleHits     uint64 `json:"stale_hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	LoadErrors    uint64 `json:"load_errors"`
+	Invalidations uint64 `json:"invalidations"`
+	Entries       int    `json:"entries"`
+}
+
+func (c *Client) CacheStats(ctx context.Context) (*CacheStats, error) {
+	var stats CacheStats
+	if err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/speisekarte/cache/stats", auth: true}, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// AuditFilter selects audit log entries. Empty fields match everything.
+type AuditFilter struct {
+	ActorID    string
+	Action     string
+	EntityType string
+	EntityID   string
+	Since      time.Time
+	Until      time.Time
+	PageOptions
+}
+
+type AuditList struct {
+	Entries []models.AuditEntry `json:"entries"`
+	Total   int                 `json:"total"`
+	Limit   int                 `json:"limit"`
+	Offset  int                 `json:"offset"`
+}
+
+// ListAuditEntries returns audit log entries, newest first.
+func (c *Client) ListAuditEntries(ctx context.Context, filter *AuditFilter) (*AuditList, error) {
+	q := url.Values{}
+	if filter != nil {
+		q = filter.PageOptions.values()
+		for key, value := range map[string]string{
+			"actor_id":    filter.ActorID,
+			"action":      filter.Action,
+			"entity_type": filter.EntityType,
+			"entity_id":   filter.EntityID,
+		} {
+			if value != "" {
+				q.Set(key, value)
+			}
+		}
+		if !filter.Since.IsZero() {
+			q.Set("since", filter.Since.Format(time.RFC3339Nano))
+		}
+		if !filter.Until.IsZero() {
+			q.Set("until", filter.Until.Format(time.RFC3339Nano))
+		}
+	}
+
+	var list AuditList
+	if err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/admin/audit", query: q, auth: true}, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// WebhookInput describes a webhook subscription. Active defaults to true.
+type WebhookInput struct {
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	Description *string  `json:"description,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+func webhookPath(id string) string {
+	return "/admin/webhooks/" + url.PathEscape(id)
+}
+
+func (c *Client) ListWebhooks(ctx context.Context) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/admin/webhooks", auth: true}, &subscriptions)
+	return subscriptions, err
+}
+
+// CreateWebhook subscribes to menu events. The returned subscription's
+// Secret is only sent this once; keep it to verify delivery signatures.
+func (c *Client) CreateWebhook(ctx context.Context, in WebhookInput) (*models.WebhookSubscription, error) {
+	var s models.WebhookSubscription
+	err := c.doJSON(ctx, &request{method: http.MethodPost, path: "/admin/webhooks", body: jsonBody(in), auth: true}, &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (c *Client) GetWebhook(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	var s models.WebhookSubscription
+	if err := c.doJSON(ctx, &request{method: http.MethodGet, path: webhookPath(id), auth: true}, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (c *Client) UpdateWebhook(ctx context.Context, id string, in WebhookInput) (*models.WebhookSubscription, error) {
+	var s models.WebhookSubscription
+	err := c.doJSON(ctx, &request{method: http.MethodPut, path: webhookPath(id), body: jsonBody(in), auth: true}, &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	return c.doJSON(ctx, &request{method: http.MethodDelete, path: webhookPath(id), auth: true}, nil)
+}
+
+// DeliveryFilter selects webhook deliveries. Status is pending, succeeded or
+// dead; empty matches all.
+type DeliveryFilter struct {
+	Status string
+	PageOptions
+}
+
+// ListWebhookDeliveries returns a subscription's deliveries, newest first.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, id string, filter *DeliveryFilter) ([]models.WebhookDelivery, error) {
+	q := url.Values{}
+	if filter != nil {
+		q = filter.PageOptions.values()
+		if filter.Status != "" {
+			q.Set("status", filter.Status)
+		}
+	}
+	var deliveries []models.WebhookDelivery
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: webhookPath(id) + "/deliveries", query: q, auth: true}, &deliveries)
+	return deliveries, err
+}
+
+func (c *Client) GetWebhookDelivery(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: deliveryPath(id), auth: true}, &d)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// RedeliverWebhook queues a delivery to be sent again and returns the new
+// delivery.
+func (c *Client) RedeliverWebhook(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	err := c.doJSON(ctx, &request{method: http.MethodPost, path: deliveryPath(id) + "/redeliver", auth: true}, &d)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func deliveryPath(id int64) string {
+	return "/admin/webhooks/deliveries/" + strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,327 @@
+// Package client is a typed Go client for the Gasthaus API.
+//
+// A Client logs in with the credentials it was given, renews its token
+// before it expires and logs in again when the server rejects it:
+//
+//	c, err := client.New("https://api.example.com", client.WithCredentials(email, password))
+//	if err != nil { ... }
+//	items, err := c.ListItems(ctx, &client.ListItemsOptions{Category: "Hauptgerichte"})
+//
+// Errors returned by the API are *Error values. Use errors.Is with
+// ErrNotFound, ErrConflict, ErrUnauthorized or ErrPreconditionFailed to
+// check for the common cases.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultRefreshMargin is how long before its expiry a token is renewed.
+const DefaultRefreshMargin = 5 * time.Minute
+
+type Client struct {
+	baseURL       *url.URL
+	httpClient    *http.Client
+	refreshMargin time.Duration
+
+	// mu guards the token and serialises renewals, so concurrent requests
+	// with an expiring token trigger a single refresh.
+	mu       sync.Mutex
+	token    string
+	expiry   time.Time
+	email    string
+	password string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. The default is
+// http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithToken starts the client with an existing token.
+func WithToken(token string) Option {
+	return func(c *Client) { c.setToken(token) }
+}
+
+// WithCredentials lets the client log in on its own, both for the first
+// authenticated request and whenever its token can no longer be renewed.
+func WithCredentials(email, password string) Option {
+	return func(c *Client) { c.email, c.password = email, password }
+}
+
+// WithRefreshMargin sets how long before its expiry a token is renewed.
+func WithRefreshMargin(d time.Duration) Option {
+	return func(c *Client) { c.refreshMargin = d }
+}
+
+// New returns a client for the API at baseURL, e.g. "https://api.example.com".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: must be absolute", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:       u,
+		httpClient:    http.DefaultClient,
+		refreshMargin: DefaultRefreshMargin,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Token returns the current token, or "" if the client has none yet.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// setToken stores token and reads its expiry. The signature is not checked;
+// that is the server's job. Callers must hold c.mu, except during New.
+func (c *Client) setToken(token string) {
+	c.token = token
+	c.expiry = time.Time{}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err == nil {
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			c.expiry = exp.Time
+		}
+	}
+}
+
+type tokenResponse struct {
+	Token string `json:"token"`
+}
+
+// Login exchanges email and password for a token, which the client uses
+// from then on.
+func (c *Client) Login(ctx context.Context, email, password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.login(ctx, email, password)
+}
+
+func (c *Client) login(ctx context.Context, email, password string) error {
+	var resp tokenResponse
+	err := c.doJSON(ctx, &request{
+		method: http.MethodPost,
+		path:   "/auth/login",
+		body:   jsonBody(map[string]string{"email": email, "password": password}),
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	c.setToken(resp.Token)
+	return nil
+}
+
+// RefreshToken replaces the current token with a fresh one. The client does
+// this on its own before the token expires.
+func (c *Client) RefreshToken(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refresh(ctx)
+}
+
+func (c *Client) refresh(ctx context.Context) error {
+	var resp tokenResponse
+	err := c.doJSON(ctx, &request{
+		method: http.MethodGet,
+		path:   "/auth/refresh-token",
+		query:  url.Values{"token": {c.token}},
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	c.setToken(resp.Token)
+	return nil
+}
+
+// validToken returns a token for an authenticated request, renewing or
+// replacing the current one first if it is about to expire. A request
+// without a usable token is still sent, so the server's error reaches the
+// caller.
+func (c *Client) validToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	fresh := c.token != "" && (c.expiry.IsZero() || c.expiry.Sub(now) > c.refreshMargin)
+	if fresh {
+		return c.token, nil
+	}
+
+	if c.token != "" && now.Before(c.expiry) {
+		err := c.refresh(ctx)
+		if err == nil || !c.hasCredentials() {
+			return c.token, err
+		}
+	}
+	if c.hasCredentials() {
+		if err := c.login(ctx, c.email, c.password); err != nil {
+			return "", err
+		}
+	}
+	return c.token, nil
+}
+
+// relogin replaces a token the server rejected. It reports whether the
+// request is worth retrying.
+func (c *Client) relogin(ctx context.Context, rejected string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.hasCredentials() {
+		return false, nil
+	}
+	if c.token != rejected {
+		// Another request already logged in again.
+		return true, nil
+	}
+	if err := c.login(ctx, c.email, c.password); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *Client) hasCredentials() bool {
+	return c.email != "" && c.password != ""
+}
+
+// request describes an API call. The body is buffered so the request can be
+// sent again after logging in.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	header      http.Header
+	body        []byte
+	contentType string
+	auth        bool
+}
+
+// jsonBody marshals v for a request. Values passed by this package always
+// marshal, so the error is not returned.
+func jsonBody(v any) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+func (c *Client) newRequest(ctx context.Context, rq *request, token string) (*http.Request, error) {
+	u := *c.baseURL
+	u.Path += rq.path
+	u.RawQuery = rq.query.Encode()
+
+	var body io.Reader
+	if rq.body != nil {
+		body = bytes.NewReader(rq.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, rq.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range rq.header {
+		req.Header[k] = v
+	}
+	if rq.body != nil {
+		contentType := rq.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// do sends rq and returns the response if its status is below 400. Other
+// responses are returned as *Error. The caller closes the response body.
+func (c *Client) do(ctx context.Context, rq *request) (*http.Response, error) {
+	var token string
+	if rq.auth {
+		var err error
+		if token, err = c.validToken(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.send(ctx, rq, token)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && rq.auth {
+		retry, err := c.relogin(ctx, token)
+		if err != nil || !retry {
+			return nil, errorFromResponse(resp)
+		}
+		resp.Body.Close()
+		if resp, err = c.send(ctx, rq, c.Token()); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, errorFromResponse(resp)
+	}
+	return resp, nil
+}
+
+func (c *Client) send(ctx context.Context, rq *request, token string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, rq, token)
+	if err != nil {
+		return nil, err
+	}
+	return c.httpClient.Do(req)
+}
+
+// doJSON sends rq and decodes the response body into out, unless out is nil.
+func (c *Client) doJSON(ctx context.Context, rq *request, out any) error {
+	resp, err := c.do(ctx, rq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", rq.method, rq.path, err)
+	}
+	return nil
+}
+
+// Health checks that the server and its database are reachable.
+func (c *Client) Health(ctx context.Context) error {
+	return c.doJSON(ctx, &request{method: http.MethodGet, path: "/"}, nil)
+}
+
+// OpenAPISpec returns the server's OpenAPI document.
+func (c *Client) OpenAPISpec(ctx context.Context) (json.RawMessage, error) {
+	var spec json.RawMessage
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/openapi.json"}, &spec)
+	return spec, err
+}
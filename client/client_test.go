@@ -0,0 +1,371 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gomisroca/gasthaus-backend/client"
+	"github.com/gomisroca/gasthaus-backend/handlers"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/internal/requestid"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/gomisroca/gasthaus-backend/routes"
+)
+
+const testSecret = "test-secret"
+
+func mintToken(t *testing.T, userID string, ttl time.Duration) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": userID,
+		"exp": time.Now().Add(ttl).Unix(),
+		"iat": time.Now().Unix(),
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// testServer serves the real router. Routes that need a database are
+// replaced by stubs registered with handle, which take precedence.
+type testServer struct {
+	*httptest.Server
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	speisekarte := handlers.NewSpeisekarteHandler(nil, nil)
+	router := routes.NewRouter(nil, speisekarte, &handlers.WebhookHandler{}, testSecret)
+
+	ts := &testServer{mux: http.NewServeMux()}
+	ts.mux.Handle("/", router)
+	ts.Server = httptest.NewServer(requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts.mu.Lock()
+		ts.requests = append(ts.requests, r.Method+" "+r.URL.Path)
+		ts.mu.Unlock()
+		ts.mux.ServeHTTP(w, r)
+	})))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *testServer) handle(pattern string, h http.HandlerFunc) {
+	ts.mux.HandleFunc(pattern, h)
+}
+
+func (ts *testServer) count(request string) int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	n := 0
+	for _, r := range ts.requests {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
+
+func newClient(t *testing.T, ts *testServer, opts ...client.Option) *client.Client {
+	t.Helper()
+	c, err := client.New(ts.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRefreshesExpiringToken(t *testing.T) {
+	ts := newTestServer(t)
+	expiring := mintToken(t, "user-1", time.Minute)
+	c := newClient(t, ts, client.WithToken(expiring))
+
+	if _, err := c.CacheStats(context.Background()); err != nil {
+		t.Fatalf("CacheStats: %v", err)
+	}
+	if got := ts.count("GET /auth/refresh-token"); got != 1 {
+		t.Errorf("refresh requests = %d, want 1", got)
+	}
+	if c.Token() == expiring {
+		t.Error("token was not replaced")
+	}
+
+	// The fresh token lasts a day, so the next request needs no refresh.
+	if _, err := c.CacheStats(context.Background()); err != nil {
+		t.Fatalf("CacheStats: %v", err)
+	}
+	if got := ts.count("GET /auth/refresh-token"); got != 1 {
+		t.Errorf("refresh requests = %d, want 1", got)
+	}
+}
+
+func TestLogsInAgainWhenTokenIsRejected(t *testing.T) {
+	ts := newTestServer(t)
+	// Login needs the users table; the stub checks the credentials the
+	// client sends and mints a token the real middleware accepts.
+	ts.handle("POST /auth/login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding login body: %v", err)
+		}
+		if body["email"] != "chef@example.com" || body["password"] != "hunter2" {
+			problem.Error(w, r, http.StatusUnauthorized, "invalid_email_or_password", "Invalid email or password")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"token": mintToken(t, "user-1", 24*time.Hour)})
+	})
+
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("wrong-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t, ts, client.WithToken(forged), client.WithCredentials("chef@example.com", "hunter2"))
+
+	if _, err := c.CacheStats(context.Background()); err != nil {
+		t.Fatalf("CacheStats: %v", err)
+	}
+	if got := ts.count("GET /speisekarte/cache/stats"); got != 2 {
+		t.Errorf("stats requests = %d, want 2 (rejected, then retried)", got)
+	}
+	if got := ts.count("POST /auth/login"); got != 1 {
+		t.Errorf("login requests = %d, want 1", got)
+	}
+}
+
+func TestLogsInBeforeFirstRequest(t *testing.T) {
+	ts := newTestServer(t)
+	ts.handle("POST /auth/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"token": mintToken(t, "user-1", 24*time.Hour)})
+	})
+	c := newClient(t, ts, client.WithCredentials("chef@example.com", "hunter2"))
+
+	if _, err := c.CacheStats(context.Background()); err != nil {
+		t.Fatalf("CacheStats: %v", err)
+	}
+	if got := ts.count("GET /speisekarte/cache/stats"); got != 1 {
+		t.Errorf("stats requests = %d, want 1", got)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	ts := newTestServer(t)
+	ts.handle("GET /speisekarte/missing", func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, http.StatusNotFound, "item_not_found", "Item not found")
+	})
+	ts.handle("PUT /speisekarte/dup", func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, http.StatusConflict, "duplicate_item_name", "Item with this name already exists")
+	})
+	ts.handle("POST /speisekarte/", func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.Validation(
+			problem.Field("categories", "required", "categories must not be empty"),
+			problem.Field("name", "too_long", "name must be at most 100 characters"),
+		))
+	})
+
+	token := mintToken(t, "user-1", 24*time.Hour)
+	c := newClient(t, ts, client.WithToken(token))
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		call     func() error
+		sentinel error
+		status   int
+		code     string
+	}{
+		{
+			name:     "not found",
+			call:     func() error { _, err := c.GetItem(ctx, "missing"); return err },
+			sentinel: client.ErrNotFound,
+			status:   http.StatusNotFound,
+			code:     "item_not_found",
+		},
+		{
+			name:     "conflict",
+			call:     func() error { _, err := c.UpdateItem(ctx, "dup", client.ItemInput{Name: "Schnitzel"}); return err },
+			sentinel: client.ErrConflict,
+			status:   http.StatusConflict,
+			code:     "duplicate_item_name",
+		},
+		{
+			name: "unauthorized",
+			call: func() error {
+				anon := newClient(t, ts)
+				_, err := anon.CacheStats(ctx)
+				return err
+			},
+			sentinel: client.ErrUnauthorized,
+			status:   http.StatusUnauthorized,
+			code:     "authorization_header_missing",
+		},
+		{
+			name:   "validation",
+			call:   func() error { _, err := c.CreateItem(ctx, client.ItemInput{}); return err },
+			status: http.StatusBadRequest,
+			code:   "validation_failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			var apiErr *client.Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v (%T), want *client.Error", err, err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Code != tt.code {
+				t.Errorf("got %d %s, want %d %s", apiErr.StatusCode, apiErr.Code, tt.status, tt.code)
+			}
+			if apiErr.RequestID == "" {
+				t.Error("RequestID is empty")
+			}
+			if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+				t.Errorf("errors.Is(err, %v) = false", tt.sentinel)
+			}
+			for _, other := range []error{client.ErrNotFound, client.ErrConflict, client.ErrUnauthorized, client.ErrPreconditionFailed} {
+				if other != tt.sentinel && errors.Is(err, other) {
+					t.Errorf("errors.Is(err, %v) = true", other)
+				}
+			}
+		})
+	}
+
+	_, err := c.CreateItem(ctx, client.ItemInput{})
+	var apiErr *client.Error
+	errors.As(err, &apiErr)
+	if len(apiErr.Errors) != 2 || apiErr.Errors[0].Field != "categories" || apiErr.Errors[1].Code != "too_long" {
+		t.Errorf("field errors = %+v", apiErr.Errors)
+	}
+}
+
+func TestPreconditionFailedCarriesCurrentItem(t *testing.T) {
+	ts := newTestServer(t)
+	current := models.SpeisekarteItem{ID: "item-1", Name: "Gulasch", Version: 3}
+	ts.handle("PATCH /speisekarte/item-1", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("If-Match"), `"item-1-2"`; got != want {
+			t.Errorf("If-Match = %q, want %q", got, want)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/merge-patch+json" {
+			t.Errorf("Content-Type = %q", got)
+		}
+		p := problem.New(http.StatusPreconditionFailed, "precondition_failed", "The item has been changed since it was fetched")
+		problem.Write(w, r, p.With("current", current))
+	})
+	c := newClient(t, ts, client.WithToken(mintToken(t, "user-1", 24*time.Hour)))
+
+	stale := models.SpeisekarteItem{ID: "item-1", Version: 2}
+	_, err := c.PatchItem(context.Background(), "item-1", map[string]any{"price_cents": 1290}, client.IfUnchanged(stale))
+	if !errors.Is(err, client.ErrPreconditionFailed) {
+		t.Fatalf("error = %v, want ErrPreconditionFailed", err)
+	}
+
+	var apiErr *client.Error
+	errors.As(err, &apiErr)
+	var got models.SpeisekarteItem
+	if ok, err := apiErr.Extension("current", &got); !ok || err != nil {
+		t.Fatalf("Extension(current) = %v, %v", ok, err)
+	}
+	if got.Name != current.Name || got.Version != current.Version {
+		t.Errorf("current = %+v, want %+v", got, current)
+	}
+}
+
+func TestUploadItemImage(t *testing.T) {
+	ts := newTestServer(t)
+	ts.handle("PUT /speisekarte/item-1/image", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			t.Error("request is not authenticated")
+		}
+		file, header, err := r.FormFile("image")
+		if err != nil {
+			t.Fatalf("FormFile: %v", err)
+		}
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		if header.Filename != "gulasch.jpg" || header.Header.Get("Content-Type") != "image/jpeg" || string(data) != "jpeg bytes" {
+			t.Errorf("got %q (%s): %q", header.Filename, header.Header.Get("Content-Type"), data)
+		}
+		image := "https://cdn.example.com/gulasch.jpg"
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.SpeisekarteItem{ID: "item-1", Image: &image})
+	})
+	c := newClient(t, ts, client.WithToken(mintToken(t, "user-1", 24*time.Hour)))
+
+	item, err := c.UploadItemImage(context.Background(), "item-1", client.File{
+		Filename:    "gulasch.jpg",
+		ContentType: "image/jpeg",
+		Body:        strings.NewReader("jpeg bytes"),
+	})
+	if err != nil {
+		t.Fatalf("UploadItemImage: %v", err)
+	}
+	if item.Image == nil || *item.Image != "https://cdn.example.com/gulasch.jpg" {
+		t.Errorf("image = %v", item.Image)
+	}
+}
+
+func TestCreateItemWithImageSendsFormFields(t *testing.T) {
+	ts := newTestServer(t)
+	ts.handle("POST /speisekarte/", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm: %v", err)
+		}
+		if r.FormValue("name") != "Gulasch" || r.FormValue("price_cents") != "1490" ||
+			strings.Join(r.Form["categories"], ",") != "Hauptgerichte,Suppen" {
+			t.Errorf("form = %v", r.Form)
+		}
+		if _, _, err := r.FormFile("image"); err != nil {
+			t.Errorf("FormFile: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(models.SpeisekarteItem{ID: "item-1", Name: "Gulasch"})
+	})
+	c := newClient(t, ts, client.WithToken(mintToken(t, "user-1", 24*time.Hour)))
+
+	item, err := c.CreateItemWithImage(context.Background(), client.ItemInput{
+		Name:       "Gulasch",
+		PriceCents: 1490,
+		Categories: []string{"Hauptgerichte", "Suppen"},
+	}, client.File{Filename: "gulasch.jpg", Body: strings.NewReader("jpeg bytes")})
+	if err != nil {
+		t.Fatalf("CreateItemWithImage: %v", err)
+	}
+	if item.ID != "item-1" {
+		t.Errorf("item = %+v", item)
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	ts := newTestServer(t)
+	c := newClient(t, ts)
+
+	spec, err := c.OpenAPISpec(context.Background())
+	if err != nil {
+		t.Fatalf("OpenAPISpec: %v", err)
+	}
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil || doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q, %v", doc.OpenAPI, err)
+	}
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+// ListTrash returns the deleted items that have not been purged yet.
+func (c *Client) ListTrash(ctx context.Context) ([]models.SpeisekarteItem, error) {
+	var items []models.SpeisekarteItem
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/speisekarte/trash", auth: true}, &items)
+	return items, err
+}
+
+func (c *Client) RestoreItem(ctx context.Context, id string) (*models.SpeisekarteItem, error) {
+	var item models.SpeisekarteItem
+	err := c.doJSON(ctx, &request{method: http.MethodPost, path: "/speisekarte/trash/" + url.PathEscape(id) + "/restore", auth: true}, &item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// PurgeItem permanently deletes an item from the trash.
+func (c *Client) PurgeItem(ctx context.Context, id string) error {
+	return c.doJSON(ctx, &request{method: http.MethodDelete, path: "/speisekarte/trash/" + url.PathEscape(id), auth: true}, nil)
+}
+
+func (c *Client) ListDrafts(ctx context.Context) ([]models.SpeisekarteDraft, error) {
+	var drafts []models.SpeisekarteDraft
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/speisekarte/drafts", auth: true}, &drafts)
+	return drafts, err
+}
+
+// draftInput is the JSON body of a draft. Deletions have no item fields.
+type draftInput struct {
+	*ItemInput
+	Action string `json:"action"`
+	ItemID string `json:"item_id,omitempty"`
+}
+
+// SaveDraft drafts a new item, or with itemID an edit to an existing item,
+// replacing any earlier draft for it. image may be nil.
+func (c *Client) SaveDraft(ctx context.Context, itemID string, in ItemInput, image *File) (*models.SpeisekarteDraft, error) {
+	if image == nil {
+		return c.saveDraft(ctx, jsonBody(draftInput{ItemInput: &in, Action: models.DraftActionUpsert, ItemID: itemID}), "")
+	}
+	fields := in.formValues()
+	fields.Set("action", models.DraftActionUpsert)
+	if itemID != "" {
+		fields.Set("item_id", itemID)
+	}
+	body, contentType, err := multipartBody(fields, image, "image")
+	if err != nil {
+		return nil, err
+	}
+	return c.saveDraft(ctx, body, contentType)
+}
+
+// DraftDeletion drafts the removal of an item.
+func (c *Client) DraftDeletion(ctx context.Context, itemID string) (*models.SpeisekarteDraft, error) {
+	return c.saveDraft(ctx, jsonBody(draftInput{Action: models.DraftActionDelete, ItemID: itemID}), "")
+}
+
+func (c *Client) saveDraft(ctx context.Context, body []byte, contentType string) (*models.SpeisekarteDraft, error) {
+	rq := &request{method: http.MethodPost, path: "/speisekarte/drafts", body: body, contentType: contentType, auth: true}
+
+	var draft models.SpeisekarteDraft
+	if err := c.doJSON(ctx, rq, &draft); err != nil {
+		return nil, err
+	}
+	return &draft, nil
+}
+
+// UpdateDraft replaces the fields of a draft and, unless image is nil, its
+// image.
+func (c *Client) UpdateDraft(ctx context.Context, id string, in ItemInput, image *File) (*models.SpeisekarteDraft, error) {
+	rq := &request{method: http.MethodPut, path: "/speisekarte/drafts/" + url.PathEscape(id), body: jsonBody(in), auth: true}
+	if image != nil {
+		body, contentType, err := multipartBody(in.formValues(), image, "image")
+		if err != nil {
+			return nil, err
+		}
+		rq.body, rq.contentType = body, contentType
+	}
+
+	var draft models.SpeisekarteDraft
+	if err := c.doJSON(ctx, rq, &draft); err != nil {
+		return nil, err
+	}
+	return &draft, nil
+}
+
+// DeleteDraft discards a draft.
+func (c *Client) DeleteDraft(ctx context.Context, id string) error {
+	return c.doJSON(ctx, &request{method: http.MethodDelete, path: "/speisekarte/drafts/" + url.PathEscape(id), auth: true}, nil)
+}
+
+// PublishResult is the outcome of Publish: either the number of drafts
+// published now, or the publication that will publish them later.
+type PublishResult struct {
+	Published   int                 `json:"published"`
+	Publication *models.Publication `json:"-"`
+}
+
+// Publish publishes every pending draft now, or at publishAt if it is not
+// the zero time.
+func (c *Client) Publish(ctx context.Context, publishAt time.Time) (*PublishResult, error) {
+	var body struct {
+		PublishAt *time.Time `json:"publish_at,omitempty"`
+	}
+	if !publishAt.IsZero() {
+		body.PublishAt = &publishAt
+	}
+
+	rq := &request{method: http.MethodPost, path: "/speisekarte/drafts/publish", body: jsonBody(body), auth: true}
+	if body.PublishAt == nil {
+		var result PublishResult
+		if err := c.doJSON(ctx, rq, &result); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+
+	var publication models.Publication
+	if err := c.doJSON(ctx, rq, &publication); err != nil {
+		return nil, err
+	}
+	return &PublishResult{Publication: &publication}, nil
+}
+
+func (c *Client) ListPublications(ctx context.Context) ([]models.Publication, error) {
+	var publications []models.Publication
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/speisekarte/publications", auth: true}, &publications)
+	return publications, err
+}
+
+// CancelPublication cancels a scheduled publication. Its drafts become
+// pending again.
+func (c *Client) CancelPublication(ctx context.Context, id string) (*models.Publication, error) {
+	var publication models.Publication
+	err := c.doJSON(ctx, &request{method: http.MethodDelete, path: "/speisekarte/publications/" + url.PathEscape(id), auth: true}, &publication)
+	if err != nil {
+		return nil, err
+	}
+	return &publication, nil
+}
+
+// PageOptions pages a list. Zero values use the server's defaults.
+type PageOptions struct {
+	Limit  int
+	Offset int
+}
+
+func (o *PageOptions) values() url.Values {
+	v := url.Values{}
+	if o == nil {
+		return v
+	}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		v.Set("offset", strconv.Itoa(o.Offset))
+	}
+	return v
+}
+
+// ListVersions returns menu versions, newest first, without their items.
+func (c *Client) ListVersions(ctx context.Context, opts *PageOptions) ([]models.MenuVersion, error) {
+	var versions []models.MenuVersion
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/speisekarte/versions", query: opts.values(), auth: true}, &versions)
+	return versions, err
+}
+
+// GetVersion returns a menu version with its items.
+func (c *Client) GetVersion(ctx context.Context, id int64) (*models.MenuVersion, error) {
+	var version models.MenuVersion
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: versionPath(id), auth: true}, &version)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// CreateVersion snapshots the live menu. label may be empty.
+func (c *Client) CreateVersion(ctx context.Context, label string) (*models.MenuVersion, error) {
+	body := jsonBody(map[string]string{"label": label})
+	var version models.MenuVersion
+	err := c.doJSON(ctx, &request{method: http.MethodPost, path: "/speisekarte/versions", body: body, auth: true}, &version)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// DiffVersions compares version from with version to, or with the live menu
+// if to is nil.
+func (c *Client) DiffVersions(ctx context.Context, from int64, to *int64) (*models.VersionDiff, error) {
+	q := url.Values{"from": {strconv.FormatInt(from, 10)}}
+	if to != nil {
+		q.Set("to", strconv.FormatInt(*to, 10))
+	}
+	var diff models.VersionDiff
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/speisekarte/versions/diff", query: q, auth: true}, &diff)
+	if err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// RollbackToVersion restores the menu to a version and returns the version
+// recording the rollback.
+func (c *Client) RollbackToVersion(ctx context.Context, id int64) (*models.MenuVersion, error) {
+	var version models.MenuVersion
+	err := c.doJSON(ctx, &request{method: http.MethodPost, path: versionPath(id) + "/rollback", auth: true}, &version)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func versionPath(id int64) string {
+	return "/speisekarte/versions/" + strconv.FormatInt(id, 10)
+}
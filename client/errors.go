@@ -0,0 +1,126 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors matched by *Error through errors.Is.
+var (
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// FieldError is one rejected field of a validation error.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error response of the API, read from its RFC 9457 problem
+// details body.
+type Error struct {
+	StatusCode int
+	// Code is the API's stable error code, e.g. "item_not_found".
+	Code      string
+	Title     string
+	Detail    string
+	RequestID string
+	// Errors lists the rejected fields of a validation error.
+	Errors []FieldError
+	// Extensions holds the other members of the problem, such as the
+	// current item of a failed If-Match or the report of a rejected import.
+	Extensions map[string]json.RawMessage
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("gasthaus: %d %s", e.StatusCode, e.Code)
+	if e.Code == "" {
+		msg = fmt.Sprintf("gasthaus: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	for _, f := range e.Errors {
+		msg += "; " + f.Message
+	}
+	return msg
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrPreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed
+	}
+	return false
+}
+
+// Extension decodes the problem member name into v. It returns false if the
+// problem has no such member.
+func (e *Error) Extension(name string, v any) (bool, error) {
+	raw, ok := e.Extensions[name]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// errorFromResponse reads an error response and closes its body. Bodies that
+// are not problem details become the Error's Detail.
+func errorFromResponse(resp *http.Response) *Error {
+	defer resp.Body.Close()
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Title:      http.StatusText(resp.StatusCode),
+		RequestID:  resp.Header.Get("X-Request-ID"),
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return e
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/problem+json" {
+		e.Detail = strings.TrimSpace(string(body))
+		return e
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		e.Detail = strings.TrimSpace(string(body))
+		return e
+	}
+	for name, target := range map[string]any{
+		"code":       &e.Code,
+		"title":      &e.Title,
+		"detail":     &e.Detail,
+		"request_id": &e.RequestID,
+		"errors":     &e.Errors,
+	} {
+		if raw, ok := members[name]; ok {
+			json.Unmarshal(raw, target)
+			delete(members, name)
+		}
+	}
+	for _, name := range []string{"type", "status", "instance"} {
+		delete(members, name)
+	}
+	if len(members) > 0 {
+		e.Extensions = members
+	}
+	return e
+}
@@ -0,0 +1,550 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+// ItemInput holds the editable fields of a menu item.
+type ItemInput struct {
+	Name        string   `json:"name"`
+	Description *string  `json:"description"`
+	PriceCents  int      `json:"price_cents"`
+	Categories  []string `json:"categories"`
+	Ingredients []string `json:"ingredients"`
+	Tags        []string `json:"tags"`
+	Seasonal    bool     `json:"seasonal"`
+}
+
+// File is an image or menu file to upload with a multipart request.
+type File struct {
+	Filename string
+	// ContentType defaults to application/octet-stream.
+	ContentType string
+	Body        io.Reader
+}
+
+// WriteOption modifies a request that changes an item.
+type WriteOption func(*request)
+
+// IfMatch makes a change conditional on the item's current ETag. If the item
+// has changed since, the request fails with ErrPreconditionFailed.
+func IfMatch(etag string) WriteOption {
+	return func(rq *request) {
+		if rq.header == nil {
+			rq.header = http.Header{}
+		}
+		rq.header.Set("If-Match", etag)
+	}
+}
+
+// IfUnchanged makes a change conditional on item still being at the version
+// the client has.
+func IfUnchanged(item models.SpeisekarteItem) WriteOption {
+	return IfMatch(ItemETag(item))
+}
+
+// ItemETag returns the ETag the server sends for item.
+func ItemETag(item models.SpeisekarteItem) string {
+	return `"` + item.ID + "-" + strconv.Itoa(item.Version) + `"`
+}
+
+func writeRequest(method, path string, body []byte, opts []WriteOption) *request {
+	rq := &request{method: method, path: path, body: body, auth: true}
+	for _, opt := range opts {
+		opt(rq)
+	}
+	return rq
+}
+
+// itemPath returns the path of a resource below /speisekarte, escaping id.
+func itemPath(id string, rest ...string) string {
+	return "/speisekarte/" + url.PathEscape(id) + strings.Join(rest, "")
+}
+
+// multipartBody encodes fields, and file unless it is nil, as a multipart
+// form. Lists take one form value per entry.
+func multipartBody(fields url.Values, file *File, fileField string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for name, values := range fields {
+		for _, v := range values {
+			if err := mw.WriteField(name, v); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if file != nil {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, fileField, file.Filename))
+		h.Set("Content-Type", contentType)
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := io.Copy(part, file.Body); err != nil {
+			return nil, "", fmt.Errorf("reading %s: %w", file.Filename, err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mw.FormDataContentType(), nil
+}
+
+func (in ItemInput) formValues() url.Values {
+	v := url.Values{
+		"name":        {in.Name},
+		"price_cents": {strconv.Itoa(in.PriceCents)},
+		"categories":  in.Categories,
+		"ingredients": in.Ingredients,
+		"tags":        in.Tags,
+		"seasonal":    {strconv.FormatBool(in.Seasonal)},
+	}
+	if in.Description != nil {
+		v.Set("description", *in.Description)
+	}
+	return v
+}
+
+// ListItemsOptions filters, sorts and pages GET /speisekarte/. The zero
+// value lists the whole menu by name.
+type ListItemsOptions struct {
+	Category           string
+	Tags               []string
+	Ingredients        []string
+	ExcludeIngredients []string
+	MinPrice, MaxPrice *int
+	Seasonal           *bool
+	Available          *bool
+	// Sort is name, price, created_at or position, prefixed with "-" to
+	// sort descending.
+	Sort string
+	// Limit enables paging. Pass ItemPage.NextCursor as Cursor for the next
+	// page.
+	Limit  int
+	Cursor string
+	// Fields limits the returned fields; the others are left zero.
+	Fields []string
+}
+
+func (o *ListItemsOptions) values() url.Values {
+	v := url.Values{}
+	if o == nil {
+		return v
+	}
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	setBool := func(key string, b *bool) {
+		if b != nil {
+			v.Set(key, strconv.FormatBool(*b))
+		}
+	}
+	setInt := func(key string, n *int) {
+		if n != nil {
+			v.Set(key, strconv.Itoa(*n))
+		}
+	}
+	set("category", o.Category)
+	set("tags", strings.Join(o.Tags, ","))
+	set("ingredients", strings.Join(o.Ingredients, ","))
+	set("exclude_ingredients", strings.Join(o.ExcludeIngredients, ","))
+	setInt("min_price", o.MinPrice)
+	setInt("max_price", o.MaxPrice)
+	setBool("seasonal", o.Seasonal)
+	setBool("available", o.Available)
+	set("sort", o.Sort)
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	set("cursor", o.Cursor)
+	set("fields", strings.Join(o.Fields, ","))
+	return v
+}
+
+type ItemPage struct {
+	Items []models.SpeisekarteItem
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// ListItems returns the live menu items matching opts.
+func (c *Client) ListItems(ctx context.Context, opts *ListItemsOptions) (*ItemPage, error) {
+	resp, err := c.do(ctx, &request{method: http.MethodGet, path: "/speisekarte/", query: opts.values()})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	page := &ItemPage{NextCursor: resp.Header.Get("X-Next-Cursor")}
+	if err := json.NewDecoder(resp.Body).Decode(&page.Items); err != nil {
+		return nil, fmt.Errorf("decoding items: %w", err)
+	}
+	return page, nil
+}
+
+// PreviewItem is an item as it will look once every pending draft is
+// published. DraftID is set if a draft changes it.
+type PreviewItem struct {
+	models.SpeisekarteItem
+	DraftID *string `json:"draft_id,omitempty"`
+}
+
+type PreviewPage struct {
+	Items []PreviewItem
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// PreviewItems returns the menu as it will look once every pending draft is
+// published. opts filter, sort and page it as they do for ListItems.
+func (c *Client) PreviewItems(ctx context.Context, opts *ListItemsOptions) (*PreviewPage, error) {
+	q := opts.values()
+	q.Set("preview", "true")
+	resp, err := c.do(ctx, &request{method: http.MethodGet, path: "/speisekarte/", query: q, auth: true})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	page := &PreviewPage{NextCursor: resp.Header.Get("X-Next-Cursor")}
+	if err := json.NewDecoder(resp.Body).Decode(&page.Items); err != nil {
+		return nil, fmt.Errorf("decoding items: %w", err)
+	}
+	return page, nil
+}
+
+func (c *Client) GetItem(ctx context.Context, id string) (*models.SpeisekarteItem, error) {
+	var item models.SpeisekarteItem
+	if err := c.doJSON(ctx, &request{method: http.MethodGet, path: itemPath(id)}, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// CreateItem creates an item without an image.
+func (c *Client) CreateItem(ctx context.Context, in ItemInput) (*models.SpeisekarteItem, error) {
+	var item models.SpeisekarteItem
+	if err := c.doJSON(ctx, writeRequest(http.MethodPost, "/speisekarte/", jsonBody(in), nil), &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// CreateItemWithImage creates an item and uploads its image in one request.
+func (c *Client) CreateItemWithImage(ctx context.Context, in ItemInput, image File) (*models.SpeisekarteItem, error) {
+	body, contentType, err := multipartBody(in.formValues(), &image, "image")
+	if err != nil {
+		return nil, err
+	}
+	rq := writeRequest(http.MethodPost, "/speisekarte/", body, nil)
+	rq.contentType = contentType
+
+	var item models.SpeisekarteItem
+	if err := c.doJSON(ctx, rq, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// UpdateItem replaces every editable field of an item. Its image is kept.
+func (c *Client) UpdateItem(ctx context.Context, id string, in ItemInput, opts ...WriteOption) (*models.SpeisekarteItem, error) {
+	var item models.SpeisekarteItem
+	if err := c.doJSON(ctx, writeRequest(http.MethodPut, itemPath(id), jsonBody(in), opts), &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// UpdateItemWithImage replaces every editable field of an item and, unless
+// image is nil, its image.
+func (c *Client) UpdateItemWithImage(ctx context.Context, id string, in ItemInput, image *File, opts ...WriteOption) (*models.SpeisekarteItem, error) {
+	body, contentType, err := multipartBody(in.formValues(), image, "image")
+	if err != nil {
+		return nil, err
+	}
+	rq := writeRequest(http.MethodPut, itemPath(id), body, opts)
+	rq.contentType = contentType
+
+	var item models.SpeisekarteItem
+	if err := c.doJSON(ctx, rq, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// PatchItem changes only the fields in patch, as a JSON Merge Patch
+// (RFC 7396). A nil value removes an optional field.
+func (c *Client) PatchItem(ctx context.Context, id string, patch map[string]any, opts ...WriteOption) (*models.SpeisekarteItem, error) {
+	rq := writeRequest(http.MethodPatch, itemPath(id), jsonBody(patch), opts)
+	rq.contentType = "application/merge-patch+json"
+
+	var item models.SpeisekarteItem
+	if err := c.doJSON(ctx, rq, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// DeleteItem moves an item to the trash.
+func (c *Client) DeleteItem(ctx context.Context, id string, opts ...WriteOption) error {
+	return c.doJSON(ctx, writeRequest(http.MethodDelete, itemPath(id), nil, opts), nil)
+}
+
+// UploadItemImage replaces an item's image.
+func (c *Client) UploadItemImage(ctx context.Context, id string, image File, opts ...WriteOption) (*models.SpeisekarteItem, error) {
+	body, contentType, err := multipartBody(nil, &image, "image")
+	if err != nil {
+		return nil, err
+	}
+	rq := writeRequest(http.MethodPut, itemPath(id, "/image"), body, opts)
+	rq.contentType = contentType
+
+	var item models.SpeisekarteItem
+	if err := c.doJSON(ctx, rq, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (c *Client) DeleteItemImage(ctx context.Context, id string, opts ...WriteOption) (*models.SpeisekarteItem, error) {
+	var item models.SpeisekarteItem
+	if err := c.doJSON(ctx, writeRequest(http.MethodDelete, itemPath(id, "/image"), nil, opts), &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// SetItemAvailability marks an item as sold out or available again.
+func (c *Client) SetItemAvailability(ctx context.Context, id string, available bool, opts ...WriteOption) (*models.SpeisekarteItem, error) {
+	body := jsonBody(map[string]bool{"available": available})
+	var item models.SpeisekarteItem
+	if err := c.doJSON(ctx, writeRequest(http.MethodPut, itemPath(id, "/availability"), body, opts), &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ReorderItems puts the given items first in the manual display order.
+func (c *Client) ReorderItems(ctx context.Context, ids []string) error {
+	body := jsonBody(map[string][]string{"ids": ids})
+	return c.doJSON(ctx, &request{method: http.MethodPut, path: "/speisekarte/positions", body: body, auth: true}, nil)
+}
+
+// Categories returns the categories in use, in alphabetical order.
+func (c *Client) Categories(ctx context.Context) ([]string, error) {
+	var categories []string
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/speisekarte/categories"}, &categories)
+	return categories, err
+}
+
+type SearchOptions struct {
+	// Limit defaults to 20 on the server.
+	Limit int
+	// Exact disables matching names similar to the query.
+	Exact bool
+}
+
+type SearchResult struct {
+	models.SpeisekarteItem
+	Rank float64 `json:"rank"`
+	// Highlights are HTML-escaped, with matches wrapped in <mark>.
+	Highlights struct {
+		Name        string  `json:"name"`
+		Description *string `json:"description"`
+	} `json:"highlights"`
+}
+
+// SearchItems runs a full-text search over the menu, best matches first.
+func (c *Client) SearchItems(ctx context.Context, query string, opts *SearchOptions) ([]SearchResult, error) {
+	q := url.Values{"q": {query}}
+	if opts != nil {
+		if opts.Limit > 0 {
+			q.Set("limit", strconv.Itoa(opts.Limit))
+		}
+		if opts.Exact {
+			q.Set("fuzzy", "false")
+		}
+	}
+	var results []SearchResult
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/speisekarte/search", query: q}, &results)
+	return results, err
+}
+
+// EventReset is the type of the event that tells a client it missed
+// changes and must reload the menu.
+const EventReset = "reset"
+
+// Event is a server-sent menu event. Data holds a models.MenuEvent except
+// for EventReset.
+type Event struct {
+	ID   string
+	Type string
+	Data json.RawMessage
+}
+
+// MenuEvent decodes e's data.
+func (e Event) MenuEvent() (models.MenuEvent, error) {
+	var ev models.MenuEvent
+	err := json.Unmarshal(e.Data, &ev)
+	return ev, err
+}
+
+// StreamEvents calls fn for each menu change until ctx is cancelled, fn
+// returns an error or the connection ends. Pass the ID of the last event
+// seen as lastEventID to resume after a disconnect, or "" to start with new
+// events. Reconnecting is left to the caller.
+func (c *Client) StreamEvents(ctx context.Context, lastEventID string, fn func(Event) error) error {
+	rq := &request{method: http.MethodGet, path: "/speisekarte/events", header: http.Header{"Accept": {"text/event-stream"}}}
+	if lastEventID != "" {
+		rq.header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := c.do(ctx, rq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var ev Event
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		field, value, _ := strings.Cut(scanner.Text(), ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			// A blank line ends an event; a line starting with ":" is a
+			// comment such as the heartbeat.
+			if scanner.Text() != "" || data == nil {
+				continue
+			}
+			ev.Data = json.RawMessage(strings.Join(data, "\n"))
+			if err := fn(ev); err != nil {
+				return err
+			}
+			ev, data = Event{}, nil
+		case "id":
+			ev.ID = value
+		case "event":
+			ev.Type = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return scanner.Err()
+}
+
+// ExportFormat is a menu file format for Export and Import.
+type ExportFormat string
+
+const (
+	FormatCSV  ExportFormat = "csv"
+	FormatJSON ExportFormat = "json"
+	FormatXLSX ExportFormat = "xlsx"
+)
+
+// Export downloads the live menu. The caller closes the returned reader.
+func (c *Client) Export(ctx context.Context, format ExportFormat) (io.ReadCloser, error) {
+	rq := &request{method: http.MethodGet, path: "/speisekarte/export", query: url.Values{"format": {string(format)}}, auth: true}
+	resp, err := c.do(ctx, rq)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+type ImportOptions struct {
+	// Format overrides the format derived from the file name.
+	Format ExportFormat
+	// DryRun only returns the report.
+	DryRun bool
+	// DeleteMissing deletes live items that are not in the file.
+	DeleteMissing bool
+}
+
+type ImportRow struct {
+	Row    int      `json:"row,omitempty"`
+	Action string   `json:"action"`
+	ID     string   `json:"id,omitempty"`
+	Name   string   `json:"name"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun  bool `json:"dry_run"`
+	Applied bool `json:"applied"`
+	Summary struct {
+		Created   int `json:"created"`
+		Updated   int `json:"updated"`
+		Deleted   int `json:"deleted"`
+		Unchanged int `json:"unchanged"`
+		Errors    int `json:"errors"`
+	} `json:"summary"`
+	Rows []ImportRow `json:"rows"`
+}
+
+// Import creates and updates items from a CSV, JSON or XLSX file. If any row
+// is invalid nothing is changed and the returned *Error carries the report;
+// read it with ImportErrorReport.
+func (c *Client) Import(ctx context.Context, file File, opts *ImportOptions) (*ImportReport, error) {
+	body, contentType, err := multipartBody(nil, &file, "file")
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	if opts != nil {
+		if opts.Format != "" {
+			q.Set("format", string(opts.Format))
+		}
+		if opts.DryRun {
+			q.Set("dry_run", "true")
+		}
+		if opts.DeleteMissing {
+			q.Set("delete_missing", "true")
+		}
+	}
+	rq := &request{method: http.MethodPost, path: "/speisekarte/import", query: q, body: body, contentType: contentType, auth: true}
+
+	var report ImportReport
+	if err := c.doJSON(ctx, rq, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ImportErrorReport returns the report of an import rejected for invalid
+// rows, or nil if err is not such an error.
+func ImportErrorReport(err error) *ImportReport {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return nil
+	}
+	var report ImportReport
+	if ok, err := apiErr.Extension("report", &report); !ok || err != nil {
+		return nil
+	}
+	return &report
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gomisroca/gasthaus-backend/handlers"
+	"github.com/gomisroca/gasthaus-backend/internal"
+	"github.com/gomisroca/gasthaus-backend/internal/config"
+)
+
+// cacheCommand purges the menu caches of all running servers. Each keeps its
+// own in-process cache, so this goes through PostgreSQL notifications.
+func cacheCommand(cfg *config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "purge" {
+		return errors.New("usage: cache purge")
+	}
+
+	dbpool, err := internal.SetupDB(cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer dbpool.Close()
+
+	if err := handlers.PurgeMenuCaches(context.Background(), dbpool); err != nil {
+		return fmt.Errorf("failed to notify servers: %w", err)
+	}
+	fmt.Println("Menu caches purged.")
+	return nil
+}
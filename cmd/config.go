@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gomisroca/gasthaus-backend/internal/config"
+)
+
+// configCommand prints the configuration the server would run with, then
+// any problems that would stop it from starting.
+func configCommand(cfg *config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New("usage: config print")
+	}
+	if err := cfg.Print(os.Stdout); err != nil {
+		return err
+	}
+	if err := cfg.Validate("DATABASE_URL", "JWT_SECRET", "FRONTEND_ORIGIN"); err != nil {
+		fmt.Fprintln(os.Stderr)
+		return err
+	}
+	return nil
+}
@@ -2,91 +2,187 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/gomisroca/gasthaus-backend/handlers"
 	"github.com/gomisroca/gasthaus-backend/internal"
+	"github.com/gomisroca/gasthaus-backend/internal/clientip"
+	"github.com/gomisroca/gasthaus-backend/internal/config"
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/menucache"
+	"github.com/gomisroca/gasthaus-backend/internal/metrics"
+	"github.com/gomisroca/gasthaus-backend/internal/requestid"
+	"github.com/gomisroca/gasthaus-backend/internal/tracing"
 	"github.com/gomisroca/gasthaus-backend/routes"
-	"github.com/gorilla/mux"
-	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
 
-func healthCheckHandler(dbpool *pgxpool.Pool) http.HandlerFunc {
-    return func(w http.ResponseWriter, r *http.Request) {
-        if err := dbpool.Ping(r.Context()); err != nil {
-            http.Error(w, "DB unavailable", http.StatusServiceUnavailable)
-            return
-        }
-        w.WriteHeader(http.StatusOK)
-        fmt.Fprintln(w, "OK")
-    }
-}
+const usage = `Usage: server [flags] [command] [arguments]
+
+Commands:
+  serve                     run the API server (the default)
+  migrate up                apply all pending migrations
+  migrate down [N | -all]   revert the last N migrations (default 1) or all of them
+  migrate goto VERSION      migrate up or down to VERSION
+  migrate status            print the schema version and pending migrations
+  migrate force VERSION     mark VERSION as applied and clean, after fixing a failed migration by hand
+  seed                      load a sample menu and an admin user
+  user create EMAIL         create a user, reading the password from stdin
+  cache purge               make running servers drop their menu caches
+  config print              print the configuration with secrets masked
+
+Settings come from flags, the environment and an env file, in that order;
+see the flags below. The server does not migrate on boot unless
+AUTO_MIGRATE=true.
+
+`
 
 func main() {
-	// Load environment variables from .env file
-	if err := godotenv.Load("../.env"); err != nil {
-		log.Println("Warning: .env file not found, relying on environment variables")
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print(usage + config.FlagUsage())
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	if err := internal.RunMigrations(); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
 	}
 
-	dbpool, err := internal.SetupDB()
+	switch command {
+	case "serve":
+		err = withConfig(cfg, serve, "DATABASE_URL", "JWT_SECRET", "FRONTEND_ORIGIN")
+	case "migrate":
+		err = withConfig(cfg, func(cfg *config.Config) error { return migrateCommand(cfg, args) }, "DATABASE_URL")
+	case "seed":
+		err = withConfig(cfg, func(cfg *config.Config) error { return seedCommand(cfg, args) }, "DATABASE_URL")
+	case "user":
+		err = withConfig(cfg, func(cfg *config.Config) error { return userCommand(cfg, args) }, "DATABASE_URL")
+	case "cache":
+		err = withConfig(cfg, func(cfg *config.Config) error { return cacheCommand(cfg, args) }, "DATABASE_URL")
+	case "config":
+		err = configCommand(cfg, args)
+	case "help":
+		fmt.Print(usage + config.FlagUsage())
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
 	if err != nil {
-		log.Fatalf("Failed to set up DB: %v", err)
+		log.Fatal(err)
 	}
-	defer dbpool.Close()
-	fmt.Println("DB connected successfully")
+}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable not set")
+// withConfig runs command if cfg is valid and has the required settings.
+func withConfig(cfg *config.Config, command func(*config.Config) error, required ...string) error {
+	if err := cfg.Validate(required...); err != nil {
+		return err
 	}
+	return command(cfg)
+}
 
-	r := mux.NewRouter()
+// serve runs the API server until it receives SIGINT or SIGTERM.
+func serve(cfg *config.Config) error {
+	logger := logging.New(os.Stderr, cfg.LogLevel)
+	slog.SetDefault(logger)
 
-	fs := http.FileServer(http.Dir("static/"))
-	r.Handle("/static/", http.StripPrefix("/static/", fs))
-	
-	r.HandleFunc("/", healthCheckHandler(dbpool)).Methods("GET")
-	routes.RegisterAuthRoutes(r, dbpool, jwtSecret)
-	routes.RegisterSpeisekarteRoutes(r, dbpool, jwtSecret)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TraceExporter)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush traces", "err", err)
+		}
+	}()
 
-	// CORS setup
-	origin := os.Getenv("FRONTEND_ORIGIN")
-	if origin == "" {
-		log.Fatal("FRONTEND_ORIGIN environment variable is not set")
+	if cfg.AutoMigrate {
+		if err := internal.RunMigrations(cfg.DatabaseURL, cfg.MigrationsPath); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
 	}
 
+	dbpool, err := internal.SetupDB(cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to set up DB: %w", err)
+	}
+	defer dbpool.Close()
+	slog.Info("DB connected successfully")
+	if err := metrics.RegisterPool(dbpool); err != nil {
+		return fmt.Errorf("failed to register pool metrics: %w", err)
+	}
+
+	menuCacheConfig := menucache.DefaultConfig
+	menuCacheConfig.TTL, menuCacheConfig.StaleTTL = cfg.MenuCacheTTL, cfg.MenuCacheStaleTTL
+	menuCacheConfig.Observe = metrics.ObserveMenuCache
+
+	// Background jobs stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	speisekarte := handlers.NewSpeisekarteHandler(dbpool, menucache.New(menuCacheConfig))
+	speisekarte.CacheControl = handlers.CacheControlValue(cfg.HTTPCacheMaxAge, cfg.HTTPCacheStaleWhileRevalidate)
+	if cfg.SupabaseProjectRef != "" {
+		speisekarte.Images = &internal.Supabase{ProjectRef: cfg.SupabaseProjectRef, ServiceRoleKey: cfg.SupabaseServiceRoleKey}
+	}
+	speisekarte.StartTrashPurger(jobsCtx, cfg.TrashRetention, time.Hour)
+	speisekarte.StartVersionPruner(jobsCtx, cfg.MenuVersionsKept, time.Hour)
+	speisekarte.StartPublicationScheduler(jobsCtx, 30*time.Second)
+	speisekarte.StartChangeListener(jobsCtx)
+
+	webhooks := &handlers.WebhookHandler{DB: dbpool}
+	webhooks.StartDispatcher(jobsCtx, 5*time.Second)
+
+	r := routes.NewRouter(dbpool, speisekarte, webhooks, cfg.JWTSecret)
+
+	// CORS setup
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{origin},
+		AllowedOrigins:   cfg.FrontendOrigins,
 		AllowCredentials: true,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "If-Modified-Since", "Last-Event-ID", "X-Request-ID", "traceparent", "tracestate"},
+		ExposedHeaders:   []string{"ETag", "Last-Modified", "Link", "Location", "X-Next-Cursor", "X-Request-ID"},
 	})
 
-	handler := c.Handler(r)
+	handler := tracing.Middleware(requestid.Middleware(clientip.Middleware(cfg.TrustProxy)(logging.Middleware(logger)(metrics.Middleware(c.Handler(r))))))
+
+	// Metrics have their own listener so they are not exposed on the public
+	// API port. Scrapes are not logged or counted.
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", metrics.Handler())
+	metricsSrv := &http.Server{
+		Addr:              cfg.MetricsAddr,
+		Handler:           metricsMux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
 
 	// Create http.Server with your router and config
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
 	srv := &http.Server{
-		Addr: ":" + port,
+		Addr:         ":" + strconv.Itoa(cfg.Port),
 		Handler:      handler,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
 	}
+	srv.RegisterOnShutdown(speisekarte.Events.Close)
 
 	// Channel to listen for interrupt or terminate signal from OS
 	stopChan := make(chan os.Signal, 1)
@@ -94,15 +190,24 @@ func main() {
 
 	// Run server in a goroutine so it doesn’t block
 	go func() {
-		log.Println("Starting server on :8080")
+		slog.Info("Starting server", "addr", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("ListenAndServe(): %v", err)
+			slog.Error("Server failed", "err", err)
+			os.Exit(1)
+		}
+	}()
+	go func() {
+		slog.Info("Serving metrics", "addr", metricsSrv.Addr)
+		if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Metrics server failed", "err", err)
+			os.Exit(1)
 		}
 	}()
 
 	// Block until we receive signal
 	<-stopChan
-	log.Println("Shutdown signal received, shutting down server gracefully...")
+	slog.Info("Shutdown signal received, shutting down server gracefully")
+	stopJobs()
 
 	// Create a deadline to wait for current operations to finish
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -111,8 +216,10 @@ func main() {
 	// Shutdown server gracefully — stops accepting new requests,
 	// waits for ongoing requests, or timeout after 5 seconds
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server Shutdown Failed:%+v", err)
+		return fmt.Errorf("server shutdown failed: %w", err)
 	}
+	metricsSrv.Close()
 
-	log.Println("Server exited properly")
+	slog.Info("Server exited properly")
+	return nil
 }
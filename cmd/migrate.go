@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/gomisroca/gasthaus-backend/internal"
+	"github.com/gomisroca/gasthaus-backend/internal/config"
+)
+
+// migrateLogger prints each migration as it is applied.
+type migrateLogger struct{}
+
+func (migrateLogger) Printf(format string, v ...any) {
+	log.Printf(strings.TrimSuffix(format, "\n"), v...)
+}
+
+func (migrateLogger) Verbose() bool { return false }
+
+func migrateCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|goto|status|force")
+	}
+
+	migrationPath := cfg.MigrationsPath
+	m, err := internal.NewMigrate(cfg.DatabaseURL, migrationPath)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	m.Log = migrateLogger{}
+
+	switch sub, args := args[0], args[1:]; sub {
+	case "up":
+		err = m.Up()
+	case "down":
+		switch {
+		case len(args) == 0:
+			err = m.Steps(-1)
+		case args[0] == "-all":
+			err = m.Down()
+		default:
+			n, convErr := strconv.Atoi(args[0])
+			if convErr != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[0])
+			}
+			err = m.Steps(-n)
+		}
+	case "goto":
+		version, convErr := parseVersion(args)
+		if convErr != nil {
+			return convErr
+		}
+		err = m.Migrate(version)
+	case "force":
+		version, convErr := parseVersion(args)
+		if convErr != nil {
+			return convErr
+		}
+		err = m.Force(int(version))
+	case "status":
+		return printMigrationStatus(m, migrationPath)
+	default:
+		return fmt.Errorf("unknown migrate command %q", sub)
+	}
+
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("No change.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return printMigrationStatus(m, migrationPath)
+}
+
+func parseVersion(args []string) (uint, error) {
+	if len(args) != 1 {
+		return 0, errors.New("a migration version is required")
+	}
+	version, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid migration version %q", args[0])
+	}
+	return uint(version), nil
+}
+
+// printMigrationStatus prints the schema version and lists the migrations
+// in migrationPath that are not applied yet.
+func printMigrationStatus(m *migrate.Migrate, migrationPath string) error {
+	version, dirty, err := m.Version()
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+		fmt.Println("Schema version: none")
+	case err != nil:
+		return err
+	case dirty:
+		fmt.Printf("Schema version: %d (dirty: the migration failed; fix it and run migrate force)\n", version)
+	default:
+		fmt.Printf("Schema version: %d\n", version)
+	}
+
+	pending, err := pendingMigrations(migrationPath, version)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Println("No pending migrations.")
+		return nil
+	}
+	fmt.Printf("%d pending:\n", len(pending))
+	for _, name := range pending {
+		fmt.Println("  " + name)
+	}
+	return nil
+}
+
+// pendingMigrations returns the names of the up migrations newer than
+// version, in order.
+func pendingMigrations(migrationPath string, version uint) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(migrationPath, "*.up.sql"))
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".up.sql")
+		prefix, _, _ := strings.Cut(name, "_")
+		v, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		if uint(v) > version {
+			pending = append(pending, name)
+		}
+	}
+	slices.Sort(pending)
+	return pending, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/gomisroca/gasthaus-backend/internal"
+	"github.com/gomisroca/gasthaus-backend/internal/config"
+)
+
+type seedItem struct {
+	name        string
+	description string
+	priceCents  int
+	categories  []string
+	ingredients []string
+	tags        []string
+	seasonal    bool
+}
+
+// sampleMenu is a small Gasthaus menu for development and demos.
+var sampleMenu = []seedItem{
+	{"Leberknödelsuppe", "Kräftige Rinderbrühe mit hausgemachtem Leberknödel", 690,
+		[]string{"Suppen"}, []string{"Rinderbrühe", "Leber", "Semmel", "Schnittlauch"}, nil, false},
+	{"Flädlesuppe", "Rinderbrühe mit Pfannkuchenstreifen", 590,
+		[]string{"Suppen"}, []string{"Rinderbrühe", "Mehl", "Ei", "Milch"}, nil, false},
+	{"Obatzda mit Brezel", "Angemachter Camembert mit Zwiebeln und Paprika", 890,
+		[]string{"Vorspeisen"}, []string{"Camembert", "Butter", "Zwiebeln", "Paprika", "Brezel"}, []string{"vegetarisch"}, false},
+	{"Wiener Schnitzel", "Vom Kalb, mit Kartoffelsalat und Preiselbeeren", 2290,
+		[]string{"Hauptgerichte"}, []string{"Kalb", "Ei", "Semmelbrösel", "Kartoffeln", "Preiselbeeren"}, nil, false},
+	{"Schweinsbraten", "Mit Kruste, Dunkelbiersoße und Kartoffelknödel", 1890,
+		[]string{"Hauptgerichte"}, []string{"Schwein", "Dunkelbier", "Kartoffeln"}, nil, false},
+	{"Käsespätzle", "Mit Bergkäse und Röstzwiebeln", 1490,
+		[]string{"Hauptgerichte"}, []string{"Mehl", "Ei", "Bergkäse", "Zwiebeln"}, []string{"vegetarisch"}, false},
+	{"Spargel mit Sauce Hollandaise", "Weißer Spargel mit neuen Kartoffeln", 2190,
+		[]string{"Hauptgerichte"}, []string{"Spargel", "Kartoffeln", "Butter", "Ei"}, []string{"vegetarisch", "glutenfrei"}, true},
+	{"Kaiserschmarrn", "Mit Apfelmus und Puderzucker", 990,
+		[]string{"Desserts"}, []string{"Mehl", "Ei", "Milch", "Rosinen", "Äpfel"}, []string{"vegetarisch"}, false},
+	{"Apfelstrudel", "Warm, mit Vanillesoße", 790,
+		[]string{"Desserts"}, []string{"Äpfel", "Mehl", "Zimt", "Vanille"}, []string{"vegetarisch"}, false},
+	{"Zwetschgendatschi", "Hausgemacht, mit Sahne", 590,
+		[]string{"Desserts"}, []string{"Zwetschgen", "Mehl", "Butter", "Sahne"}, []string{"vegetarisch"}, true},
+}
+
+// seedCommand loads the sample menu and creates an admin user. Items and
+// users that already exist are left alone, so it can run more than once.
+func seedCommand(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	adminEmail := flags.String("admin-email", "admin@gasthaus.local", "email of the admin user")
+	adminPassword := flags.String("admin-password", "", "password of the admin user; a random one is printed if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	dbpool, err := internal.SetupDB(cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer dbpool.Close()
+	ctx := context.Background()
+
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	inserted := 0
+	for _, item := range sampleMenu {
+		var exists bool
+		err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM speisekarte WHERE name = $1 AND deleted_at IS NULL)`, item.name).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to look up %s: %w", item.name, err)
+		}
+		if exists {
+			continue
+		}
+		_, err = tx.Exec(ctx,
+			`INSERT INTO speisekarte (name, description, price_cents, categories, ingredients, tags, seasonal)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			item.name, item.description, item.priceCents, item.categories, item.ingredients, item.tags, item.seasonal)
+		if err != nil {
+			return fmt.Errorf("failed to insert %s: %w", item.name, err)
+		}
+		inserted++
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	fmt.Printf("Menu: %d of %d sample items added.\n", inserted, len(sampleMenu))
+
+	password := *adminPassword
+	if password == "" {
+		raw := make([]byte, 12)
+		rand.Read(raw)
+		password = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	_, err = createUser(ctx, dbpool, *adminEmail, password)
+	switch {
+	case errors.Is(err, errUserExists):
+		fmt.Printf("Admin: %s already exists.\n", *adminEmail)
+	case err != nil:
+		return err
+	case *adminPassword == "":
+		fmt.Printf("Admin: %s created with password %s\n", *adminEmail, password)
+	default:
+		fmt.Printf("Admin: %s created.\n", *adminEmail)
+	}
+	return nil
+}
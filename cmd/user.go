@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gomisroca/gasthaus-backend/internal"
+	"github.com/gomisroca/gasthaus-backend/internal/config"
+	"github.com/gomisroca/gasthaus-backend/internal/validate"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func userCommand(cfg *config.Config, args []string) error {
+	if len(args) != 2 || args[0] != "create" {
+		return errors.New("usage: user create EMAIL")
+	}
+	email := args[1]
+
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "Password: ")
+	}
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	dbpool, err := internal.SetupDB(cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer dbpool.Close()
+
+	id, err := createUser(context.Background(), dbpool, email, password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created user %s (%s)\n", email, id)
+	return nil
+}
+
+// errUserExists is returned by createUser if the email is taken.
+var errUserExists = errors.New("a user with this email already exists")
+
+// createUser checks email and password against the login rules and stores
+// the user with a bcrypt hash of the password.
+func createUser(ctx context.Context, dbpool *pgxpool.Pool, email, password string) (string, error) {
+	v := validate.New()
+	v.String("email", &email, validate.Trim, validate.Required, validate.MaxLength(254), validate.Email)
+	v.String("password", &password, validate.Required, validate.MaxBytes(72))
+	if errs := v.Errors(); len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for i, e := range errs {
+			messages[i] = e.Message
+		}
+		return "", errors.New(strings.Join(messages, "; "))
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	var id string
+	err = dbpool.QueryRow(ctx,
+		`INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING id`, email, string(hash)).Scan(&id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return "", errUserExists
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create user: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.audit_log;
+DROP FUNCTION IF EXISTS public.reject_modification();
@@ -0,0 +1,28 @@
+CREATE TABLE public.audit_log (
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  actor_id VARCHAR,
+  action VARCHAR NOT NULL,
+  entity_type VARCHAR NOT NULL,
+  entity_id VARCHAR NOT NULL,
+  client_ip VARCHAR,
+  diff JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX audit_log_created_at_idx ON public.audit_log (created_at DESC);
+CREATE INDEX audit_log_entity_idx ON public.audit_log (entity_type, entity_id);
+CREATE INDEX audit_log_actor_idx ON public.audit_log (actor_id);
+
+CREATE OR REPLACE FUNCTION public.reject_modification() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+  BEFORE UPDATE OR DELETE ON public.audit_log
+  FOR EACH ROW EXECUTE FUNCTION public.reject_modification();
+
+CREATE TRIGGER audit_log_no_truncate
+  BEFORE TRUNCATE ON public.audit_log
+  FOR EACH STATEMENT EXECUTE FUNCTION public.reject_modification();
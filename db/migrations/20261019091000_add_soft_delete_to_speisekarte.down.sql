@@ -0,0 +1,10 @@
+DELETE FROM public.speisekarte WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS public.speisekarte_deleted_at_idx;
+DROP INDEX IF EXISTS public.speisekarte_active_name_key;
+
+ALTER TABLE public.speisekarte
+  ADD CONSTRAINT unique_item_name UNIQUE (name);
+
+ALTER TABLE public.speisekarte
+  DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,14 @@
+ALTER TABLE public.speisekarte
+  ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Trashed items must not block reusing their name.
+ALTER TABLE public.speisekarte
+  DROP CONSTRAINT IF EXISTS unique_item_name;
+
+CREATE UNIQUE INDEX speisekarte_active_name_key
+  ON public.speisekarte (name)
+  WHERE deleted_at IS NULL;
+
+CREATE INDEX speisekarte_deleted_at_idx
+  ON public.speisekarte (deleted_at)
+  WHERE deleted_at IS NOT NULL;
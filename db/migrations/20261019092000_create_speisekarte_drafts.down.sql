@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.speisekarte_drafts;
+DROP TABLE IF EXISTS public.speisekarte_publications;
@@ -0,0 +1,40 @@
+CREATE TABLE public.speisekarte_publications (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  created_by VARCHAR,
+  publish_at TIMESTAMPTZ NOT NULL,
+  published_at TIMESTAMPTZ,
+  status VARCHAR NOT NULL DEFAULT 'scheduled'
+    CHECK (status IN ('scheduled', 'published', 'cancelled', 'failed')),
+  error VARCHAR
+);
+
+CREATE INDEX speisekarte_publications_due_idx
+  ON public.speisekarte_publications (publish_at)
+  WHERE status = 'scheduled';
+
+CREATE TABLE public.speisekarte_drafts (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  item_id UUID REFERENCES public.speisekarte (id) ON DELETE CASCADE,
+  action VARCHAR NOT NULL DEFAULT 'upsert' CHECK (action IN ('upsert', 'delete')),
+  name VARCHAR NOT NULL,
+  description VARCHAR,
+  price_cents INTEGER NOT NULL DEFAULT 0,
+  categories VARCHAR[],
+  ingredients TEXT[] NOT NULL DEFAULT '{}',
+  tags VARCHAR[],
+  image VARCHAR,
+  seasonal BOOLEAN NOT NULL DEFAULT false,
+  publication_id UUID REFERENCES public.speisekarte_publications (id) ON DELETE SET NULL,
+  created_by VARCHAR,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- At most one pending change per live item.
+CREATE UNIQUE INDEX speisekarte_drafts_item_key
+  ON public.speisekarte_drafts (item_id)
+  WHERE item_id IS NOT NULL;
+
+CREATE INDEX speisekarte_drafts_publication_idx
+  ON public.speisekarte_drafts (publication_id);
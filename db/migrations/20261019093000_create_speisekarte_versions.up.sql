@@ -0,0 +1,20 @@
+CREATE TABLE public.speisekarte_versions (
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  created_by VARCHAR,
+  reason VARCHAR NOT NULL,
+  label VARCHAR,
+  item_count INTEGER NOT NULL,
+  items JSONB NOT NULL
+);
+
+CREATE INDEX speisekarte_versions_created_at_idx ON public.speisekarte_versions (created_at DESC);
+
+-- Snapshots are immutable once taken.
+CREATE TRIGGER speisekarte_versions_immutable
+  BEFORE UPDATE OR DELETE ON public.speisekarte_versions
+  FOR EACH ROW EXECUTE FUNCTION public.reject_modification();
+
+CREATE TRIGGER speisekarte_versions_no_truncate
+  BEFORE TRUNCATE ON public.speisekarte_versions
+  FOR EACH STATEMENT EXECUTE FUNCTION public.reject_modification();
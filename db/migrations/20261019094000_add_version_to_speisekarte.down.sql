@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS speisekarte_bump_version ON public.speisekarte;
+DROP FUNCTION IF EXISTS public.speisekarte_bump_version();
+
+ALTER TABLE public.speisekarte
+  DROP COLUMN IF EXISTS version;
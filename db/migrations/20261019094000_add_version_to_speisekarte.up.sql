@@ -0,0 +1,14 @@
+ALTER TABLE public.speisekarte
+  ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- Every write bumps the version so clients can detect concurrent edits.
+CREATE OR REPLACE FUNCTION public.speisekarte_bump_version() RETURNS trigger AS $$
+BEGIN
+  NEW.version := OLD.version + 1;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER speisekarte_bump_version
+  BEFORE UPDATE ON public.speisekarte
+  FOR EACH ROW EXECUTE FUNCTION public.speisekarte_bump_version();
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS speisekarte_bump_menu_state ON public.speisekarte;
+DROP FUNCTION IF EXISTS public.bump_menu_state();
+DROP TABLE IF EXISTS public.menu_state;
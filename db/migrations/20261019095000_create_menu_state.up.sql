@@ -0,0 +1,20 @@
+-- A single row whose version changes whenever the menu does, so public
+-- responses can be validated without comparing item timestamps.
+CREATE TABLE public.menu_state (
+  id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+  version BIGINT NOT NULL DEFAULT 1,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO public.menu_state (id) VALUES (true);
+
+CREATE OR REPLACE FUNCTION public.bump_menu_state() RETURNS trigger AS $$
+BEGIN
+  UPDATE public.menu_state SET version = version + 1, updated_at = clock_timestamp();
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER speisekarte_bump_menu_state
+  AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON public.speisekarte
+  FOR EACH STATEMENT EXECUTE FUNCTION public.bump_menu_state();
@@ -0,0 +1,6 @@
+CREATE OR REPLACE FUNCTION public.bump_menu_state() RETURNS trigger AS $$
+BEGIN
+  UPDATE public.menu_state SET version = version + 1, updated_at = clock_timestamp();
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
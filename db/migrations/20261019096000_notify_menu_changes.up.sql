@@ -0,0 +1,12 @@
+-- Announce every menu change so other instances can drop their caches.
+-- Notifications are only delivered once the writing transaction commits.
+CREATE OR REPLACE FUNCTION public.bump_menu_state() RETURNS trigger AS $$
+DECLARE
+  new_version BIGINT;
+BEGIN
+  UPDATE public.menu_state SET version = version + 1, updated_at = clock_timestamp()
+    RETURNING version INTO new_version;
+  PERFORM pg_notify('menu_changed', new_version::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
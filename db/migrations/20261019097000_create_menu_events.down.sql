@@ -0,0 +1,17 @@
+CREATE OR REPLACE FUNCTION public.bump_menu_state() RETURNS trigger AS $$
+DECLARE
+  new_version BIGINT;
+BEGIN
+  UPDATE public.menu_state SET version = version + 1, updated_at = clock_timestamp()
+    RETURNING version INTO new_version;
+  PERFORM pg_notify('menu_changed', new_version::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS speisekarte_record_menu_event ON public.speisekarte;
+DROP FUNCTION IF EXISTS public.record_menu_item_event();
+DROP FUNCTION IF EXISTS public.add_menu_event(TEXT, TEXT, JSONB);
+ALTER TABLE public.menu_state DROP COLUMN IF EXISTS categories;
+DROP TABLE IF EXISTS public.menu_events;
+ALTER TABLE public.speisekarte DROP COLUMN IF EXISTS available;
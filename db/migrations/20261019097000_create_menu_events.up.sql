@@ -0,0 +1,86 @@
+-- Whether an item can currently be ordered. Sold-out items stay on the menu.
+ALTER TABLE public.speisekarte ADD COLUMN available BOOLEAN NOT NULL DEFAULT true;
+
+-- Menu change events for live clients. Rows are written by triggers in the
+-- same transaction as the change, so every write path is covered.
+CREATE TABLE public.menu_events (
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  type TEXT NOT NULL,
+  item_id TEXT,
+  data JSONB NOT NULL
+);
+
+CREATE INDEX menu_events_created_at_idx ON public.menu_events (created_at);
+
+ALTER TABLE public.menu_state ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}';
+UPDATE public.menu_state SET categories = ARRAY(
+  SELECT DISTINCT unnest(categories) FROM public.speisekarte WHERE deleted_at IS NULL ORDER BY 1
+);
+
+-- Events are numbered while menu_state is locked, which every menu write
+-- holds until it commits, so event ids are assigned in commit order and
+-- readers can resume from the last id they saw.
+CREATE OR REPLACE FUNCTION public.add_menu_event(event_type TEXT, event_item_id TEXT, event_data JSONB) RETURNS void AS $$
+BEGIN
+  PERFORM 1 FROM public.menu_state FOR UPDATE;
+  INSERT INTO public.menu_events (type, item_id, data) VALUES (event_type, event_item_id, event_data);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION public.record_menu_item_event() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    IF NEW.deleted_at IS NULL THEN
+      PERFORM public.add_menu_event('item.created', NEW.id, to_jsonb(NEW));
+    END IF;
+  ELSIF TG_OP = 'DELETE' THEN
+    IF OLD.deleted_at IS NULL THEN
+      PERFORM public.add_menu_event('item.deleted', OLD.id, jsonb_build_object('id', OLD.id));
+    END IF;
+  ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+    PERFORM public.add_menu_event('item.deleted', NEW.id, jsonb_build_object('id', NEW.id));
+  ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+    PERFORM public.add_menu_event('item.created', NEW.id, to_jsonb(NEW));
+  ELSIF NEW.deleted_at IS NULL THEN
+    IF OLD.available IS DISTINCT FROM NEW.available THEN
+      PERFORM public.add_menu_event('item.availability_changed', NEW.id,
+        jsonb_build_object('id', NEW.id, 'available', NEW.available));
+    END IF;
+    IF (to_jsonb(OLD) - ARRAY['available', 'updated_at', 'version'])
+        IS DISTINCT FROM (to_jsonb(NEW) - ARRAY['available', 'updated_at', 'version']) THEN
+      PERFORM public.add_menu_event('item.updated', NEW.id, to_jsonb(NEW));
+    END IF;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER speisekarte_record_menu_event
+  AFTER INSERT OR UPDATE OR DELETE ON public.speisekarte
+  FOR EACH ROW EXECUTE FUNCTION public.record_menu_item_event();
+
+-- Runs after the row triggers of each statement, so it also detects when
+-- the set of active categories changed.
+CREATE OR REPLACE FUNCTION public.bump_menu_state() RETURNS trigger AS $$
+DECLARE
+  new_version BIGINT;
+  old_categories TEXT[];
+  new_categories TEXT[];
+BEGIN
+  SELECT categories INTO old_categories FROM public.menu_state FOR UPDATE;
+  new_categories := ARRAY(
+    SELECT DISTINCT unnest(categories) FROM public.speisekarte WHERE deleted_at IS NULL ORDER BY 1
+  );
+  IF new_categories IS DISTINCT FROM old_categories THEN
+    PERFORM public.add_menu_event('categories.changed', NULL,
+      jsonb_build_object('categories', to_jsonb(new_categories)));
+  END IF;
+
+  UPDATE public.menu_state
+    SET version = version + 1, updated_at = clock_timestamp(), categories = new_categories
+    RETURNING version INTO new_version;
+  PERFORM pg_notify('menu_changed', new_version::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
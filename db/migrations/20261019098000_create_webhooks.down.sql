@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS menu_events_enqueue_webhooks ON public.menu_events;
+DROP FUNCTION IF EXISTS public.enqueue_webhook_deliveries();
+DROP TABLE IF EXISTS public.webhook_deliveries;
+DROP TABLE IF EXISTS public.webhook_subscriptions;
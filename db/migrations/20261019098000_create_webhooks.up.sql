@@ -0,0 +1,58 @@
+CREATE TABLE public.webhook_subscriptions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  url VARCHAR NOT NULL,
+  secret VARCHAR NOT NULL,
+  event_types TEXT[] NOT NULL,
+  description VARCHAR,
+  active BOOLEAN NOT NULL DEFAULT true,
+  created_by VARCHAR,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The delivery queue and log. Rows stay after delivery so failures can be
+-- inspected and redelivered.
+CREATE TABLE public.webhook_deliveries (
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  subscription_id UUID NOT NULL REFERENCES public.webhook_subscriptions (id) ON DELETE CASCADE,
+  event_id BIGINT,
+  event_type TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  status VARCHAR NOT NULL DEFAULT 'pending'
+    CHECK (status IN ('pending', 'succeeded', 'dead')),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_attempt_at TIMESTAMPTZ,
+  response_status INTEGER,
+  last_error VARCHAR,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX webhook_deliveries_due_idx
+  ON public.webhook_deliveries (next_attempt_at)
+  WHERE status = 'pending';
+
+CREATE INDEX webhook_deliveries_subscription_idx
+  ON public.webhook_deliveries (subscription_id, id DESC);
+
+-- Queue a delivery for every matching subscription in the same transaction
+-- as the menu change, so no event is lost between commit and dispatch.
+CREATE OR REPLACE FUNCTION public.enqueue_webhook_deliveries() RETURNS trigger AS $$
+BEGIN
+  INSERT INTO public.webhook_deliveries (subscription_id, event_id, event_type, payload)
+  SELECT s.id, NEW.id, NEW.type, jsonb_build_object(
+      'event_id', NEW.id,
+      'type', NEW.type,
+      'item_id', NEW.item_id,
+      'created_at', NEW.created_at,
+      'data', NEW.data)
+  FROM public.webhook_subscriptions s
+  WHERE s.active AND (NEW.type = ANY (s.event_types) OR '*' = ANY (s.event_types));
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER menu_events_enqueue_webhooks
+  AFTER INSERT ON public.menu_events
+  FOR EACH ROW EXECUTE FUNCTION public.enqueue_webhook_deliveries();
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS public.speisekarte_name_trgm_idx;
+DROP INDEX IF EXISTS public.speisekarte_search_idx;
+DROP FUNCTION IF EXISTS public.speisekarte_search_vector(TEXT, TEXT, TEXT[], TEXT[]);
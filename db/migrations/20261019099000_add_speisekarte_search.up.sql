@@ -0,0 +1,22 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- array_to_string is only STABLE, so the search document is built by an
+-- IMMUTABLE wrapper that can back an expression index. Name matches weigh
+-- most, then ingredients and tags, then the description.
+CREATE OR REPLACE FUNCTION public.speisekarte_search_vector(
+  name TEXT, description TEXT, ingredients TEXT[], tags TEXT[]
+) RETURNS tsvector AS $$
+  SELECT setweight(to_tsvector('german', coalesce(name, '')), 'A')
+      || setweight(to_tsvector('german', coalesce(array_to_string(ingredients, ' '), '')), 'B')
+      || setweight(to_tsvector('german', coalesce(array_to_string(tags, ' '), '')), 'B')
+      || setweight(to_tsvector('german', coalesce(description, '')), 'C')
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+
+CREATE INDEX speisekarte_search_idx ON public.speisekarte
+  USING GIN (public.speisekarte_search_vector(name, description, ingredients, tags))
+  WHERE deleted_at IS NULL;
+
+-- Trigram index for misspelled names.
+CREATE INDEX speisekarte_name_trgm_idx ON public.speisekarte
+  USING GIN (name gin_trgm_ops)
+  WHERE deleted_at IS NULL;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS public.speisekarte_created_at_idx;
+DROP INDEX IF EXISTS public.speisekarte_price_idx;
+DROP INDEX IF EXISTS public.speisekarte_position_idx;
+DROP TRIGGER IF EXISTS speisekarte_set_position ON public.speisekarte;
+DROP FUNCTION IF EXISTS public.set_speisekarte_position();
+ALTER TABLE public.speisekarte DROP COLUMN IF EXISTS position;
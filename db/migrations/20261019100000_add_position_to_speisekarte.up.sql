@@ -0,0 +1,27 @@
+-- Manual display order. Existing items keep their alphabetical order and
+-- new items are appended at the end.
+ALTER TABLE public.speisekarte ADD COLUMN position INTEGER;
+
+UPDATE public.speisekarte s SET position = ordered.n
+FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY name, id) AS n FROM public.speisekarte) ordered
+WHERE s.id = ordered.id;
+
+ALTER TABLE public.speisekarte ALTER COLUMN position SET NOT NULL;
+
+CREATE OR REPLACE FUNCTION public.set_speisekarte_position() RETURNS trigger AS $$
+BEGIN
+  IF NEW.position IS NULL THEN
+    SELECT COALESCE(MAX(position), 0) + 1 INTO NEW.position FROM public.speisekarte;
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER speisekarte_set_position
+  BEFORE INSERT ON public.speisekarte
+  FOR EACH ROW EXECUTE FUNCTION public.set_speisekarte_position();
+
+-- Indexes for the keyset pagination sort orders of GET /speisekarte/.
+CREATE INDEX speisekarte_position_idx ON public.speisekarte (position, id) WHERE deleted_at IS NULL;
+CREATE INDEX speisekarte_price_idx ON public.speisekarte (price_cents, id) WHERE deleted_at IS NULL;
+CREATE INDEX speisekarte_created_at_idx ON public.speisekarte (created_at, id) WHERE deleted_at IS NULL;
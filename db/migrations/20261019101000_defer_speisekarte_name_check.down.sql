@@ -0,0 +1,5 @@
+ALTER TABLE public.speisekarte DROP CONSTRAINT IF EXISTS speisekarte_active_name_key;
+
+CREATE UNIQUE INDEX speisekarte_active_name_key
+  ON public.speisekarte (name)
+  WHERE deleted_at IS NULL;
@@ -0,0 +1,9 @@
+-- Live item names stay unique, but the check can be deferred to commit so
+-- that an import or a rollback can swap the names of two items. Unique
+-- indexes cannot be deferred, exclusion constraints can.
+DROP INDEX public.speisekarte_active_name_key;
+
+ALTER TABLE public.speisekarte
+  ADD CONSTRAINT speisekarte_active_name_key
+  EXCLUDE USING btree (name WITH =) WHERE (deleted_at IS NULL)
+  DEFERRABLE INITIALLY IMMEDIATE;
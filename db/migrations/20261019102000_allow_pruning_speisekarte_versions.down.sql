@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS speisekarte_versions_pruned_only ON public.speisekarte_versions;
+DROP FUNCTION IF EXISTS public.reject_unpruned_delete();
+DROP TRIGGER IF EXISTS speisekarte_versions_immutable ON public.speisekarte_versions;
+
+CREATE TRIGGER speisekarte_versions_immutable
+  BEFORE UPDATE OR DELETE ON public.speisekarte_versions
+  FOR EACH ROW EXECUTE FUNCTION public.reject_modification();
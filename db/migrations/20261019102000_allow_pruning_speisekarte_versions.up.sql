@@ -0,0 +1,21 @@
+-- Snapshots still cannot be edited, but the oldest are deleted so the table
+-- does not grow without bound; see MENU_VERSIONS_KEPT. Only the pruner may
+-- delete them: it sets gasthaus.prune_versions for its transaction.
+CREATE OR REPLACE FUNCTION public.reject_unpruned_delete() RETURNS trigger AS $$
+BEGIN
+  IF current_setting('gasthaus.prune_versions', true) IS DISTINCT FROM 'on' THEN
+    RAISE EXCEPTION '% rows are only deleted by the version pruner', TG_TABLE_NAME;
+  END IF;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER speisekarte_versions_immutable ON public.speisekarte_versions;
+
+CREATE TRIGGER speisekarte_versions_immutable
+  BEFORE UPDATE ON public.speisekarte_versions
+  FOR EACH ROW EXECUTE FUNCTION public.reject_modification();
+
+CREATE TRIGGER speisekarte_versions_pruned_only
+  BEFORE DELETE ON public.speisekarte_versions
+  FOR EACH ROW EXECUTE FUNCTION public.reject_unpruned_delete();
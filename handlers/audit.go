@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/clientip"
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/middleware"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// Fields that change on every write and would only add noise to a diff.
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true,
+	"version":    true,
+}
+
+type AuditHandler struct {
+	DB *pgxpool.Pool
+}
+
+// auditActor identifies who made a change. Both fields are empty for changes
+// made by the server itself, such as scheduled maintenance.
+type auditActor struct {
+	UserID   string
+	ClientIP string
+}
+
+type auditListResponse struct {
+	Entries []models.AuditEntry `json:"entries"`
+	Total   int                 `json:"total"`
+	Limit   int                 `json:"limit"`
+	Offset  int                 `json:"offset"`
+}
+
+func actorFromRequest(r *http.Request) auditActor {
+	userID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	return auditActor{UserID: userID, ClientIP: clientip.FromRequest(r)}
+}
+
+// recordAudit appends an entry to the audit log inside tx, so the entry is
+// only persisted if the change it describes is committed. before and after
+// are the entity before and after the change; either may be nil.
+func recordAudit(ctx context.Context, tx pgx.Tx, actor auditActor, action, entityType, entityID string, before, after any) error {
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		return fmt.Errorf("failed to build audit diff: %w", err)
+	}
+
+	var actorID, ip *string
+	if actor.UserID != "" {
+		actorID = &actor.UserID
+	}
+	if actor.ClientIP != "" {
+		ip = &actor.ClientIP
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO audit_log (actor_id, action, entity_type, entity_id, client_ip, diff)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		actorID, action, entityType, entityID, ip, diff,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// auditDiff returns the fields that differ between before and after as a JSON
+// object of {"field": {"old": ..., "new": ...}}.
+func auditDiff(before, after any) ([]byte, error) {
+	changes, err := diffFields(before, after)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(changes)
+}
+
+// diffFields compares the JSON representations of before and after and
+// returns the fields that differ. Either side may be nil.
+func diffFields(before, after any) (map[string]models.FieldChange, error) {
+	oldFields, err := toFieldMap(before)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := toFieldMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]models.FieldChange)
+	for key, oldValue := range oldFields {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		newValue, ok := newFields[key]
+		if !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes[key] = models.FieldChange{Old: oldValue, New: newValue}
+		}
+	}
+	for key, newValue := range newFields {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		if _, ok := oldFields[key]; !ok {
+			changes[key] = models.FieldChange{Old: nil, New: newValue}
+		}
+	}
+	return changes, nil
+}
+
+func toFieldMap(v any) (map[string]any, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil()) {
+		return map[string]any{}, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]any)
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func (h *AuditHandler) ListEntries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := defaultAuditPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_limit", "Invalid limit")
+			return
+		}
+		limit = min(n, maxAuditPageSize)
+	}
+
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_offset", "Invalid offset")
+			return
+		}
+		offset = n
+	}
+
+	var conditions []string
+	var args []any
+	addCondition := func(clause string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	for param, column := range map[string]string{
+		"actor_id":    "actor_id",
+		"action":      "action",
+		"entity_type": "entity_type",
+		"entity_id":   "entity_id",
+	} {
+		if v := q.Get(param); v != "" {
+			addCondition(column+" = $%d", v)
+		}
+	}
+	for param, clause := range map[string]string{
+		"since": "created_at >= $%d",
+		"until": "created_at < $%d",
+	} {
+		if v := q.Get(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				problem.Write(w, r, problem.Validation(
+					problem.Field(param, "invalid", param+" must be an RFC 3339 timestamp")))
+				return
+			}
+			addCondition(clause, t)
+		}
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := h.DB.QueryRow(r.Context(), "SELECT COUNT(*) FROM audit_log "+where, args...).Scan(&total); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to count audit entries", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, created_at, actor_id, action, entity_type, entity_id, client_ip, diff
+		FROM audit_log
+		%s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+
+	rows, err := h.DB.Query(r.Context(), query, append(args, limit, offset)...)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Database query failed", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.ActorID,
+			&entry.Action,
+			&entry.EntityType,
+			&entry.EntityID,
+			&entry.ClientIP,
+			&entry.Diff,
+		); err != nil {
+			logging.FromContext(r.Context()).Error("Row scan failed", "err", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		logging.FromContext(r.Context()).Error("Row iteration error", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(auditListResponse{
+		Entries: entries,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding audit response", "err", err)
+	}
+}
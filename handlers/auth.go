@@ -2,19 +2,26 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/internal/validate"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
-	DB        *pgxpool.Pool
 	JWTSecret string
+
+	users userStore
+}
+
+func NewAuthHandler(db *pgxpool.Pool, jwtSecret string) *AuthHandler {
+	return &AuthHandler{JWTSecret: jwtSecret, users: pgxUserStore{db: db}}
 }
 
 type loginRequest struct {
@@ -28,49 +35,53 @@ type loginResponse struct {
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req loginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := validate.DecodeJSON(r.Body, &req); err != nil {
+		writeBodyError(w, r, err)
 		return
 	}
 
-	if req.Email == "" || req.Password == "" {
-		http.Error(w, "Email and password are required", http.StatusBadRequest)
+	// Passwords are not trimmed; bcrypt only reads the first 72 bytes.
+	v := validate.New()
+	v.String("email", &req.Email, validate.Trim, validate.Required, validate.MaxLength(254), validate.Email)
+	v.String("password", &req.Password, validate.Required, validate.MaxBytes(72))
+	if err := v.Err(); err != nil {
+		problem.WriteError(w, r, err)
 		return
 	}
 
-	var user models.User
-	err := h.DB.QueryRow(
-		r.Context(),
-		"SELECT id, email, password_hash FROM users WHERE email=$1",
-		req.Email,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash)
+	user, err := h.users.userByEmail(r.Context(), req.Email)
+	if errors.Is(err, errNotFound) {
+		problem.Error(w, r, http.StatusUnauthorized, "invalid_email_or_password", "Invalid email or password")
+		return
+	}
 	if err != nil {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		logging.FromContext(r.Context()).Error("Error fetching user", "err", err)
+		problem.Internal(w, r)
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		problem.Error(w, r, http.StatusUnauthorized, "invalid_email_or_password", "Invalid email or password")
 		return
 	}
 
 	tokenString, err := h.mintToken(user.ID, 24*time.Hour)
 	if err != nil {
-		log.Printf("Error signing token: %v", err)
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("Error signing token", "err", err)
+		problem.Internal(w, r)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(loginResponse{Token: tokenString}); err != nil {
-		log.Printf("Error encoding login response: %v", err)
+		logging.FromContext(r.Context()).Error("Error encoding login response", "err", err)
 	}
 }
 
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	tokenStr := r.URL.Query().Get("token")
 	if tokenStr == "" {
-		http.Error(w, "Token is required", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "missing_token", "Token is required")
 		return
 	}
 
@@ -81,32 +92,32 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return []byte(h.JWTSecret), nil
 	})
 	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		problem.Error(w, r, http.StatusUnauthorized, "invalid_token", "Invalid token")
 		return
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		problem.Error(w, r, http.StatusUnauthorized, "invalid_token_claims", "Invalid token claims")
 		return
 	}
 
 	userID, ok := claims["sub"].(string)
 	if !ok || userID == "" {
-		http.Error(w, "Invalid token subject", http.StatusUnauthorized)
+		problem.Error(w, r, http.StatusUnauthorized, "invalid_token_subject", "Invalid token subject")
 		return
 	}
 
 	newTokenString, err := h.mintToken(userID, 24*time.Hour)
 	if err != nil {
-		log.Printf("Error signing refreshed token: %v", err)
-		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("Error signing refreshed token", "err", err)
+		problem.Internal(w, r)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(loginResponse{Token: newTokenString}); err != nil {
-		log.Printf("Error encoding refresh response: %v", err)
+		logging.FromContext(r.Context()).Error("Error encoding refresh response", "err", err)
 	}
 }
 
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testJWTSecret = "test-secret"
+
+func signTestToken(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// tokenSubject checks that the response carries a token signed with
+// testJWTSecret and returns its subject.
+func tokenSubject(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp loginResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v; body: %s", err, rec.Body)
+	}
+	token, err := jwt.Parse(resp.Token, func(*jwt.Token) (any, error) { return []byte(testJWTSecret), nil })
+	if err != nil {
+		t.Fatalf("invalid token: %v", err)
+	}
+	sub, _ := token.Claims.GetSubject()
+	return sub
+}
+
+func TestAuthHandler(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		handler func(*AuthHandler, http.ResponseWriter, *http.Request)
+		method  string
+		target  string
+		body    string
+		// fail makes the store return an error.
+		fail bool
+
+		wantStatus int
+		wantCode   string
+		wantSub    string
+	}{
+		{
+			name: "login", handler: (*AuthHandler).Login, method: "POST", target: "/auth/login",
+			body:       `{"email": " wirt@example.com ", "password": "correct horse"}`,
+			wantStatus: http.StatusOK, wantSub: "user-1",
+		},
+		{
+			name: "wrong password", handler: (*AuthHandler).Login, method: "POST", target: "/auth/login",
+			body:       `{"email": "wirt@example.com", "password": "wrong horse"}`,
+			wantStatus: http.StatusUnauthorized, wantCode: "invalid_email_or_password",
+		},
+		{
+			name: "unknown email", handler: (*AuthHandler).Login, method: "POST", target: "/auth/login",
+			body:       `{"email": "gast@example.com", "password": "correct horse"}`,
+			wantStatus: http.StatusUnauthorized, wantCode: "invalid_email_or_password",
+		},
+		{
+			name: "invalid email", handler: (*AuthHandler).Login, method: "POST", target: "/auth/login",
+			body:       `{"email": "wirt", "password": "correct horse"}`,
+			wantStatus: http.StatusBadRequest, wantCode: "validation_failed",
+		},
+		{
+			name: "empty body", handler: (*AuthHandler).Login, method: "POST", target: "/auth/login",
+			wantStatus: http.StatusBadRequest, wantCode: "invalid_request_body",
+		},
+		{
+			name: "store failure", handler: (*AuthHandler).Login, method: "POST", target: "/auth/login",
+			body:       `{"email": "wirt@example.com", "password": "correct horse"}`,
+			fail:       true,
+			wantStatus: http.StatusInternalServerError, wantCode: "internal_error",
+		},
+		{
+			name: "refresh", handler: (*AuthHandler).RefreshToken, method: "GET",
+			target:     "/auth/refresh-token?token=" + signTestToken(t, testJWTSecret, jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}),
+			wantStatus: http.StatusOK, wantSub: "user-1",
+		},
+		{
+			name: "refresh without token", handler: (*AuthHandler).RefreshToken, method: "GET", target: "/auth/refresh-token",
+			wantStatus: http.StatusBadRequest, wantCode: "missing_token",
+		},
+		{
+			name: "refresh with foreign token", handler: (*AuthHandler).RefreshToken, method: "GET",
+			target:     "/auth/refresh-token?token=" + signTestToken(t, "other-secret", jwt.MapClaims{"sub": "user-1"}),
+			wantStatus: http.StatusUnauthorized, wantCode: "invalid_token",
+		},
+		{
+			name: "refresh with expired token", handler: (*AuthHandler).RefreshToken, method: "GET",
+			target:     "/auth/refresh-token?token=" + signTestToken(t, testJWTSecret, jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(-time.Hour).Unix()}),
+			wantStatus: http.StatusUnauthorized, wantCode: "invalid_token",
+		},
+		{
+			name: "refresh without subject", handler: (*AuthHandler).RefreshToken, method: "GET",
+			target:     "/auth/refresh-token?token=" + signTestToken(t, testJWTSecret, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}),
+			wantStatus: http.StatusUnauthorized, wantCode: "invalid_token_subject",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			store.users["wirt@example.com"] = models.User{ID: "user-1", Email: "wirt@example.com", PasswordHash: string(hash)}
+			if tt.fail {
+				store.err = errors.New("connection refused")
+			}
+			h := &AuthHandler{JWTSecret: testJWTSecret, users: store}
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			tt.handler(h, rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantCode != "" {
+				var p struct {
+					Code string `json:"code"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil || p.Code != tt.wantCode {
+					t.Fatalf("problem code = %q, want %q; body: %s", p.Code, tt.wantCode, rec.Body)
+				}
+			}
+			if tt.wantSub != "" {
+				if sub := tokenSubject(t, rec); sub != tt.wantSub {
+					t.Errorf("token subject = %q, want %q", sub, tt.wantSub)
+				}
+			}
+		})
+	}
+}
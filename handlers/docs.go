@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gomisroca/gasthaus-backend/api"
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+)
+
+// OpenAPISpec serves the OpenAPI 3.1 description of this API.
+func OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(api.Spec); err != nil {
+		logging.FromContext(r.Context()).Error("Error writing OpenAPI spec", "err", err)
+	}
+}
+
+// APIDocs serves an interactive documentation page for OpenAPISpec.
+func APIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(api.DocsPage); err != nil {
+		logging.FromContext(r.Context()).Error("Error writing API docs", "err", err)
+	}
+}
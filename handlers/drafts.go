@@ -0,0 +1,873 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/internal/validate"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	draftColumns       = `id, item_id, action, name, description, price_cents, categories, ingredients, tags, image, seasonal, publication_id, created_by, created_at, updated_at`
+	publicationColumns = `id, created_at, created_by, publish_at, published_at, status, error`
+
+	auditEntityDraft       = "speisekarte_draft"
+	auditEntityPublication = "speisekarte_publication"
+)
+
+// errDraftTargetGone is returned when a draft edits an item that has been
+// deleted since the draft was saved.
+var errDraftTargetGone = errors.New("draft targets an item that no longer exists")
+
+type publishRequest struct {
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+type publishResponse struct {
+	Published int `json:"published"`
+}
+
+// previewItem is an item as it will look once all pending drafts are
+// published. DraftID is set when a draft changes the item; items that a
+// draft creates have the draft's id.
+type previewItem struct {
+	models.SpeisekarteItem
+	DraftID *string `json:"draft_id,omitempty"`
+}
+
+func scanDraft(row pgx.Row, draft *models.SpeisekarteDraft) error {
+	return row.Scan(
+		&draft.ID,
+		&draft.ItemID,
+		&draft.Action,
+		&draft.Name,
+		&draft.Description,
+		&draft.PriceCents,
+		&draft.Categories,
+		&draft.Ingredients,
+		&draft.Tags,
+		&draft.Image,
+		&draft.Seasonal,
+		&draft.PublicationID,
+		&draft.CreatedBy,
+		&draft.CreatedAt,
+		&draft.UpdatedAt,
+	)
+}
+
+func scanPublication(row pgx.Row, p *models.Publication) error {
+	return row.Scan(
+		&p.ID,
+		&p.CreatedAt,
+		&p.CreatedBy,
+		&p.PublishAt,
+		&p.PublishedAt,
+		&p.Status,
+		&p.Error,
+	)
+}
+
+func draftInput(d models.SpeisekarteDraft) itemInput {
+	return itemInput{
+		Name:        d.Name,
+		Description: d.Description,
+		PriceCents:  d.PriceCents,
+		Categories:  d.Categories,
+		Ingredients: d.Ingredients,
+		Tags:        d.Tags,
+		Seasonal:    d.Seasonal,
+	}
+}
+
+func (h *SpeisekarteHandler) GetDrafts(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(r.Context(), `SELECT `+draftColumns+` FROM speisekarte_drafts ORDER BY created_at`)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Database query failed", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer rows.Close()
+
+	drafts := []models.SpeisekarteDraft{}
+	for rows.Next() {
+		var draft models.SpeisekarteDraft
+		if err := scanDraft(rows, &draft); err != nil {
+			logging.FromContext(r.Context()).Error("Row scan failed", "err", err)
+			continue
+		}
+		drafts = append(drafts, draft)
+	}
+	if err := rows.Err(); err != nil {
+		logging.FromContext(r.Context()).Error("Row iteration error", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(drafts); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding drafts response", "err", err)
+	}
+}
+
+// draftJSON is the JSON request body of SaveDraft. The item fields are only
+// read when the draft is not a deletion.
+type draftJSON struct {
+	itemJSON
+	ItemID string `json:"item_id"`
+	Action string `json:"action"`
+}
+
+// SaveDraft stores a pending change. Without item_id it drafts a new item;
+// with item_id it drafts an edit to that item, replacing any earlier draft for
+// it. action=delete drafts the item's removal. A draft that is scheduled for
+// publication cannot be replaced until the publication is cancelled.
+func (h *SpeisekarteHandler) SaveDraft(w http.ResponseWriter, r *http.Request) {
+	// JSON drafts have no image; one with an image is sent as a multipart form.
+	var body draftJSON
+	if isJSONRequest(r) {
+		if err := validate.DecodeJSON(r.Body, &body); err != nil {
+			writeBodyError(w, r, err)
+			return
+		}
+	} else {
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_form_data", "Invalid form data")
+			return
+		}
+		body.Action, body.ItemID = r.FormValue("action"), r.FormValue("item_id")
+	}
+
+	action := body.Action
+	if action == "" {
+		action = models.DraftActionUpsert
+	}
+	if action != models.DraftActionUpsert && action != models.DraftActionDelete {
+		problem.Error(w, r, http.StatusBadRequest, "invalid_draft_action", "Invalid draft action")
+		return
+	}
+
+	var itemID *string
+	if body.ItemID != "" {
+		itemID = &body.ItemID
+	}
+	if action == models.DraftActionDelete && itemID == nil {
+		problem.Error(w, r, http.StatusBadRequest, "item_id_required", "item_id is required to draft a deletion")
+		return
+	}
+
+	var in itemInput
+	if action == models.DraftActionUpsert {
+		var err error
+		if isJSONRequest(r) {
+			in, err = body.input()
+		} else {
+			in, err = parseItemForm(r)
+		}
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+	}
+
+	uploadedURL, ok := h.uploadOptionalImage(w, r)
+	if !ok {
+		return
+	}
+	saved := false
+	defer func() {
+		if !saved {
+			h.discardUpload(r, uploadedURL)
+		}
+	}()
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	image := uploadedURL
+	if itemID != nil {
+		var item models.SpeisekarteItem
+		err := scanItem(tx.QueryRow(r.Context(),
+			`SELECT `+itemColumns+` FROM speisekarte WHERE id = $1 AND deleted_at IS NULL`, *itemID), &item)
+		if err != nil {
+			if isMissingRow(err) {
+				problem.Error(w, r, http.StatusNotFound, "item_not_found", "Item not found")
+				return
+			}
+			logging.FromContext(r.Context()).Error("Failed to fetch item", "err", err)
+			problem.Internal(w, r)
+			return
+		}
+		if action == models.DraftActionDelete {
+			in = itemInputFromItem(item)
+		}
+		if image == nil {
+			image = item.Image
+		}
+	}
+
+	query := `
+		INSERT INTO speisekarte_drafts (item_id, action, name, description, price_cents, categories, ingredients, tags, image, seasonal, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (item_id) WHERE item_id IS NOT NULL DO UPDATE
+		SET action = EXCLUDED.action,
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			price_cents = EXCLUDED.price_cents,
+			categories = EXCLUDED.categories,
+			ingredients = EXCLUDED.ingredients,
+			tags = EXCLUDED.tags,
+			image = EXCLUDED.image,
+			seasonal = EXCLUDED.seasonal,
+			created_by = EXCLUDED.created_by,
+			updated_at = NOW()
+		WHERE speisekarte_drafts.publication_id IS NULL
+		RETURNING ` + draftColumns
+
+	actor := actorFromRequest(r)
+	var createdBy *string
+	if actor.UserID != "" {
+		createdBy = &actor.UserID
+	}
+
+	var draft models.SpeisekarteDraft
+	err = scanDraft(tx.QueryRow(
+		r.Context(),
+		query,
+		itemID,
+		action,
+		in.Name,
+		in.Description,
+		in.PriceCents,
+		in.Categories,
+		in.Ingredients,
+		in.Tags,
+		image,
+		in.Seasonal,
+		createdBy,
+	), &draft)
+	if err != nil {
+		// The upsert returns nothing when it skipped a scheduled draft.
+		if err == pgx.ErrNoRows {
+			writeDraftScheduled(w, r)
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to save draft", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, actor, "save", auditEntityDraft, draft.ID, nil, draft); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to record audit entry", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to commit draft", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	saved = true
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(draft); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding draft response", "err", err)
+	}
+}
+
+func (h *SpeisekarteHandler) UpdateDraft(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "missing_draft_id", "Missing draft ID")
+		return
+	}
+
+	in, err := decodeItemInput(r)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	uploadedURL, ok := h.uploadOptionalImage(w, r)
+	if !ok {
+		return
+	}
+	saved := false
+	defer func() {
+		if !saved {
+			h.discardUpload(r, uploadedURL)
+		}
+	}()
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var before models.SpeisekarteDraft
+	err = scanDraft(tx.QueryRow(r.Context(),
+		`SELECT `+draftColumns+` FROM speisekarte_drafts WHERE id = $1 FOR UPDATE`, id), &before)
+	if err != nil {
+		if isMissingRow(err) {
+			problem.Error(w, r, http.StatusNotFound, "draft_not_found", "Draft not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to fetch draft", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	if before.Action == models.DraftActionDelete {
+		problem.Error(w, r, http.StatusConflict, "deletion_draft_not_editable", "Deletion drafts cannot be edited")
+		return
+	}
+	if before.PublicationID != nil {
+		writeDraftScheduled(w, r)
+		return
+	}
+
+	image := before.Image
+	if uploadedURL != nil {
+		image = uploadedURL
+	}
+
+	query := `
+		UPDATE speisekarte_drafts
+		SET name = $1,
+			description = $2,
+			price_cents = $3,
+			categories = $4,
+			ingredients = $5,
+			tags = $6,
+			image = $7,
+			seasonal = $8,
+			updated_at = NOW()
+		WHERE id = $9
+		RETURNING ` + draftColumns
+
+	var after models.SpeisekarteDraft
+	err = scanDraft(tx.QueryRow(
+		r.Context(),
+		query,
+		in.Name,
+		in.Description,
+		in.PriceCents,
+		in.Categories,
+		in.Ingredients,
+		in.Tags,
+		image,
+		in.Seasonal,
+		id,
+	), &after)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to update draft", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, actorFromRequest(r), "update", auditEntityDraft, id, before, after); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to record audit entry", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to commit draft update", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	saved = true
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(after); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding draft response", "err", err)
+	}
+}
+
+func (h *SpeisekarteHandler) DeleteDraft(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "missing_draft_id", "Missing draft ID")
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var discarded models.SpeisekarteDraft
+	err = scanDraft(tx.QueryRow(r.Context(),
+		`SELECT `+draftColumns+` FROM speisekarte_drafts WHERE id = $1 FOR UPDATE`, id), &discarded)
+	if err != nil {
+		if isMissingRow(err) {
+			problem.Error(w, r, http.StatusNotFound, "draft_not_found", "Draft not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to fetch draft", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	if discarded.PublicationID != nil {
+		writeDraftScheduled(w, r)
+		return
+	}
+
+	if _, err := tx.Exec(r.Context(), `DELETE FROM speisekarte_drafts WHERE id = $1`, id); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to discard draft", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, actorFromRequest(r), "discard", auditEntityDraft, id, discarded, nil); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to record audit entry", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to commit draft discard", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Publish publishes every draft that isn't already scheduled. With a future
+// publish_at the drafts are scheduled instead and go live together at that
+// time.
+func (h *SpeisekarteHandler) Publish(w http.ResponseWriter, r *http.Request) {
+	var req publishRequest
+	if err := validate.DecodeJSON(r.Body, &req); err != nil && err != io.EOF {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	actor := actorFromRequest(r)
+
+	if req.PublishAt != nil && req.PublishAt.After(time.Now()) {
+		var createdBy *string
+		if actor.UserID != "" {
+			createdBy = &actor.UserID
+		}
+
+		var publication models.Publication
+		err := scanPublication(tx.QueryRow(r.Context(),
+			`INSERT INTO speisekarte_publications (created_by, publish_at) VALUES ($1, $2) RETURNING `+publicationColumns,
+			createdBy, *req.PublishAt), &publication)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to schedule publication", "err", err)
+			problem.Internal(w, r)
+			return
+		}
+
+		cmdTag, err := tx.Exec(r.Context(),
+			`UPDATE speisekarte_drafts SET publication_id = $1 WHERE publication_id IS NULL`, publication.ID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to attach drafts to publication", "err", err)
+			problem.Internal(w, r)
+			return
+		}
+		if cmdTag.RowsAffected() == 0 {
+			problem.Error(w, r, http.StatusBadRequest, "no_drafts_to_publish", "No drafts to publish")
+			return
+		}
+
+		if err := recordAudit(r.Context(), tx, actor, "schedule", auditEntityPublication, publication.ID, nil, publication); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to record audit entry", "err", err)
+			problem.Internal(w, r)
+			return
+		}
+
+		if err := tx.Commit(r.Context()); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to commit publication", "err", err)
+			problem.Internal(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(publication); err != nil {
+			logging.FromContext(r.Context()).Error("Error encoding publication response", "err", err)
+		}
+		return
+	}
+
+	if err := lockMenu(r.Context(), tx); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to lock menu", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	n, err := applyDrafts(r.Context(), tx, actor, nil)
+	if err != nil {
+		writePublishError(w, r, err)
+		return
+	}
+	if n == 0 {
+		problem.Error(w, r, http.StatusBadRequest, "no_drafts_to_publish", "No drafts to publish")
+		return
+	}
+
+	if _, err := snapshotMenu(r.Context(), tx, actor, versionReasonPublish, nil); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to snapshot menu", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to commit publication", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	h.Cache.Invalidate()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(publishResponse{Published: n}); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding publish response", "err", err)
+	}
+}
+
+// writeDraftScheduled rejects a change to a draft that belongs to a
+// scheduled publication, which must publish the drafts it was scheduled with.
+func writeDraftScheduled(w http.ResponseWriter, r *http.Request) {
+	problem.Error(w, r, http.StatusConflict, "draft_scheduled",
+		"The draft is scheduled for publication; cancel the publication to change it")
+}
+
+func writePublishError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case isUniqueViolation(err):
+		problem.Error(w, r, http.StatusConflict, "duplicate_item_name", "Publishing would create a duplicate item name")
+	case errors.Is(err, errDraftTargetGone):
+		problem.Error(w, r, http.StatusConflict, "draft_target_gone", err.Error())
+	default:
+		logging.FromContext(r.Context()).Error("Failed to publish drafts", "err", err)
+		problem.Internal(w, r)
+	}
+}
+
+// applyDrafts writes the drafts belonging to publicationID (or the
+// unscheduled drafts if it is nil) to the live menu and removes them. All
+// changes happen in tx, so a failing draft leaves the live menu untouched.
+func applyDrafts(ctx context.Context, tx pgx.Tx, actor auditActor, publicationID *string) (int, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT `+draftColumns+` FROM speisekarte_drafts
+		 WHERE publication_id IS NOT DISTINCT FROM $1
+		 ORDER BY created_at
+		 FOR UPDATE`, publicationID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load drafts: %w", err)
+	}
+	var drafts []models.SpeisekarteDraft
+	for rows.Next() {
+		var draft models.SpeisekarteDraft
+		if err := scanDraft(rows, &draft); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan draft: %w", err)
+		}
+		drafts = append(drafts, draft)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to load drafts: %w", err)
+	}
+
+	ids := make([]string, 0, len(drafts))
+	for _, draft := range drafts {
+		ids = append(ids, draft.ID)
+
+		if draft.ItemID == nil {
+			created, err := insertItem(ctx, tx, draftInput(draft), draft.Image)
+			if err != nil {
+				return 0, fmt.Errorf("failed to publish new item %q: %w", draft.Name, err)
+			}
+			if err := recordAudit(ctx, tx, actor, "create", auditEntityItem, created.ID, nil, created); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		before, err := lockActiveItem(ctx, tx, *draft.ItemID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				if draft.Action == models.DraftActionDelete {
+					continue
+				}
+				return 0, fmt.Errorf("%w: %q", errDraftTargetGone, draft.Name)
+			}
+			return 0, fmt.Errorf("failed to lock item %s: %w", *draft.ItemID, err)
+		}
+
+		if draft.Action == models.DraftActionDelete {
+			trashed, err := trashItem(ctx, tx, before.ID)
+			if err != nil {
+				return 0, fmt.Errorf("failed to delete item %s: %w", before.ID, err)
+			}
+			if err := recordAudit(ctx, tx, actor, "delete", auditEntityItem, before.ID, before, trashed); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		after, err := updateItem(ctx, tx, before.ID, draftInput(draft), draft.Image)
+		if err != nil {
+			return 0, fmt.Errorf("failed to publish item %q: %w", draft.Name, err)
+		}
+		if err := recordAudit(ctx, tx, actor, "update", auditEntityItem, before.ID, before, after); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM speisekarte_drafts WHERE id = ANY($1)`, ids); err != nil {
+		return 0, fmt.Errorf("failed to remove published drafts: %w", err)
+	}
+	return len(drafts), nil
+}
+
+func (h *SpeisekarteHandler) GetPublications(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+publicationColumns+` FROM speisekarte_publications ORDER BY publish_at DESC LIMIT 100`)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Database query failed", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer rows.Close()
+
+	publications := []models.Publication{}
+	for rows.Next() {
+		var p models.Publication
+		if err := scanPublication(rows, &p); err != nil {
+			logging.FromContext(r.Context()).Error("Row scan failed", "err", err)
+			continue
+		}
+		publications = append(publications, p)
+	}
+	if err := rows.Err(); err != nil {
+		logging.FromContext(r.Context()).Error("Row iteration error", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(publications); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding publications response", "err", err)
+	}
+}
+
+// CancelPublication cancels a scheduled publication. Its drafts are kept and
+// become unscheduled again.
+func (h *SpeisekarteHandler) CancelPublication(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "missing_publication_id", "Missing publication ID")
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var cancelled models.Publication
+	err = scanPublication(tx.QueryRow(r.Context(),
+		`UPDATE speisekarte_publications SET status = 'cancelled'
+		 WHERE id = $1 AND status = 'scheduled'
+		 RETURNING `+publicationColumns, id), &cancelled)
+	if err != nil {
+		if isMissingRow(err) {
+			problem.Error(w, r, http.StatusNotFound, "scheduled_publication_not_found", "Scheduled publication not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to cancel publication", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if _, err := tx.Exec(r.Context(),
+		`UPDATE speisekarte_drafts SET publication_id = NULL WHERE publication_id = $1`, id); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to detach drafts", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, actorFromRequest(r), "cancel", auditEntityPublication, id, nil, cancelled); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to record audit entry", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to commit publication cancel", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(cancelled); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding publication response", "err", err)
+	}
+}
+
+// publishDue publishes the oldest scheduled publication whose time has come.
+// It reports whether there was one. SKIP LOCKED lets several instances run the
+// scheduler without publishing the same drafts twice.
+func (h *SpeisekarteHandler) publishDue(ctx context.Context) (bool, error) {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var publication models.Publication
+	err = scanPublication(tx.QueryRow(ctx,
+		`SELECT `+publicationColumns+` FROM speisekarte_publications
+		 WHERE status = 'scheduled' AND publish_at <= NOW()
+		 ORDER BY publish_at
+		 LIMIT 1
+		 FOR UPDATE SKIP LOCKED`), &publication)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to load due publication: %w", err)
+	}
+
+	var actor auditActor
+	if publication.CreatedBy != nil {
+		actor.UserID = *publication.CreatedBy
+	}
+
+	if err := lockMenu(ctx, tx); err != nil {
+		return true, fmt.Errorf("failed to lock menu: %w", err)
+	}
+
+	// The drafts are applied in a savepoint, so a failure can be recorded in
+	// the same transaction while it still holds the publication's lock.
+	apply, err := tx.Begin(ctx)
+	if err != nil {
+		return true, fmt.Errorf("failed to begin savepoint: %w", err)
+	}
+	n, applyErr := applyDrafts(ctx, apply, actor, &publication.ID)
+	if applyErr != nil {
+		if err := apply.Rollback(ctx); err != nil {
+			return true, fmt.Errorf("failed to roll back publication %s: %w", publication.ID, err)
+		}
+		if err := failPublication(ctx, tx, actor, publication, applyErr); err != nil {
+			return true, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return true, fmt.Errorf("failed to commit failure of publication %s: %w", publication.ID, err)
+		}
+		return true, fmt.Errorf("publication %s failed: %w", publication.ID, applyErr)
+	}
+	if err := apply.Commit(ctx); err != nil {
+		return true, fmt.Errorf("failed to release savepoint: %w", err)
+	}
+
+	var published models.Publication
+	err = scanPublication(tx.QueryRow(ctx,
+		`UPDATE speisekarte_publications SET status = 'published', published_at = NOW()
+		 WHERE id = $1
+		 RETURNING `+publicationColumns, publication.ID), &published)
+	if err != nil {
+		return true, fmt.Errorf("failed to mark publication %s as published: %w", publication.ID, err)
+	}
+
+	if err := recordAudit(ctx, tx, actor, "publish", auditEntityPublication, publication.ID, publication, published); err != nil {
+		return true, err
+	}
+
+	if _, err := snapshotMenu(ctx, tx, actor, versionReasonPublish, nil); err != nil {
+		return true, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return true, fmt.Errorf("failed to commit publication %s: %w", publication.ID, err)
+	}
+
+	h.Cache.Invalidate()
+	slog.Info("Published scheduled publication", "publication_id", publication.ID, "drafts", n)
+	return true, nil
+}
+
+// failPublication marks a publication as failed with cause and hands its
+// drafts back so they can be fixed and published again.
+func failPublication(ctx context.Context, tx pgx.Tx, actor auditActor, publication models.Publication, cause error) error {
+	var failed models.Publication
+	err := scanPublication(tx.QueryRow(ctx,
+		`UPDATE speisekarte_publications SET status = 'failed', error = $2
+		 WHERE id = $1
+		 RETURNING `+publicationColumns, publication.ID, cause.Error()), &failed)
+	if err != nil {
+		return fmt.Errorf("failed to mark publication %s as failed: %w", publication.ID, err)
+	}
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE speisekarte_drafts SET publication_id = NULL WHERE publication_id = $1`, publication.ID); err != nil {
+		return fmt.Errorf("failed to detach drafts of publication %s: %w", publication.ID, err)
+	}
+
+	return recordAudit(ctx, tx, actor, "fail", auditEntityPublication, publication.ID, publication, failed)
+}
+
+// StartPublicationScheduler publishes due publications every interval until
+// ctx is cancelled.
+func (h *SpeisekarteHandler) StartPublicationScheduler(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			for {
+				found, err := h.publishDue(ctx)
+				if err != nil {
+					slog.Error("Scheduled publication failed", "err", err)
+				}
+				if !found || ctx.Err() != nil {
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+// itemETag is a strong validator for a single item, derived from the version
+// column that every write increments.
+func itemETag(item models.SpeisekarteItem) string {
+	return `"` + item.ID + "-" + strconv.Itoa(item.Version) + `"`
+}
+
+// etagListContains reports whether header, a comma-separated If-Match or
+// If-None-Match value, lists etag or "*". Weak tags only match when weak is
+// true, since If-Match requires strong comparison.
+func etagListContains(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch enforces If-Match on a write to item. If the client's copy is
+// stale it sets the current ETag and returns a 412 problem, with the current
+// representation as its "current" member.
+// Requests without If-Match are allowed through unconditionally.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, item models.SpeisekarteItem) error {
+	header := r.Header.Get("If-Match")
+	if header == "" || etagListContains(header, itemETag(item), false) {
+		return nil
+	}
+	w.Header().Set("ETag", itemETag(item))
+	p := problem.New(http.StatusPreconditionFailed, "precondition_failed", "The item has been changed since it was fetched")
+	return p.With("current", item)
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when no
+// If-None-Match is sent (RFC 9110, section 13.2.2).
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagListContains(inm, etag, true)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// CacheControlValue builds the Cache-Control header for public menu
+// responses. A zero maxAge disables shared caching.
+func CacheControlValue(maxAge, staleWhileRevalidate time.Duration) string {
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+	value := "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	if staleWhileRevalidate > 0 {
+		value += ", stale-while-revalidate=" + strconv.Itoa(int(staleWhileRevalidate.Seconds()))
+	}
+	return value
+}
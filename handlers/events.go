@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	eventColumns = `id, created_at, type, item_id, data`
+
+	// eventRetention is how long clients can resume from an old event id.
+	eventRetention = 7 * 24 * time.Hour
+	// eventBatchSize bounds a single read of the menu_events table; a
+	// resuming client further behind than this is told to reload instead.
+	eventBatchSize = 1000
+
+	eventHeartbeatInterval = 15 * time.Second
+	eventWriteTimeout      = 10 * time.Second
+	eventRetryMillis       = 5000
+	eventSubscriberBuffer  = 64
+
+	// eventReset tells a client that it missed events and must reload the menu.
+	eventReset = "reset"
+)
+
+// EventBroker fans menu events out to the connected SSE clients of this
+// instance. Events are written to menu_events by database triggers; the
+// broker reads new rows whenever it is woken by a change notification.
+type EventBroker struct {
+	db *pgxpool.Pool
+
+	mu          sync.Mutex
+	subscribers map[chan models.MenuEvent]struct{}
+	lastID      int64
+
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewEventBroker(db *pgxpool.Pool) *EventBroker {
+	return &EventBroker{
+		db:          db,
+		subscribers: make(map[chan models.MenuEvent]struct{}),
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+}
+
+// Wake makes the broker check for new events.
+func (b *EventBroker) Wake() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close disconnects all clients. It is registered with the server's
+// shutdown, which does not wait for streaming responses on its own.
+func (b *EventBroker) Close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// Run delivers new events until ctx is cancelled or the broker is closed,
+// and removes events older than eventRetention.
+func (b *EventBroker) Run(ctx context.Context) {
+	ready := b.start(ctx)
+
+	purge := time.NewTicker(time.Hour)
+	defer purge.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.done:
+			return
+		case <-purge.C:
+			if _, err := b.db.Exec(ctx, `DELETE FROM menu_events WHERE created_at < $1`, time.Now().Add(-eventRetention)); err != nil {
+				slog.Error("Failed to purge menu events", "err", err)
+			}
+		case <-b.wake:
+			// Until the starting point is known, delivering would replay
+			// the whole history to every client.
+			if !ready {
+				ready = b.start(ctx)
+				continue
+			}
+			if err := b.deliver(ctx); err != nil {
+				slog.Error("Failed to deliver menu events", "err", err)
+			}
+		}
+	}
+}
+
+// start makes events after the newest existing one the first to deliver.
+func (b *EventBroker) start(ctx context.Context) bool {
+	latest, err := latestEventID(ctx, b.db)
+	if err != nil {
+		slog.Error("Failed to read latest menu event", "err", err)
+		return false
+	}
+	b.mu.Lock()
+	b.lastID = latest
+	b.mu.Unlock()
+	return true
+}
+
+func (b *EventBroker) deliver(ctx context.Context) error {
+	for {
+		events, err := loadEventsAfter(ctx, b.db, b.lastID)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		b.mu.Lock()
+		for _, event := range events {
+			for ch := range b.subscribers {
+				select {
+				case ch <- event:
+				default:
+					// Too slow to keep up; the client reconnects and
+					// catches up from its Last-Event-ID.
+					delete(b.subscribers, ch)
+					close(ch)
+				}
+			}
+		}
+		b.lastID = events[len(events)-1].ID
+		b.mu.Unlock()
+
+		if len(events) < eventBatchSize {
+			return nil
+		}
+	}
+}
+
+func (b *EventBroker) subscribe() chan models.MenuEvent {
+	ch := make(chan models.MenuEvent, eventSubscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *EventBroker) unsubscribe(ch chan models.MenuEvent) {
+	b.mu.Lock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+	b.mu.Unlock()
+}
+
+func latestEventID(ctx context.Context, q querier) (int64, error) {
+	var id int64
+	err := q.QueryRow(ctx, `SELECT COALESCE(MAX(id), 0) FROM menu_events`).Scan(&id)
+	return id, err
+}
+
+func loadEventsAfter(ctx context.Context, q querier, afterID int64) ([]models.MenuEvent, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+eventColumns+` FROM menu_events WHERE id > $1 ORDER BY id LIMIT $2`, afterID, eventBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.MenuEvent
+	for rows.Next() {
+		var event models.MenuEvent
+		if err := rows.Scan(&event.ID, &event.CreatedAt, &event.Type, &event.ItemID, &event.Data); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// StreamEvents streams menu events as Server-Sent Events. Clients that
+// send Last-Event-ID (or ?last_event_id=) first receive the events they
+// missed, or a reset event if those are no longer available.
+func (h *SpeisekarteHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	lastID := int64(-1)
+	resume := r.Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = r.URL.Query().Get("last_event_id")
+	}
+	if resume != "" {
+		id, err := strconv.ParseInt(resume, 10, 64)
+		if err != nil || id < 0 {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_last_event_id", "Invalid Last-Event-ID")
+			return
+		}
+		lastID = id
+	}
+
+	// Subscribe before catching up so nothing falls between the two; events
+	// seen twice are skipped by id.
+	ch := h.Events.subscribe()
+	defer h.Events.unsubscribe(ch)
+
+	var backlog []models.MenuEvent
+	reset := false
+	if lastID >= 0 {
+		var err error
+		backlog, err = loadEventsAfter(r.Context(), h.DB, lastID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to load missed menu events", "err", err)
+			problem.Internal(w, r)
+			return
+		}
+		reset, err = h.eventsMissed(r.Context(), lastID, backlog)
+		if err == nil && reset {
+			// The client reloads the menu, so continue from the newest event.
+			backlog = nil
+			lastID, err = latestEventID(r.Context(), h.DB)
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to check menu event history", "err", err)
+			problem.Internal(w, r)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(format string, args ...any) bool {
+		// The server's WriteTimeout would end the stream; bound each
+		// write instead so stalled clients are still dropped.
+		_ = rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	send := func(event models.MenuEvent) bool {
+		data, err := json.Marshal(event)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error encoding menu event", "err", err)
+			return true
+		}
+		lastID = event.ID
+		return write("id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	}
+
+	if !write("retry: %d\n\n", eventRetryMillis) {
+		return
+	}
+	if reset {
+		if !write("id: %d\nevent: %s\ndata: {}\n\n", lastID, eventReset) {
+			return
+		}
+	}
+	for _, event := range backlog {
+		if !send(event) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.Events.done:
+			return
+		case <-heartbeat.C:
+			if !write(": heartbeat\n\n") {
+				return
+			}
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if !send(event) {
+				return
+			}
+		}
+	}
+}
+
+// eventsMissed reports whether a client resuming after lastID can no
+// longer be caught up, because the events were purged or there are more
+// than one batch of them.
+func (h *SpeisekarteHandler) eventsMissed(ctx context.Context, lastID int64, backlog []models.MenuEvent) (bool, error) {
+	if len(backlog) >= eventBatchSize {
+		return true, nil
+	}
+	var oldest *int64
+	if err := h.DB.QueryRow(ctx, `SELECT MIN(id) FROM menu_events`).Scan(&oldest); err != nil {
+		return false, err
+	}
+	return oldest != nil && *oldest > lastID+1, nil
+}
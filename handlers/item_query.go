@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+const maxItemPageSize = 200
+
+// itemSortColumns maps the sort keys of GET /speisekarte/ to columns.
+// Prefixing a key with "-" sorts descending; ties are broken by id.
+var itemSortColumns = map[string]string{
+	"name":       "name",
+	"price":      "price_cents",
+	"created_at": "created_at",
+	"position":   "position",
+}
+
+// itemFieldNames are the JSON fields that ?fields= may select.
+var itemFieldNames = []string{
+	"id", "name", "description", "price_cents", "categories", "ingredients", "tags",
+	"image", "seasonal", "available", "position", "created_at", "updated_at", "version",
+}
+
+// itemQuery is a parsed and normalised GET /speisekarte/ query.
+type itemQuery struct {
+	Category           string
+	Tags               []string
+	Ingredients        []string
+	ExcludeIngredients []string
+	MinPrice, MaxPrice *int
+	Seasonal           *bool
+	Available          *bool
+	Sort               string
+	Desc               bool
+	// Limit is zero when the whole menu is requested.
+	Limit  int
+	Cursor *itemCursor
+	Fields []string
+	// Preview lists the menu as it will look once every pending draft is
+	// published.
+	Preview bool
+}
+
+// itemCursor marks the last item of a page: its sort value and id.
+type itemCursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    string          `json:"id"`
+}
+
+// invalidParam reports a rejected query parameter.
+func invalidParam(name, message string) error {
+	return problem.Validation(problem.Field(name, "invalid", name+" "+message))
+}
+
+func splitParam(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" && !slices.Contains(out, part) {
+			out = append(out, part)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+func parseBoolParam(values url.Values, name string) (*bool, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, invalidParam(name, "must be true or false")
+	}
+	return &b, nil
+}
+
+func parsePriceParam(values url.Values, name string) (*int, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return nil, invalidParam(name, "must be a non-negative integer")
+	}
+	return &n, nil
+}
+
+// parseItemQuery reads the filters, sort order, page and field selection of
+// GET /speisekarte/. Invalid parameters are reported as a *problem.Problem.
+func parseItemQuery(values url.Values) (itemQuery, error) {
+	q := itemQuery{
+		Category:           values.Get("category"),
+		Tags:               splitParam(values.Get("tags")),
+		Ingredients:        splitParam(values.Get("ingredients")),
+		ExcludeIngredients: splitParam(values.Get("exclude_ingredients")),
+		Sort:               "name",
+		// Only the exact value the authenticated route matches.
+		Preview: values.Get("preview") == "true",
+	}
+
+	var err error
+	if q.MinPrice, err = parsePriceParam(values, "min_price"); err != nil {
+		return q, err
+	}
+	if q.MaxPrice, err = parsePriceParam(values, "max_price"); err != nil {
+		return q, err
+	}
+	if q.Seasonal, err = parseBoolParam(values, "seasonal"); err != nil {
+		return q, err
+	}
+	if q.Available, err = parseBoolParam(values, "available"); err != nil {
+		return q, err
+	}
+
+	if v := values.Get("sort"); v != "" {
+		q.Sort, q.Desc = strings.CutPrefix(v, "-")
+		if _, ok := itemSortColumns[q.Sort]; !ok {
+			return q, invalidParam("sort", "unknown sort key")
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return q, invalidParam("limit", "must be a positive integer")
+		}
+		q.Limit = min(n, maxItemPageSize)
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		if q.Limit == 0 {
+			return q, invalidParam("cursor", "requires limit")
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		var cursor itemCursor
+		if err != nil || json.Unmarshal(raw, &cursor) != nil || cursor.ID == "" {
+			return q, invalidParam("cursor", "is not a valid cursor")
+		}
+		if cursor.Sort != q.sortParam() {
+			return q, invalidParam("cursor", "does not match sort")
+		}
+		q.Cursor = &cursor
+	}
+
+	q.Fields = splitParam(values.Get("fields"))
+	for _, f := range q.Fields {
+		if !slices.Contains(itemFieldNames, f) {
+			return q, invalidParam("fields", fmt.Sprintf("unknown field %q", f))
+		}
+	}
+
+	return q, nil
+}
+
+func (q itemQuery) sortParam() string {
+	if q.Desc {
+		return "-" + q.Sort
+	}
+	return q.Sort
+}
+
+// values encodes q in canonical form. It serves as the cache key and as the
+// base of the next page link.
+func (q itemQuery) values() url.Values {
+	v := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("category", q.Category)
+	set("tags", strings.Join(q.Tags, ","))
+	set("ingredients", strings.Join(q.Ingredients, ","))
+	set("exclude_ingredients", strings.Join(q.ExcludeIngredients, ","))
+	if q.MinPrice != nil {
+		set("min_price", strconv.Itoa(*q.MinPrice))
+	}
+	if q.MaxPrice != nil {
+		set("max_price", strconv.Itoa(*q.MaxPrice))
+	}
+	if q.Seasonal != nil {
+		set("seasonal", strconv.FormatBool(*q.Seasonal))
+	}
+	if q.Available != nil {
+		set("available", strconv.FormatBool(*q.Available))
+	}
+	set("sort", q.sortParam())
+	if q.Limit > 0 {
+		set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Cursor != nil {
+		set("cursor", encodeItemCursor(*q.Cursor))
+	}
+	set("fields", strings.Join(q.Fields, ","))
+	if q.Preview {
+		set("preview", "true")
+	}
+	return v
+}
+
+// sql builds the SELECT for q. It fetches one row more than the limit to
+// tell whether there is a next page.
+func (q itemQuery) sql() (string, []any, error) {
+	return q.sqlFrom("speisekarte", itemColumns)
+}
+
+// sqlFrom is sql for a source other than the speisekarte table, such as a
+// subquery with the same columns, selecting columns.
+func (q itemQuery) sqlFrom(source, columns string) (string, []any, error) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []any
+	addCondition := func(clause string, values ...any) {
+		placeholders := make([]any, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		conditions = append(conditions, fmt.Sprintf(clause, placeholders...))
+	}
+
+	if q.Category != "" {
+		addCondition("$%d = ANY(categories)", q.Category)
+	}
+	if len(q.Tags) > 0 {
+		addCondition("tags @> $%d::varchar[]", q.Tags)
+	}
+	if len(q.Ingredients) > 0 {
+		addCondition("ingredients @> $%d::text[]", q.Ingredients)
+	}
+	if len(q.ExcludeIngredients) > 0 {
+		addCondition("NOT COALESCE(ingredients && $%d::text[], false)", q.ExcludeIngredients)
+	}
+	if q.MinPrice != nil {
+		addCondition("price_cents >= $%d", *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		addCondition("price_cents <= $%d", *q.MaxPrice)
+	}
+	if q.Seasonal != nil {
+		addCondition("seasonal = $%d", *q.Seasonal)
+	}
+	if q.Available != nil {
+		addCondition("available = $%d", *q.Available)
+	}
+
+	column := itemSortColumns[q.Sort]
+	direction, comparison := "ASC", ">"
+	if q.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if q.Cursor != nil {
+		value, err := q.cursorValue()
+		if err != nil {
+			return "", nil, err
+		}
+		addCondition("("+column+", id) "+comparison+" ($%d, $%d)", value, q.Cursor.ID)
+	}
+
+	query := `SELECT ` + columns + ` FROM ` + source + ` WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY ` + column + ` ` + direction + `, id ` + direction
+	if q.Limit > 0 {
+		args = append(args, q.Limit+1)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	return query, args, nil
+}
+
+// cursorValue decodes the cursor's sort value into the column's Go type.
+func (q itemQuery) cursorValue() (any, error) {
+	var err error
+	switch q.Sort {
+	case "name":
+		var v string
+		err = json.Unmarshal(q.Cursor.Value, &v)
+		if err == nil {
+			return v, nil
+		}
+	case "price", "position":
+		var v int
+		err = json.Unmarshal(q.Cursor.Value, &v)
+		if err == nil {
+			return v, nil
+		}
+	case "created_at":
+		var v time.Time
+		err = json.Unmarshal(q.Cursor.Value, &v)
+		if err == nil {
+			return v, nil
+		}
+	}
+	return nil, invalidParam("cursor", "is not a valid cursor")
+}
+
+// nextCursor returns the cursor for the page after item.
+func (q itemQuery) nextCursor(item models.SpeisekarteItem) (string, error) {
+	var value any
+	switch q.Sort {
+	case "name":
+		value = item.Name
+	case "price":
+		value = item.PriceCents
+	case "position":
+		value = item.Position
+	case "created_at":
+		value = item.CreatedAt
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return encodeItemCursor(itemCursor{Sort: q.sortParam(), Value: raw, ID: item.ID}), nil
+}
+
+func encodeItemCursor(c itemCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// selectFields reduces items, a slice of items, to the requested fields, or
+// returns them unchanged if no fields were requested. Preview items keep
+// their draft_id.
+func (q itemQuery) selectFields(items any) (any, error) {
+	if len(q.Fields) == 0 {
+		return items, nil
+	}
+
+	raw, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var all []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, err
+	}
+	sparse := make([]map[string]json.RawMessage, 0, len(all))
+	for _, item := range all {
+		selected := make(map[string]json.RawMessage, len(q.Fields)+1)
+		for _, f := range q.Fields {
+			selected[f] = item[f]
+		}
+		if draftID, ok := item["draft_id"]; ok {
+			selected["draft_id"] = draftID
+		}
+		sparse = append(sparse, selected)
+	}
+	return sparse, nil
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+	maxSearchQueryLen  = 200
+
+	// searchVector must match the expression of speisekarte_search_idx for
+	// the index to be used.
+	searchVector = `speisekarte_search_vector(name, description, ingredients, tags)`
+
+	// Highlight markers that do not occur in menu text. They are replaced
+	// with <mark> after the snippet has been HTML-escaped.
+	highlightStart = "⟦"
+	highlightStop  = "⟧"
+)
+
+var headlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop +
+	", MaxWords=25, MinWords=8, MaxFragments=2, FragmentDelimiter=\" … \""
+
+type searchHighlights struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+}
+
+type searchResult struct {
+	models.SpeisekarteItem
+	Rank       float64          `json:"rank"`
+	Highlights searchHighlights `json:"highlights"`
+}
+
+// highlight HTML-escapes a ts_headline snippet and turns its markers into
+// <mark> elements, so the result can be inserted into a page as is.
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, highlightStart, "<mark>")
+	return strings.ReplaceAll(snippet, highlightStop, "</mark>")
+}
+
+// SearchItems runs a German full-text search over name, description,
+// ingredients and tags. Unless ?fuzzy=false, names that are similar to the
+// query also match, so misspellings such as "Knödl" still find "Knödel".
+func (h *SpeisekarteHandler) SearchItems(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := strings.TrimSpace(q.Get("q"))
+	if query == "" {
+		problem.Error(w, r, http.StatusBadRequest, "missing_search_query", "Missing search query")
+		return
+	}
+	if len(query) > maxSearchQueryLen {
+		problem.Error(w, r, http.StatusBadRequest, "search_query_too_long", "Search query too long")
+		return
+	}
+
+	limit := defaultSearchLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_limit", "Invalid limit")
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+	fuzzy := q.Get("fuzzy") != "false"
+
+	rows, err := h.DB.Query(r.Context(),
+		`WITH query AS (SELECT websearch_to_tsquery('german', $1) AS tsq)
+		SELECT `+itemColumns+`,
+			ts_rank_cd(`+searchVector+`, query.tsq)
+				+ CASE WHEN $3 THEN word_similarity($1, name) ELSE 0 END AS rank,
+			ts_headline('german', name, query.tsq, $4),
+			ts_headline('german', description, query.tsq, $4)
+		FROM speisekarte, query
+		WHERE deleted_at IS NULL
+			AND (`+searchVector+` @@ query.tsq OR ($3 AND $1 <% name))
+		ORDER BY rank DESC, name
+		LIMIT $2`,
+		query, limit, fuzzy, headlineOptions)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Search query failed", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	results, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (searchResult, error) {
+		var res searchResult
+		var name string
+		var description *string
+		err := row.Scan(append(itemFields(&res.SpeisekarteItem), &res.Rank, &name, &description)...)
+		res.Highlights.Name = highlight(name)
+		if description != nil {
+			d := highlight(*description)
+			res.Highlights.Description = &d
+		}
+		return res, err
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Search query failed", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	if results == nil {
+		results = []searchResult{}
+	}
+
+	writeJSON(w, r, http.StatusOK, results)
+}
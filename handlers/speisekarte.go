@@ -1,396 +1,679 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
-	"sync"
-	"time"
 
 	"github.com/gomisroca/gasthaus-backend/internal"
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/menucache"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/internal/validate"
 	"github.com/gomisroca/gasthaus-backend/models"
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-var (
-	cacheMu             sync.RWMutex
-	menuCache           = make(map[string][]models.SpeisekarteItem)
-	cacheTimes          = make(map[string]time.Time)
-	categoriesCache     []string
-	categoriesCacheTime time.Time
-	cacheDuration       = 5 * time.Minute
+const (
+	itemColumns     = `id, name, description, price_cents, categories, ingredients, tags, image, seasonal, available, position, created_at, updated_at, deleted_at, version`
+	auditEntityItem = "speisekarte"
 )
 
 type SpeisekarteHandler struct {
-	DB *pgxpool.Pool
+	DB     *pgxpool.Pool
+	Cache  *menucache.Cache
+	Events *EventBroker
+	// CacheControl is sent with public menu responses, e.g.
+	// "public, max-age=60, stale-while-revalidate=300". Empty sends none.
+	CacheControl string
+	// Images stores uploaded item images. Uploads fail if it is nil.
+	Images *internal.Supabase
+
+	// menu serves the item and category routes.
+	menu menuStore
 }
 
-func invalidateCache() {
-	cacheMu.Lock()
-	defer cacheMu.Unlock()
-	menuCache = make(map[string][]models.SpeisekarteItem)
-	cacheTimes = make(map[string]time.Time)
-	categoriesCache = nil
-	categoriesCacheTime = time.Time{}
+func NewSpeisekarteHandler(db *pgxpool.Pool, cache *menucache.Cache) *SpeisekarteHandler {
+	if cache == nil {
+		cache = menucache.New(menucache.DefaultConfig)
+	}
+	return &SpeisekarteHandler{DB: db, Cache: cache, Events: NewEventBroker(db), menu: pgxMenuStore{db: db}}
 }
 
-func (h *SpeisekarteHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
-	cacheMu.RLock()
-	cached := categoriesCache
-	cacheTime := categoriesCacheTime
-	cacheMu.RUnlock()
-
-	if time.Since(cacheTime) < cacheDuration && cached != nil {
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(cached); err != nil {
-			log.Printf("Error encoding categories response: %v", err)
+// itemFields returns scan destinations for itemColumns, in order.
+func itemFields(item *models.SpeisekarteItem) []any {
+	return []any{
+		&item.ID,
+		&item.Name,
+		&item.Description,
+		&item.PriceCents,
+		&item.Categories,
+		&item.Ingredients,
+		&item.Tags,
+		&item.Image,
+		&item.Seasonal,
+		&item.Available,
+		&item.Position,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+		&item.DeletedAt,
+		&item.Version,
+	}
+}
+
+func scanItem(row pgx.Row, item *models.SpeisekarteItem) error {
+	return row.Scan(itemFields(item)...)
+}
+
+// readMenu runs load on a read-only snapshot of the menu and encodes its
+// result, tagged with the menu version the snapshot saw, so the validators
+// always describe exactly the data returned.
+func (h *SpeisekarteHandler) readMenu(ctx context.Context, etagPrefix string, load func(menuView) (any, error)) (menucache.Entry, error) {
+	var entry menucache.Entry
+	err := h.menu.view(ctx, func(v menuView) error {
+		version, updatedAt, err := v.state(ctx)
+		if err != nil {
+			return err
+		}
+
+		data, err := load(v)
+		if err != nil {
+			return err
 		}
+
+		body, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+
+		entry = menucache.Entry{
+			Body:         append(body, '\n'),
+			ETag:         fmt.Sprintf(`"%s-%d"`, etagPrefix, version),
+			LastModified: updatedAt,
+		}
+		return nil
+	})
+	return entry, err
+}
+
+func (h *SpeisekarteHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.Cache.Get(r.Context(), "categories", func(ctx context.Context) (menucache.Entry, error) {
+		return h.readMenu(ctx, "categories", func(v menuView) (any, error) {
+			return v.categories(ctx)
+		})
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to read categories", "err", err)
+		problem.Internal(w, r)
 		return
 	}
 
-	rows, err := h.DB.Query(r.Context(), "SELECT DISTINCT unnest(categories) AS category FROM speisekarte")
-	if err != nil {
-		log.Printf("Database query failed: %v", err)
-		http.Error(w, "Database query failed", http.StatusInternalServerError)
+	h.writeMenuResponse(w, r, resp)
+}
+
+func (h *SpeisekarteHandler) GetUniqueItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "missing_item_id", "Missing item ID")
 		return
 	}
-	defer rows.Close()
 
-	var categories []string
-	for rows.Next() {
-		var category string
-		if err := rows.Scan(&category); err != nil {
-			log.Printf("Row scan failed: %v", err)
-			continue
+	item, err := h.menu.item(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			problem.Error(w, r, http.StatusNotFound, "item_not_found", "Item not found")
+			return
 		}
-		categories = append(categories, category)
+		logging.FromContext(r.Context()).Error("Failed to fetch item", "err", err)
+		problem.Internal(w, r)
+		return
 	}
-	if err := rows.Err(); err != nil {
-		log.Printf("Row iteration error: %v", err)
-		http.Error(w, "Failed to read categories", http.StatusInternalServerError)
+
+	etag := itemETag(item)
+	if notModified(r, etag, item.UpdatedAt) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	cacheMu.Lock()
-	categoriesCache = categories
-	categoriesCacheTime = time.Now()
-	cacheMu.Unlock()
+	writeItem(w, r, http.StatusOK, item)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(categories); err != nil {
-		log.Printf("Error encoding categories response: %v", err)
+// GetItems lists the menu. See parseItemQuery for the supported filters,
+// sort keys and field selection. With ?limit= the list is paginated: the
+// next page is linked in the Link and X-Next-Cursor headers.
+func (h *SpeisekarteHandler) GetItems(w http.ResponseWriter, r *http.Request) {
+	q, err := parseItemQuery(r.URL.Query())
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
 	}
-}
+	if q.Cursor != nil {
+		if _, err := q.cursorValue(); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+	}
+	if q.Preview {
+		h.writePreview(w, r, q)
+		return
+	}
+	key := q.values().Encode()
+
+	resp, err := h.Cache.Get(r.Context(), "items?"+key, func(ctx context.Context) (menucache.Entry, error) {
+		var next string
+		entry, err := h.readMenu(ctx, "menu", func(v menuView) (any, error) {
+			items, err := v.items(ctx, q)
+			if err != nil {
+				return nil, err
+			}
+
+			if q.Limit > 0 && len(items) > q.Limit {
+				items = items[:q.Limit]
+				if next, err = q.nextCursor(items[len(items)-1]); err != nil {
+					return nil, err
+				}
+			}
+			return q.selectFields(items)
+		})
+		if err != nil || next == "" {
+			return entry, err
+		}
 
-func (h *SpeisekarteHandler) GetUniqueItem(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-	if id == "" {
-		http.Error(w, "Missing item ID", http.StatusBadRequest)
+		link := q.values()
+		link.Set("cursor", next)
+		entry.Header = http.Header{}
+		entry.Header.Set("X-Next-Cursor", next)
+		entry.Header.Set("Link", "<"+r.URL.Path+"?"+link.Encode()+`>; rel="next"`)
+		return entry, nil
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to read items", "err", err)
+		problem.Internal(w, r)
 		return
 	}
 
-	query := `
-		SELECT id, name, description, price_cents, categories, ingredients, tags, image, seasonal, created_at, updated_at
-		FROM speisekarte
-		WHERE id = $1
-	`
+	h.writeMenuResponse(w, r, resp)
+}
 
-	var item models.SpeisekarteItem
-	err := h.DB.QueryRow(r.Context(), query, id).Scan(
-		&item.ID,
-		&item.Name,
-		&item.Description,
-		&item.PriceCents,
-		&item.Categories,
-		&item.Ingredients,
-		&item.Tags,
-		&item.Image,
-		&item.Seasonal,
-		&item.CreatedAt,
-		&item.UpdatedAt,
-	)
+// writePreview answers ?preview=true with the menu as guests will see it once
+// every pending draft is published, filtered, sorted and paged like the live
+// menu. The page is read from one snapshot and never cached.
+func (h *SpeisekarteHandler) writePreview(w http.ResponseWriter, r *http.Request, q itemQuery) {
+	// The route requires a token; this guards against other spellings of
+	// the parameter reaching the public route.
+	if actorFromRequest(r).UserID == "" {
+		problem.Error(w, r, http.StatusUnauthorized, "authorization_header_missing", "Authorization header missing")
+		return
+	}
+
+	var items []previewItem
+	err := h.menu.view(r.Context(), func(v menuView) error {
+		var err error
+		items, err = v.previewItems(r.Context(), q)
+		return err
+	})
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			http.Error(w, "Item not found", http.StatusNotFound)
+		logging.FromContext(r.Context()).Error("Failed to read preview", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if q.Limit > 0 && len(items) > q.Limit {
+		items = items[:q.Limit]
+		next, err := q.nextCursor(items[len(items)-1].SpeisekarteItem)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to encode cursor", "err", err)
+			problem.Internal(w, r)
 			return
 		}
-		log.Printf("Failed to fetch item: %v", err)
-		http.Error(w, "Failed to fetch item", http.StatusInternalServerError)
+		link := q.values()
+		link.Set("cursor", next)
+		w.Header().Set("X-Next-Cursor", next)
+		w.Header().Set("Link", "<"+r.URL.Path+"?"+link.Encode()+`>; rel="next"`)
+	}
+
+	body, err := q.selectFields(items)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to select fields", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding preview response", "err", err)
+	}
+}
+
+// writeMenuResponse sends a public menu response with its validators and
+// answers conditional requests with 304 Not Modified.
+func (h *SpeisekarteHandler) writeMenuResponse(w http.ResponseWriter, r *http.Request, resp menucache.Entry) {
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	w.Header().Set("ETag", resp.ETag)
+	w.Header().Set("Last-Modified", resp.LastModified.UTC().Format(http.TimeFormat))
+	if h.CacheControl != "" {
+		w.Header().Set("Cache-Control", h.CacheControl)
+	}
+
+	if notModified(r, resp.ETag, resp.LastModified) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(item); err != nil {
-		log.Printf("Error encoding item response: %v", err)
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	if _, err := w.Write(resp.Body); err != nil {
+		logging.FromContext(r.Context()).Error("Error writing menu response", "err", err)
 	}
 }
 
-func (h *SpeisekarteHandler) GetItems(w http.ResponseWriter, r *http.Request) {
-	category := r.URL.Query().Get("category")
+// CacheStats reports the menu cache counters.
+func (h *SpeisekarteHandler) CacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.Cache.Stats()); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding cache stats", "err", err)
+	}
+}
+
+// AddItem creates an item from a multipart form, which must include the
+// image, or from a JSON body, in which case the image is uploaded afterwards
+// through PUT /speisekarte/{id}/image.
+func (h *SpeisekarteHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	in, err := decodeItemInput(r)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	var imageURL *string
+	if !isJSONRequest(r) {
+		file, handler, err := r.FormFile("image")
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, "image_required", "Image is required")
+			return
+		}
+		defer file.Close()
 
-	cacheMu.RLock()
-	data, ok := menuCache[category]
-	cacheTime := cacheTimes[category]
-	cacheMu.RUnlock()
+		uploaded, err := h.Images.Upload(r.Context(), file, handler)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Image upload failed", "err", err)
+			problem.Internal(w, r)
+			return
+		}
+		imageURL = &uploaded
+	}
 
-	if ok && time.Since(cacheTime) < cacheDuration {
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(data); err != nil {
-			log.Printf("Error encoding items response: %v", err)
+	var created models.SpeisekarteItem
+	err = h.menu.update(r.Context(), func(tx menuTx) error {
+		var err error
+		if created, err = tx.insertItem(r.Context(), in, imageURL); err != nil {
+			return err
+		}
+		actor := actorFromRequest(r)
+		if err := tx.recordAudit(r.Context(), actor, "create", created.ID, nil, created); err != nil {
+			return err
 		}
+		return tx.snapshot(r.Context(), actor)
+	})
+	if err != nil {
+		h.discardUpload(r, imageURL)
+		writeItemError(w, r, "Failed to insert item", err)
 		return
 	}
 
-	var rows pgx.Rows
-	var err error
+	h.Cache.Invalidate()
+	w.Header().Set("Location", "/speisekarte/"+created.ID)
+	writeItem(w, r, http.StatusCreated, created)
+}
 
-	if category == "" {
-		rows, err = h.DB.Query(r.Context(),
-			`SELECT id, name, description, price_cents, categories, ingredients, tags, image, seasonal, created_at, updated_at
-			 FROM speisekarte`)
-	} else {
-		rows, err = h.DB.Query(r.Context(),
-			`SELECT id, name, description, price_cents, categories, ingredients, tags, image, seasonal, created_at, updated_at
-			 FROM speisekarte WHERE $1 = ANY(categories)`, category)
+// UpdateItem replaces an item's fields from a multipart form or a JSON body.
+// Fields left out are cleared; use PatchItem for partial updates.
+func (h *SpeisekarteHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "missing_item_id", "Missing item ID")
+		return
 	}
 
+	in, err := decodeItemInput(r)
 	if err != nil {
-		log.Printf("Database query failed: %v", err)
-		http.Error(w, "Database query failed", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var items []models.SpeisekarteItem
-	for rows.Next() {
-		var item models.SpeisekarteItem
-		if err := rows.Scan(
-			&item.ID,
-			&item.Name,
-			&item.Description,
-			&item.PriceCents,
-			&item.Categories,
-			&item.Ingredients,
-			&item.Tags,
-			&item.Image,
-			&item.Seasonal,
-			&item.CreatedAt,
-			&item.UpdatedAt,
-		); err != nil {
-			log.Printf("Row scan failed: %v", err)
-			continue
-		}
-		items = append(items, item)
-	}
-	if err := rows.Err(); err != nil {
-		log.Printf("Row iteration error: %v", err)
-		http.Error(w, "Failed to read items", http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
 
-	cacheMu.Lock()
-	menuCache[category] = items
-	cacheTimes[category] = time.Now()
-	cacheMu.Unlock()
+	// Upload before locking the row so a slow upload doesn't hold the lock,
+	// and delete the image again if the update is rejected.
+	var uploadedURL *string
+	if !isJSONRequest(r) {
+		var ok bool
+		if uploadedURL, ok = h.uploadOptionalImage(w, r); !ok {
+			return
+		}
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(items); err != nil {
-		log.Printf("Error encoding items response: %v", err)
+	saved := h.modifyItem(w, r, id, "Failed to update item", func(before models.SpeisekarteItem) (itemInput, *string, error) {
+		if uploadedURL != nil {
+			return in, uploadedURL, nil
+		}
+		return in, before.Image, nil
+	})
+	if !saved {
+		h.discardUpload(r, uploadedURL)
 	}
 }
 
-func (h *SpeisekarteHandler) AddItem(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+// PatchItem applies a JSON Merge Patch (RFC 7396) to an item. Only the fields
+// present in the body change.
+func (h *SpeisekarteHandler) PatchItem(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "missing_item_id", "Missing item ID")
 		return
 	}
 
-	name := r.FormValue("name")
-	description := r.FormValue("description")
-	priceStr := r.FormValue("price_cents")
-	categories := r.Form["categories"]
-	ingredients := r.Form["ingredients"]
-	tags := r.Form["tags"]
-	seasonal := r.FormValue("seasonal") == "true"
+	if !isJSONRequest(r) {
+		problem.Error(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/merge-patch+json")
+		return
+	}
 
-	if name == "" || priceStr == "" || len(categories) == 0 {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	var patch map[string]json.RawMessage
+	if err := validate.DecodeJSON(r.Body, &patch); err != nil || patch == nil {
+		writeBodyError(w, r, err)
 		return
 	}
 
-	priceCents, err := strconv.Atoi(priceStr)
-	if err != nil || priceCents < 0 {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+	h.modifyItem(w, r, id, "Failed to update item", func(before models.SpeisekarteItem) (itemInput, *string, error) {
+		in, err := applyItemPatch(itemInputFromItem(before), patch)
+		return in, before.Image, err
+	})
+}
+
+// UploadItemImage replaces an item's image with the multipart "image" field.
+func (h *SpeisekarteHandler) UploadItemImage(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "missing_item_id", "Missing item ID")
 		return
 	}
 
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid_form_data", "Invalid form data")
+		return
+	}
 	file, handler, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "Image is required", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "image_required", "Image is required")
 		return
 	}
 	defer file.Close()
 
-	imageURL, err := internal.UploadToSupabase(r.Context(), file, handler)
+	imageURL, err := h.Images.Upload(r.Context(), file, handler)
 	if err != nil {
-		log.Printf("Image upload failed: %v", err)
-		http.Error(w, "Image upload failed", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("Image upload failed", "err", err)
+		problem.Internal(w, r)
 		return
 	}
 
-	query := `INSERT INTO speisekarte (name, description, price_cents, categories, ingredients, tags, image, seasonal)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	saved := h.modifyItem(w, r, id, "Failed to update image", func(before models.SpeisekarteItem) (itemInput, *string, error) {
+		return itemInputFromItem(before), &imageURL, nil
+	})
+	if !saved {
+		h.discardUpload(r, &imageURL)
+	}
+}
 
-	_, err = h.DB.Exec(
-		r.Context(),
-		query,
-		name,
-		description,
-		priceCents,
-		categories,
-		ingredients,
-		tags,
-		imageURL,
-		seasonal,
-	)
-	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
-			http.Error(w, "Item with this name already exists", http.StatusConflict)
-			return
-		}
-		log.Printf("Failed to insert item: %v", err)
-		http.Error(w, "Failed to insert item", http.StatusInternalServerError)
+// DeleteItemImage removes an item's image reference.
+func (h *SpeisekarteHandler) DeleteItemImage(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "missing_item_id", "Missing item ID")
 		return
 	}
 
-	invalidateCache()
-	w.WriteHeader(http.StatusCreated)
+	h.modifyItem(w, r, id, "Failed to remove image", func(before models.SpeisekarteItem) (itemInput, *string, error) {
+		return itemInputFromItem(before), nil, nil
+	})
 }
 
-func (h *SpeisekarteHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+// SetItemAvailability marks an item as sold out or available again. It is
+// an operational change, so unlike edits it takes no menu snapshot.
+func (h *SpeisekarteHandler) SetItemAvailability(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
 	if id == "" {
-		http.Error(w, "Missing item ID", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "missing_item_id", "Missing item ID")
 		return
 	}
 
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+	var body struct {
+		Available *bool `json:"available"`
+	}
+	if err := validate.DecodeJSON(r.Body, &body); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if body.Available == nil {
+		problem.Write(w, r, problem.Validation(problem.Field("available", "required", "available is required")))
 		return
 	}
 
-	name := r.FormValue("name")
-	description := r.FormValue("description")
-	priceStr := r.FormValue("price_cents")
-	categories := r.Form["categories"]
-	ingredients := r.Form["ingredients"]
-	tags := r.Form["tags"]
-	seasonal := r.FormValue("seasonal") == "true"
-
-	if name == "" || priceStr == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	var after models.SpeisekarteItem
+	err := h.menu.update(r.Context(), func(tx menuTx) error {
+		before, err := tx.lockItem(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(w, r, before); err != nil {
+			return err
+		}
+		if after, err = tx.setAvailable(r.Context(), id, *body.Available); err != nil {
+			return err
+		}
+		return tx.recordAudit(r.Context(), actorFromRequest(r), "availability", id, before, after)
+	})
+	if err != nil {
+		writeItemError(w, r, "Failed to update availability", err)
 		return
 	}
 
-	priceCents, err := strconv.Atoi(priceStr)
-	if err != nil || priceCents < 0 {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+	h.Cache.Invalidate()
+	writeItem(w, r, http.StatusOK, after)
+}
+
+// ReorderItems sets the manual display order used by ?sort=position. The
+// listed items come first, in the given order; all others follow in their
+// previous order.
+func (h *SpeisekarteHandler) ReorderItems(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if err := validate.DecodeJSON(r.Body, &body); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	v := validate.New()
+	v.Strings("ids", &body.IDs, validate.MinItems(1))
+	if err := v.Err(); err != nil {
+		problem.WriteError(w, r, err)
 		return
 	}
 
-	var imageURL string
-	err = h.DB.QueryRow(r.Context(), `SELECT image FROM speisekarte WHERE id = $1`, id).Scan(&imageURL)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			http.Error(w, "Item not found", http.StatusNotFound)
-			return
+	err := h.menu.update(r.Context(), func(tx menuTx) error {
+		before, err := tx.lockPositions(r.Context())
+		if err != nil {
+			return err
 		}
-		log.Printf("Failed to fetch existing item: %v", err)
-		http.Error(w, "Failed to fetch item", http.StatusInternalServerError)
+
+		seen := make(map[string]bool, len(body.IDs))
+		for _, id := range body.IDs {
+			if _, ok := before[id]; !ok || seen[id] {
+				return problem.Validation(
+					problem.Field("ids", "invalid", fmt.Sprintf("unknown or duplicate item %q", id)))
+			}
+			seen[id] = true
+		}
+
+		changed, err := tx.reorder(r.Context(), body.IDs)
+		if err != nil {
+			return err
+		}
+		after := make(map[string]int, len(before))
+		for id, position := range before {
+			after[id] = position
+		}
+		for id, position := range changed {
+			after[id] = position
+		}
+		return tx.recordAudit(r.Context(), actorFromRequest(r), "reorder", "positions", before, after)
+	})
+	if err != nil {
+		writeItemError(w, r, "Failed to reorder items", err)
 		return
 	}
 
-	file, handler, err := r.FormFile("image")
-	if err == nil && file != nil {
-		defer file.Close()
-		uploadedURL, uploadErr := internal.UploadToSupabase(r.Context(), file, handler)
-		if uploadErr != nil {
-			log.Printf("Image upload failed: %v", uploadErr)
-			http.Error(w, "Image upload failed", http.StatusInternalServerError)
-			return
+	h.Cache.Invalidate()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// itemMutation computes an item's new fields and image from its current
+// state. A returned error is sent to the client as a bad request.
+type itemMutation func(before models.SpeisekarteItem) (itemInput, *string, error)
+
+// modifyItem locks an item, applies mutate and writes the result together
+// with its audit entry and menu snapshot, then responds with the new item.
+// It reports whether the change was saved.
+func (h *SpeisekarteHandler) modifyItem(w http.ResponseWriter, r *http.Request, id, failMsg string, mutate itemMutation) bool {
+	var after models.SpeisekarteItem
+	err := h.menu.update(r.Context(), func(tx menuTx) error {
+		before, err := tx.lockItem(r.Context(), id)
+		if err != nil {
+			return err
 		}
-		imageURL = uploadedURL
-	}
-
-	query := `
-		UPDATE speisekarte
-		SET name = $1,
-			description = $2,
-			price_cents = $3,
-			categories = $4,
-			ingredients = $5,
-			tags = $6,
-			image = $7,
-			seasonal = $8,
-			updated_at = NOW()
-		WHERE id = $9
-		RETURNING id
-	`
-
-	var returnedID string
-	err = h.DB.QueryRow(
-		r.Context(),
-		query,
-		name,
-		description,
-		priceCents,
-		categories,
-		ingredients,
-		tags,
-		imageURL,
-		seasonal,
-		id,
-	).Scan(&returnedID)
-	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
-			http.Error(w, "Item with this name already exists", http.StatusConflict)
-			return
+		if err := checkIfMatch(w, r, before); err != nil {
+			return err
 		}
-		log.Printf("Failed to update item: %v", err)
-		http.Error(w, "Failed to update item", http.StatusInternalServerError)
-		return
+
+		in, image, err := mutate(before)
+		if err != nil {
+			return err
+		}
+		if after, err = tx.updateItem(r.Context(), id, in, image); err != nil {
+			return err
+		}
+
+		actor := actorFromRequest(r)
+		if err := tx.recordAudit(r.Context(), actor, "update", id, before, after); err != nil {
+			return err
+		}
+		return tx.snapshot(r.Context(), actor)
+	})
+	if err != nil {
+		writeItemError(w, r, failMsg, err)
+		return false
 	}
 
-	invalidateCache()
-	w.WriteHeader(http.StatusOK)
+	h.Cache.Invalidate()
+	writeItem(w, r, http.StatusOK, after)
+	return true
+}
+
+// writeItemError responds to an error from an item route: missing items and
+// duplicate names are the client's, problems are sent as they are and
+// anything else is logged as a server failure.
+func writeItemError(w http.ResponseWriter, r *http.Request, failMsg string, err error) {
+	var p *problem.Problem
+	switch {
+	case errors.Is(err, errNotFound):
+		problem.Error(w, r, http.StatusNotFound, "item_not_found", "Item not found")
+	case errors.Is(err, errDuplicateName):
+		problem.Error(w, r, http.StatusConflict, "duplicate_item_name", "Item with this name already exists")
+	case errors.As(err, &p):
+		problem.Write(w, r, p)
+	default:
+		logging.FromContext(r.Context()).Error(failMsg, "err", err)
+		problem.Internal(w, r)
+	}
+}
+
+func writeItem(w http.ResponseWriter, r *http.Request, status int, item models.SpeisekarteItem) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", itemETag(item))
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(item); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding item response", "err", err)
+	}
 }
 
 func (h *SpeisekarteHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if id == "" {
-		http.Error(w, "Missing item ID", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "missing_item_id", "Missing item ID")
 		return
 	}
 
-	cmdTag, err := h.DB.Exec(r.Context(), `DELETE FROM speisekarte WHERE id = $1`, id)
+	err := h.menu.update(r.Context(), func(tx menuTx) error {
+		before, err := tx.lockItem(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(w, r, before); err != nil {
+			return err
+		}
+
+		trashed, err := tx.trashItem(r.Context(), id)
+		if err != nil {
+			return err
+		}
+
+		actor := actorFromRequest(r)
+		if err := tx.recordAudit(r.Context(), actor, "delete", id, before, trashed); err != nil {
+			return err
+		}
+		return tx.snapshot(r.Context(), actor)
+	})
 	if err != nil {
-		log.Printf("Failed to delete item: %v", err)
-		http.Error(w, "Failed to delete item", http.StatusInternalServerError)
+		writeItemError(w, r, "Failed to delete item", err)
 		return
 	}
 
-	if cmdTag.RowsAffected() == 0 {
-		http.Error(w, "Item not found", http.StatusNotFound)
-		return
+	h.Cache.Invalidate()
+	w.WriteHeader(http.StatusOK)
+}
+
+// menuChangedChannel is notified by the speisekarte triggers on every menu
+// change; see the notify_menu_changes migration.
+const menuChangedChannel = "menu_changed"
+
+// StartChangeListener reacts to menu changes made by any instance: it drops
+// the menu cache and wakes the event broker. Both also happen on every
+// (re)connect, because notifications sent while the listener was
+// disconnected are lost.
+func (h *SpeisekarteHandler) StartChangeListener(ctx context.Context) {
+	go h.Events.Run(ctx)
+
+	onChange := func() {
+		h.Cache.Invalidate()
+		h.Events.Wake()
 	}
+	go internal.Listen(ctx, h.DB.Config().ConnConfig.Copy(), menuChangedChannel,
+		onChange,
+		func(string) { onChange() },
+	)
+}
 
-	invalidateCache()
-	w.WriteHeader(http.StatusOK)
-}
\ No newline at end of file
+// PurgeMenuCaches makes every running server drop its menu cache, by sending
+// the notification their change listeners wait for.
+func PurgeMenuCaches(ctx context.Context, db *pgxpool.Pool) error {
+	_, err := db.Exec(ctx, `SELECT pg_notify($1, 'purge')`, menuChangedChannel)
+	return err
+}
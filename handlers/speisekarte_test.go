@@ -0,0 +1,716 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/menucache"
+	"github.com/gomisroca/gasthaus-backend/internal/middleware"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/gorilla/mux"
+)
+
+const (
+	schnitzelID = "00000000-0000-4000-8000-000000000001"
+	spaetzleID  = "00000000-0000-4000-8000-000000000002"
+	strudelID   = "00000000-0000-4000-8000-000000000003"
+	trashedID   = "00000000-0000-4000-8000-000000000004"
+	missingID   = "00000000-0000-4000-8000-000000000099"
+)
+
+// testMenu returns three items on the menu and one in the trash.
+func testMenu() []models.SpeisekarteItem {
+	created := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+	image := "https://example.com/schnitzel.jpg"
+	deleted := created.Add(time.Hour)
+	return []models.SpeisekarteItem{
+		{
+			ID: schnitzelID, Name: "Wiener Schnitzel", PriceCents: 1890,
+			Categories: []string{"Hauptgerichte"}, Ingredients: []string{"Kalb", "Zitrone"},
+			Image: &image, Available: true, Position: 1, CreatedAt: created, UpdatedAt: created,
+		},
+		{
+			ID: spaetzleID, Name: "Käsespätzle", PriceCents: 1290,
+			Categories: []string{"Hauptgerichte"}, Ingredients: []string{"Käse", "Zwiebeln"}, Tags: []string{"vegetarisch"},
+			Available: true, Position: 2, CreatedAt: created.Add(time.Minute), UpdatedAt: created,
+		},
+		{
+			ID: strudelID, Name: "Apfelstrudel", PriceCents: 690,
+			Categories: []string{"Desserts"}, Ingredients: []string{"Äpfel", "Zimt"}, Tags: []string{"vegetarisch"},
+			Seasonal: true, Position: 3, CreatedAt: created.Add(2 * time.Minute), UpdatedAt: created,
+		},
+		{
+			ID: trashedID, Name: "Gulaschsuppe", PriceCents: 790, Categories: []string{"Suppen"},
+			Position: 4, CreatedAt: created, UpdatedAt: deleted, DeletedAt: &deleted,
+		},
+	}
+}
+
+// handlerTest is a request to one handler of a fresh menu. Handlers are
+// called directly with the route variables mux would have set.
+type handlerTest struct {
+	name    string
+	handler func(*SpeisekarteHandler, http.ResponseWriter, *http.Request)
+	method  string
+	target  string
+	vars    map[string]string
+	header  map[string]string
+	body    string
+	// setup prepares the store before the request.
+	setup func(*memoryStore)
+
+	wantStatus int
+	// wantCode is the problem code of an error response.
+	wantCode string
+	// check inspects the response and the store afterwards.
+	check func(*testing.T, *httptest.ResponseRecorder, *memoryStore)
+}
+
+func (tt handlerTest) run(t *testing.T) {
+	t.Helper()
+	store := newMemoryStore(testMenu()...)
+	if tt.setup != nil {
+		tt.setup(store)
+	}
+	h := &SpeisekarteHandler{Cache: menucache.New(menucache.DefaultConfig), menu: store}
+
+	req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+	if tt.body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range tt.header {
+		req.Header.Set(k, v)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+	if tt.vars != nil {
+		req = mux.SetURLVars(req, tt.vars)
+	}
+
+	rec := httptest.NewRecorder()
+	tt.handler(h, rec, req)
+
+	if rec.Code != tt.wantStatus {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.wantStatus, rec.Body)
+	}
+	if tt.wantCode != "" {
+		var p struct {
+			Code string `json:"code"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil || p.Code != tt.wantCode {
+			t.Fatalf("problem code = %q, want %q; body: %s", p.Code, tt.wantCode, rec.Body)
+		}
+	}
+	if tt.check != nil {
+		tt.check(t, rec, store)
+	}
+}
+
+func runHandlerTests(t *testing.T, tests []handlerTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, tt.run)
+	}
+}
+
+func decodeBody[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding response: %v; body: %s", err, rec.Body)
+	}
+	return v
+}
+
+func itemNames(items []models.SpeisekarteItem) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Name
+	}
+	return names
+}
+
+func wantNames(want ...string) func(*testing.T, *httptest.ResponseRecorder, *memoryStore) {
+	return func(t *testing.T, rec *httptest.ResponseRecorder, _ *memoryStore) {
+		t.Helper()
+		if got := itemNames(decodeBody[[]models.SpeisekarteItem](t, rec)); !slices.Equal(got, want) {
+			t.Errorf("items = %q, want %q", got, want)
+		}
+	}
+}
+
+// wantAudit checks the committed audit entries and menu snapshots.
+func wantAudit(snapshots int, entries ...string) func(*testing.T, *httptest.ResponseRecorder, *memoryStore) {
+	return func(t *testing.T, _ *httptest.ResponseRecorder, s *memoryStore) {
+		t.Helper()
+		if !slices.Equal(s.audit, entries) {
+			t.Errorf("audit = %q, want %q", s.audit, entries)
+		}
+		if s.snapshots != snapshots {
+			t.Errorf("snapshots = %d, want %d", s.snapshots, snapshots)
+		}
+	}
+}
+
+// unchanged checks that a rejected write left the menu as it was.
+func unchanged(t *testing.T, _ *httptest.ResponseRecorder, s *memoryStore) {
+	t.Helper()
+	if s.version != 1 || len(s.audit) > 0 || s.snapshots > 0 {
+		t.Errorf("menu changed: version %d, audit %q, %d snapshots", s.version, s.audit, s.snapshots)
+	}
+}
+
+func failStore(s *memoryStore) { s.err = errors.New("connection refused") }
+
+func TestGetItems(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "all", handler: (*SpeisekarteHandler).GetItems, method: "GET", target: "/speisekarte/",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				wantNames("Apfelstrudel", "Käsespätzle", "Wiener Schnitzel")(t, rec, s)
+				if etag := rec.Header().Get("ETag"); etag != `"menu-1"` {
+					t.Errorf("ETag = %s, want \"menu-1\"", etag)
+				}
+			},
+		},
+		{
+			name: "filtered", handler: (*SpeisekarteHandler).GetItems, method: "GET",
+			target:     "/speisekarte/?category=Hauptgerichte&tags=vegetarisch",
+			wantStatus: http.StatusOK, check: wantNames("Käsespätzle"),
+		},
+		{
+			name: "excluded ingredients and price", handler: (*SpeisekarteHandler).GetItems, method: "GET",
+			target:     "/speisekarte/?exclude_ingredients=Zimt&max_price=1500",
+			wantStatus: http.StatusOK, check: wantNames("Käsespätzle"),
+		},
+		{
+			name: "sorted", handler: (*SpeisekarteHandler).GetItems, method: "GET", target: "/speisekarte/?sort=-price",
+			wantStatus: http.StatusOK, check: wantNames("Wiener Schnitzel", "Käsespätzle", "Apfelstrudel"),
+		},
+		{
+			name: "first page", handler: (*SpeisekarteHandler).GetItems, method: "GET", target: "/speisekarte/?sort=position&limit=2",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				wantNames("Wiener Schnitzel", "Käsespätzle")(t, rec, s)
+				if rec.Header().Get("X-Next-Cursor") == "" || !strings.Contains(rec.Header().Get("Link"), `rel="next"`) {
+					t.Errorf("missing next page headers: %v", rec.Header())
+				}
+			},
+		},
+		{
+			name: "last page", handler: (*SpeisekarteHandler).GetItems, method: "GET",
+			target:     "/speisekarte/?sort=position&limit=2&cursor=" + encodeItemCursor(itemCursor{Sort: "position", Value: json.RawMessage("2"), ID: spaetzleID}),
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				wantNames("Apfelstrudel")(t, rec, s)
+				if next := rec.Header().Get("X-Next-Cursor"); next != "" {
+					t.Errorf("X-Next-Cursor = %q on the last page", next)
+				}
+			},
+		},
+		{
+			name: "selected fields", handler: (*SpeisekarteHandler).GetItems, method: "GET", target: "/speisekarte/?fields=name&seasonal=true",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, _ *memoryStore) {
+				if got := rec.Body.String(); got != `[{"name":"Apfelstrudel"}]`+"\n" {
+					t.Errorf("body = %s", got)
+				}
+			},
+		},
+		{
+			name: "not modified", handler: (*SpeisekarteHandler).GetItems, method: "GET", target: "/speisekarte/",
+			header:     map[string]string{"If-None-Match": `"menu-1"`},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name: "unknown sort key", handler: (*SpeisekarteHandler).GetItems, method: "GET", target: "/speisekarte/?sort=colour",
+			wantStatus: http.StatusBadRequest, wantCode: "validation_failed",
+		},
+		{
+			name: "cursor value of the wrong type", handler: (*SpeisekarteHandler).GetItems, method: "GET",
+			target:     "/speisekarte/?sort=price&limit=1&cursor=" + encodeItemCursor(itemCursor{Sort: "price", Value: json.RawMessage(`"cheap"`), ID: spaetzleID}),
+			wantStatus: http.StatusBadRequest, wantCode: "validation_failed",
+		},
+		{
+			name: "store failure", handler: (*SpeisekarteHandler).GetItems, method: "GET", target: "/speisekarte/",
+			setup: failStore, wantStatus: http.StatusInternalServerError, wantCode: "internal_error",
+		},
+	})
+}
+
+// pendingDrafts adds a draft for each kind of change: Käsespätzle gets
+// dearer, the Schnitzel is removed and Kaiserschmarrn is added.
+func pendingDrafts(s *memoryStore) {
+	spaetzle, schnitzel := spaetzleID, schnitzelID
+	s.drafts = []models.SpeisekarteDraft{
+		{
+			ID: "draft-update", ItemID: &spaetzle, Action: models.DraftActionUpsert, Name: "Käsespätzle",
+			PriceCents: 1390, Categories: []string{"Hauptgerichte"}, Tags: []string{"vegetarisch"},
+		},
+		{ID: "draft-delete", ItemID: &schnitzel, Action: models.DraftActionDelete, Name: "Wiener Schnitzel"},
+		{
+			ID: "draft-create", Action: models.DraftActionUpsert, Name: "Kaiserschmarrn",
+			PriceCents: 990, Categories: []string{"Desserts"}, Tags: []string{"vegetarisch"},
+		},
+	}
+}
+
+// wantPreview checks the names and draft IDs of a preview response.
+func wantPreview(want ...string) func(*testing.T, *httptest.ResponseRecorder, *memoryStore) {
+	return func(t *testing.T, rec *httptest.ResponseRecorder, _ *memoryStore) {
+		t.Helper()
+		var got []string
+		for _, item := range decodeBody[[]previewItem](t, rec) {
+			draftID := "-"
+			if item.DraftID != nil {
+				draftID = *item.DraftID
+			}
+			got = append(got, item.Name+" "+draftID)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("items = %q, want %q", got, want)
+		}
+		if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("Cache-Control = %q, want no-store", cc)
+		}
+	}
+}
+
+func TestPreviewItems(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "drafts applied", handler: (*SpeisekarteHandler).GetItems, method: "GET", target: "/speisekarte/?preview=true",
+			setup: pendingDrafts, wantStatus: http.StatusOK,
+			check: wantPreview("Apfelstrudel -", "Kaiserschmarrn draft-create", "Käsespätzle draft-update"),
+		},
+		{
+			name: "filtered", handler: (*SpeisekarteHandler).GetItems, method: "GET",
+			target: "/speisekarte/?preview=true&tags=vegetarisch&min_price=1000",
+			setup:  pendingDrafts, wantStatus: http.StatusOK,
+			check: wantPreview("Käsespätzle draft-update"),
+		},
+		{
+			name: "sorted and paged", handler: (*SpeisekarteHandler).GetItems, method: "GET",
+			target: "/speisekarte/?preview=true&sort=-price&limit=2",
+			setup:  pendingDrafts, wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				wantPreview("Käsespätzle draft-update", "Kaiserschmarrn draft-create")(t, rec, s)
+				link := rec.Header().Get("Link")
+				if rec.Header().Get("X-Next-Cursor") == "" || !strings.Contains(link, "preview=true") {
+					t.Errorf("missing next page headers: %v", rec.Header())
+				}
+			},
+		},
+		{
+			name: "new item last by position", handler: (*SpeisekarteHandler).GetItems, method: "GET",
+			target: "/speisekarte/?preview=true&sort=-position&limit=1",
+			setup:  pendingDrafts, wantStatus: http.StatusOK,
+			check: wantPreview("Kaiserschmarrn draft-create"),
+		},
+		{
+			name: "not cached", handler: (*SpeisekarteHandler).GetItems, method: "GET", target: "/speisekarte/?preview=true",
+			header:     map[string]string{"If-None-Match": `"menu-1"`},
+			wantStatus: http.StatusOK, check: wantPreview("Apfelstrudel -", "Käsespätzle -", "Wiener Schnitzel -"),
+		},
+		{
+			name: "unknown sort key", handler: (*SpeisekarteHandler).GetItems, method: "GET", target: "/speisekarte/?preview=true&sort=colour",
+			wantStatus: http.StatusBadRequest, wantCode: "validation_failed",
+		},
+		{
+			name: "store failure", handler: (*SpeisekarteHandler).GetItems, method: "GET", target: "/speisekarte/?preview=true",
+			setup: failStore, wantStatus: http.StatusInternalServerError, wantCode: "internal_error",
+		},
+	})
+}
+
+func TestPreviewItemsWithoutUser(t *testing.T) {
+	h := &SpeisekarteHandler{Cache: menucache.New(menucache.DefaultConfig), menu: newMemoryStore(testMenu()...)}
+	rec := httptest.NewRecorder()
+	h.GetItems(rec, httptest.NewRequest("GET", "/speisekarte/?preview=true", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+	}
+}
+
+func TestGetCategories(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "active items only", handler: (*SpeisekarteHandler).GetCategories, method: "GET", target: "/speisekarte/categories",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, _ *memoryStore) {
+				want := []string{"Desserts", "Hauptgerichte"}
+				if got := decodeBody[[]string](t, rec); !slices.Equal(got, want) {
+					t.Errorf("categories = %q, want %q", got, want)
+				}
+				if etag := rec.Header().Get("ETag"); etag != `"categories-1"` {
+					t.Errorf("ETag = %s", etag)
+				}
+			},
+		},
+		{
+			name: "store failure", handler: (*SpeisekarteHandler).GetCategories, method: "GET", target: "/speisekarte/categories",
+			setup: failStore, wantStatus: http.StatusInternalServerError, wantCode: "internal_error",
+		},
+	})
+}
+
+func TestGetUniqueItem(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "found", handler: (*SpeisekarteHandler).GetUniqueItem, method: "GET", target: "/speisekarte/" + strudelID,
+			vars: map[string]string{"id": strudelID}, wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, _ *memoryStore) {
+				if item := decodeBody[models.SpeisekarteItem](t, rec); item.Name != "Apfelstrudel" {
+					t.Errorf("name = %q", item.Name)
+				}
+				if etag := rec.Header().Get("ETag"); etag != `"`+strudelID+`-1"` {
+					t.Errorf("ETag = %s", etag)
+				}
+			},
+		},
+		{
+			name: "not modified", handler: (*SpeisekarteHandler).GetUniqueItem, method: "GET", target: "/speisekarte/" + strudelID,
+			vars: map[string]string{"id": strudelID}, header: map[string]string{"If-None-Match": `"` + strudelID + `-1"`},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name: "missing", handler: (*SpeisekarteHandler).GetUniqueItem, method: "GET", target: "/speisekarte/" + missingID,
+			vars: map[string]string{"id": missingID}, wantStatus: http.StatusNotFound, wantCode: "item_not_found",
+		},
+		{
+			name: "in the trash", handler: (*SpeisekarteHandler).GetUniqueItem, method: "GET", target: "/speisekarte/" + trashedID,
+			vars: map[string]string{"id": trashedID}, wantStatus: http.StatusNotFound, wantCode: "item_not_found",
+		},
+		{
+			name: "store failure", handler: (*SpeisekarteHandler).GetUniqueItem, method: "GET", target: "/speisekarte/" + strudelID,
+			vars: map[string]string{"id": strudelID}, setup: failStore,
+			wantStatus: http.StatusInternalServerError, wantCode: "internal_error",
+		},
+	})
+}
+
+func TestAddItem(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "created", handler: (*SpeisekarteHandler).AddItem, method: "POST", target: "/speisekarte/",
+			body:       `{"name": " Kaiserschmarrn ", "price_cents": 890, "categories": ["Desserts"]}`,
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				item := decodeBody[models.SpeisekarteItem](t, rec)
+				if item.Name != "Kaiserschmarrn" || item.Position != 5 || !item.Available {
+					t.Errorf("created %+v", item)
+				}
+				if loc := rec.Header().Get("Location"); loc != "/speisekarte/"+item.ID {
+					t.Errorf("Location = %q", loc)
+				}
+				wantAudit(1, "create "+item.ID)(t, rec, s)
+			},
+		},
+		{
+			name: "name of a trashed item", handler: (*SpeisekarteHandler).AddItem, method: "POST", target: "/speisekarte/",
+			body:       `{"name": "Gulaschsuppe", "price_cents": 790, "categories": ["Suppen"]}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "duplicate name", handler: (*SpeisekarteHandler).AddItem, method: "POST", target: "/speisekarte/",
+			body:       `{"name": "Apfelstrudel", "price_cents": 690, "categories": ["Desserts"]}`,
+			wantStatus: http.StatusConflict, wantCode: "duplicate_item_name", check: unchanged,
+		},
+		{
+			name: "invalid fields", handler: (*SpeisekarteHandler).AddItem, method: "POST", target: "/speisekarte/",
+			body:       `{"name": "", "price_cents": -1}`,
+			wantStatus: http.StatusBadRequest, wantCode: "validation_failed", check: unchanged,
+		},
+		{
+			name: "form without image", handler: (*SpeisekarteHandler).AddItem, method: "POST", target: "/speisekarte/",
+			header: map[string]string{"Content-Type": "multipart/form-data; boundary=x"},
+			body: "--x\r\nContent-Disposition: form-data; name=\"name\"\r\n\r\nKaiserschmarrn\r\n" +
+				"--x\r\nContent-Disposition: form-data; name=\"price_cents\"\r\n\r\n890\r\n" +
+				"--x\r\nContent-Disposition: form-data; name=\"categories\"\r\n\r\nDesserts\r\n--x--\r\n",
+			wantStatus: http.StatusBadRequest, wantCode: "image_required", check: unchanged,
+		},
+		{
+			name: "store failure", handler: (*SpeisekarteHandler).AddItem, method: "POST", target: "/speisekarte/",
+			body:  `{"name": "Kaiserschmarrn", "price_cents": 890, "categories": ["Desserts"]}`,
+			setup: failStore, wantStatus: http.StatusInternalServerError, wantCode: "internal_error",
+		},
+	})
+}
+
+func TestUpdateItem(t *testing.T) {
+	vars := map[string]string{"id": strudelID}
+	body := `{"name": "Topfenstrudel", "price_cents": 750, "categories": ["Desserts"]}`
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "replaced", handler: (*SpeisekarteHandler).UpdateItem, method: "PUT", target: "/speisekarte/" + strudelID,
+			vars: vars, body: body, wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				item := decodeBody[models.SpeisekarteItem](t, rec)
+				if item.Name != "Topfenstrudel" || item.Version != 2 || item.Seasonal || len(item.Tags) != 0 {
+					t.Errorf("updated %+v", item)
+				}
+				if etag := rec.Header().Get("ETag"); etag != `"`+strudelID+`-2"` {
+					t.Errorf("ETag = %s", etag)
+				}
+				wantAudit(1, "update "+strudelID)(t, rec, s)
+			},
+		},
+		{
+			name: "keeps the image", handler: (*SpeisekarteHandler).UpdateItem, method: "PUT", target: "/speisekarte/" + schnitzelID,
+			vars: map[string]string{"id": schnitzelID}, body: `{"name": "Wiener Schnitzel", "price_cents": 1990, "categories": ["Hauptgerichte"]}`,
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, _ *memoryStore) {
+				if item := decodeBody[models.SpeisekarteItem](t, rec); item.Image == nil {
+					t.Error("image was dropped")
+				}
+			},
+		},
+		{
+			name: "matching If-Match", handler: (*SpeisekarteHandler).UpdateItem, method: "PUT", target: "/speisekarte/" + strudelID,
+			vars: vars, body: body, header: map[string]string{"If-Match": `"` + strudelID + `-1"`},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "stale If-Match", handler: (*SpeisekarteHandler).UpdateItem, method: "PUT", target: "/speisekarte/" + strudelID,
+			vars: vars, body: body, header: map[string]string{"If-Match": `"` + strudelID + `-0"`},
+			wantStatus: http.StatusPreconditionFailed, wantCode: "precondition_failed",
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				if etag := rec.Header().Get("ETag"); etag != `"`+strudelID+`-1"` {
+					t.Errorf("ETag = %s", etag)
+				}
+				unchanged(t, rec, s)
+			},
+		},
+		{
+			name: "duplicate name", handler: (*SpeisekarteHandler).UpdateItem, method: "PUT", target: "/speisekarte/" + strudelID,
+			vars: vars, body: `{"name": "Käsespätzle", "price_cents": 750, "categories": ["Desserts"]}`,
+			wantStatus: http.StatusConflict, wantCode: "duplicate_item_name", check: unchanged,
+		},
+		{
+			name: "missing", handler: (*SpeisekarteHandler).UpdateItem, method: "PUT", target: "/speisekarte/" + missingID,
+			vars: map[string]string{"id": missingID}, body: body,
+			wantStatus: http.StatusNotFound, wantCode: "item_not_found",
+		},
+		{
+			name: "in the trash", handler: (*SpeisekarteHandler).UpdateItem, method: "PUT", target: "/speisekarte/" + trashedID,
+			vars: map[string]string{"id": trashedID}, body: body,
+			wantStatus: http.StatusNotFound, wantCode: "item_not_found",
+		},
+		{
+			name: "invalid fields", handler: (*SpeisekarteHandler).UpdateItem, method: "PUT", target: "/speisekarte/" + strudelID,
+			vars: vars, body: `{"name": "Topfenstrudel", "price_cents": 750, "categories": []}`,
+			wantStatus: http.StatusBadRequest, wantCode: "validation_failed", check: unchanged,
+		},
+	})
+}
+
+func TestPatchItem(t *testing.T) {
+	vars := map[string]string{"id": spaetzleID}
+	patch := map[string]string{"Content-Type": "application/merge-patch+json"}
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "patched", handler: (*SpeisekarteHandler).PatchItem, method: "PATCH", target: "/speisekarte/" + spaetzleID,
+			vars: vars, header: patch, body: `{"price_cents": 1390, "tags": null}`, wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				item := decodeBody[models.SpeisekarteItem](t, rec)
+				if item.PriceCents != 1390 || item.Name != "Käsespätzle" || len(item.Tags) != 0 {
+					t.Errorf("patched %+v", item)
+				}
+				wantAudit(1, "update "+spaetzleID)(t, rec, s)
+			},
+		},
+		{
+			name: "duplicate name", handler: (*SpeisekarteHandler).PatchItem, method: "PATCH", target: "/speisekarte/" + spaetzleID,
+			vars: vars, header: patch, body: `{"name": "Wiener Schnitzel"}`,
+			wantStatus: http.StatusConflict, wantCode: "duplicate_item_name", check: unchanged,
+		},
+		{
+			name: "stale If-Match", handler: (*SpeisekarteHandler).PatchItem, method: "PATCH", target: "/speisekarte/" + spaetzleID,
+			vars: vars, header: map[string]string{"Content-Type": "application/merge-patch+json", "If-Match": `"other"`},
+			body: `{"price_cents": 1390}`, wantStatus: http.StatusPreconditionFailed, wantCode: "precondition_failed", check: unchanged,
+		},
+		{
+			name: "missing", handler: (*SpeisekarteHandler).PatchItem, method: "PATCH", target: "/speisekarte/" + missingID,
+			vars: map[string]string{"id": missingID}, header: patch, body: `{"price_cents": 1390}`,
+			wantStatus: http.StatusNotFound, wantCode: "item_not_found",
+		},
+		{
+			name: "invalid patch", handler: (*SpeisekarteHandler).PatchItem, method: "PATCH", target: "/speisekarte/" + spaetzleID,
+			vars: vars, header: patch, body: `{"price_cents": -5}`,
+			wantStatus: http.StatusBadRequest, wantCode: "validation_failed", check: unchanged,
+		},
+		{
+			name: "not JSON", handler: (*SpeisekarteHandler).PatchItem, method: "PATCH", target: "/speisekarte/" + spaetzleID,
+			vars: vars, header: map[string]string{"Content-Type": "text/plain"}, body: "price_cents=1390",
+			wantStatus: http.StatusUnsupportedMediaType, wantCode: "unsupported_media_type",
+		},
+	})
+}
+
+func TestDeleteItem(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "moved to the trash", handler: (*SpeisekarteHandler).DeleteItem, method: "DELETE", target: "/speisekarte/" + strudelID,
+			vars: map[string]string{"id": strudelID}, wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				if s.items[strudelID].DeletedAt == nil {
+					t.Error("item not in the trash")
+				}
+				wantAudit(1, "delete "+strudelID)(t, rec, s)
+			},
+		},
+		{
+			name: "stale If-Match", handler: (*SpeisekarteHandler).DeleteItem, method: "DELETE", target: "/speisekarte/" + strudelID,
+			vars: map[string]string{"id": strudelID}, header: map[string]string{"If-Match": `"` + strudelID + `-7"`},
+			wantStatus: http.StatusPreconditionFailed, wantCode: "precondition_failed", check: unchanged,
+		},
+		{
+			name: "already in the trash", handler: (*SpeisekarteHandler).DeleteItem, method: "DELETE", target: "/speisekarte/" + trashedID,
+			vars: map[string]string{"id": trashedID}, wantStatus: http.StatusNotFound, wantCode: "item_not_found", check: unchanged,
+		},
+		{
+			name: "store failure", handler: (*SpeisekarteHandler).DeleteItem, method: "DELETE", target: "/speisekarte/" + strudelID,
+			vars: map[string]string{"id": strudelID}, setup: failStore,
+			wantStatus: http.StatusInternalServerError, wantCode: "internal_error",
+		},
+	})
+}
+
+func TestItemImage(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "removed", handler: (*SpeisekarteHandler).DeleteItemImage, method: "DELETE", target: "/speisekarte/" + schnitzelID + "/image",
+			vars: map[string]string{"id": schnitzelID}, wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				if item := decodeBody[models.SpeisekarteItem](t, rec); item.Image != nil || item.Name != "Wiener Schnitzel" {
+					t.Errorf("item %+v", item)
+				}
+				wantAudit(1, "update "+schnitzelID)(t, rec, s)
+			},
+		},
+		{
+			name: "remove from missing item", handler: (*SpeisekarteHandler).DeleteItemImage, method: "DELETE", target: "/speisekarte/" + missingID + "/image",
+			vars: map[string]string{"id": missingID}, wantStatus: http.StatusNotFound, wantCode: "item_not_found",
+		},
+		{
+			name: "upload without form", handler: (*SpeisekarteHandler).UploadItemImage, method: "PUT", target: "/speisekarte/" + schnitzelID + "/image",
+			vars: map[string]string{"id": schnitzelID}, wantStatus: http.StatusBadRequest, wantCode: "invalid_form_data",
+		},
+		{
+			name: "upload without image", handler: (*SpeisekarteHandler).UploadItemImage, method: "PUT", target: "/speisekarte/" + schnitzelID + "/image",
+			vars: map[string]string{"id": schnitzelID}, header: map[string]string{"Content-Type": "multipart/form-data; boundary=x"},
+			body:       "--x\r\nContent-Disposition: form-data; name=\"caption\"\r\n\r\nSchnitzel\r\n--x--\r\n",
+			wantStatus: http.StatusBadRequest, wantCode: "image_required",
+		},
+	})
+}
+
+func TestSetItemAvailability(t *testing.T) {
+	vars := map[string]string{"id": strudelID}
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "available again", handler: (*SpeisekarteHandler).SetItemAvailability, method: "PUT", target: "/speisekarte/" + strudelID + "/availability",
+			vars: vars, body: `{"available": true}`, wantStatus: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				if item := decodeBody[models.SpeisekarteItem](t, rec); !item.Available {
+					t.Error("item still unavailable")
+				}
+				// Availability is operational and takes no snapshot.
+				wantAudit(0, "availability "+strudelID)(t, rec, s)
+			},
+		},
+		{
+			name: "missing field", handler: (*SpeisekarteHandler).SetItemAvailability, method: "PUT", target: "/speisekarte/" + strudelID + "/availability",
+			vars: vars, body: `{}`, wantStatus: http.StatusBadRequest, wantCode: "validation_failed", check: unchanged,
+		},
+		{
+			name: "stale If-Match", handler: (*SpeisekarteHandler).SetItemAvailability, method: "PUT", target: "/speisekarte/" + strudelID + "/availability",
+			vars: vars, body: `{"available": true}`, header: map[string]string{"If-Match": `"` + strudelID + `-2"`},
+			wantStatus: http.StatusPreconditionFailed, wantCode: "precondition_failed", check: unchanged,
+		},
+		{
+			name: "missing", handler: (*SpeisekarteHandler).SetItemAvailability, method: "PUT", target: "/speisekarte/" + missingID + "/availability",
+			vars: map[string]string{"id": missingID}, body: `{"available": false}`,
+			wantStatus: http.StatusNotFound, wantCode: "item_not_found",
+		},
+	})
+}
+
+func TestReorderItems(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "reordered", handler: (*SpeisekarteHandler).ReorderItems, method: "PUT", target: "/speisekarte/positions",
+			body: `{"ids": ["` + strudelID + `"]}`, wantStatus: http.StatusNoContent,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, s *memoryStore) {
+				for id, want := range map[string]int{strudelID: 1, schnitzelID: 2, spaetzleID: 3} {
+					if got := s.items[id].Position; got != want {
+						t.Errorf("position of %s = %d, want %d", s.items[id].Name, got, want)
+					}
+				}
+				wantAudit(0, "reorder positions")(t, rec, s)
+			},
+		},
+		{
+			name: "unknown item", handler: (*SpeisekarteHandler).ReorderItems, method: "PUT", target: "/speisekarte/positions",
+			body: `{"ids": ["` + trashedID + `"]}`, wantStatus: http.StatusBadRequest, wantCode: "validation_failed", check: unchanged,
+		},
+		{
+			name: "duplicate item", handler: (*SpeisekarteHandler).ReorderItems, method: "PUT", target: "/speisekarte/positions",
+			body: `{"ids": ["` + strudelID + `", "` + strudelID + `"]}`, wantStatus: http.StatusBadRequest, wantCode: "validation_failed", check: unchanged,
+		},
+		{
+			name: "no items", handler: (*SpeisekarteHandler).ReorderItems, method: "PUT", target: "/speisekarte/positions",
+			body: `{"ids": []}`, wantStatus: http.StatusBadRequest, wantCode: "validation_failed",
+		},
+		{
+			name: "store failure", handler: (*SpeisekarteHandler).ReorderItems, method: "PUT", target: "/speisekarte/positions",
+			body: `{"ids": ["` + strudelID + `"]}`, setup: failStore,
+			wantStatus: http.StatusInternalServerError, wantCode: "internal_error",
+		},
+	})
+}
+
+func TestCacheStats(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "stats", handler: (*SpeisekarteHandler).CacheStats, method: "GET", target: "/speisekarte/cache/stats",
+			wantStatus: http.StatusOK,
+		},
+	})
+}
+
+// TestWritesInvalidateCache checks that a write through the store is seen
+// by the next read, with a new menu ETag.
+func TestWritesInvalidateCache(t *testing.T) {
+	store := newMemoryStore(testMenu()...)
+	h := &SpeisekarteHandler{Cache: menucache.New(menucache.DefaultConfig), menu: store}
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.GetItems(rec, httptest.NewRequest("GET", "/speisekarte/", nil))
+		return rec
+	}
+	if etag := get().Header().Get("ETag"); etag != `"menu-1"` {
+		t.Fatalf("ETag = %s", etag)
+	}
+
+	req := httptest.NewRequest("DELETE", "/speisekarte/"+strudelID, nil)
+	rec := httptest.NewRecorder()
+	h.DeleteItem(rec, mux.SetURLVars(req, map[string]string{"id": strudelID}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d", rec.Code)
+	}
+
+	rec = get()
+	if etag := rec.Header().Get("ETag"); etag != `"menu-2"` {
+		t.Errorf("ETag after delete = %s, want \"menu-2\"", etag)
+	}
+	wantNames("Käsespätzle", "Wiener Schnitzel")(t, rec, store)
+}
@@ -0,0 +1,434 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/internal/validate"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// itemInput holds the editable fields of a menu item as submitted by a client.
+type itemInput struct {
+	Name        string
+	Description *string
+	PriceCents  int
+	Categories  []string
+	Ingredients []string
+	Tags        []string
+	Seasonal    bool
+}
+
+// itemJSON is the JSON request body for creating or replacing an item.
+// Pointers distinguish missing required fields from zero values.
+type itemJSON struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	PriceCents  *int     `json:"price_cents"`
+	Categories  []string `json:"categories"`
+	Ingredients []string `json:"ingredients"`
+	Tags        []string `json:"tags"`
+	Seasonal    bool     `json:"seasonal"`
+}
+
+// Fields a JSON Merge Patch may change. The image has its own endpoint.
+var patchableFields = map[string]bool{
+	"name":        true,
+	"description": true,
+	"price_cents": true,
+	"categories":  true,
+	"ingredients": true,
+	"tags":        true,
+	"seasonal":    true,
+}
+
+// Item names may contain letters, digits, spaces and punctuation, e.g.
+// "Käsespätzle (vegetarisch)" or "Schnitzel „Wiener Art“ & Pommes".
+var itemNamePattern = regexp.MustCompile(`^[\p{L}\p{M}\p{N}\p{P} &+]+$`)
+
+// checkItemInput normalises in and checks it against the rules every item
+// must satisfy, whether created, replaced, patched or imported. Errors
+// already collected in v are reported along with the rule failures, sorted
+// by field.
+func checkItemInput(v *validate.Validator, in *itemInput) error {
+	v.String("name", &in.Name,
+		validate.Trim,
+		validate.Required,
+		validate.MaxLength(100),
+		validate.NoControl,
+		validate.Matches(itemNamePattern, "letters, digits, spaces and punctuation"),
+	)
+	validate.EmptyToNil(&in.Description)
+	v.OptionalString("description", &in.Description,
+		validate.TrimLines,
+		validate.MaxLength(1000),
+		validate.NoControl,
+	)
+	v.Int("price_cents", in.PriceCents, validate.Min(0), validate.Max(1_000_000))
+	v.Strings("categories", &in.Categories,
+		validate.Compact,
+		validate.MinItems(1),
+		validate.MaxItems(10),
+		validate.Each(validate.MaxLength(50), validate.NoControl),
+	)
+	v.Strings("ingredients", &in.Ingredients,
+		validate.Compact,
+		validate.MaxItems(50),
+		validate.Each(validate.MaxLength(60), validate.NoControl),
+	)
+	v.Strings("tags", &in.Tags,
+		validate.Compact,
+		validate.MaxItems(20),
+		validate.Each(validate.MaxLength(30), validate.NoControl),
+	)
+	return v.Err()
+}
+
+func itemInputFromItem(item models.SpeisekarteItem) itemInput {
+	return itemInput{
+		Name:        item.Name,
+		Description: item.Description,
+		PriceCents:  item.PriceCents,
+		Categories:  item.Categories,
+		Ingredients: item.Ingredients,
+		Tags:        item.Tags,
+		Seasonal:    item.Seasonal,
+	}
+}
+
+// isJSONRequest reports whether the body is JSON, including structured
+// suffixes such as application/merge-patch+json.
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// decodeItemInput reads a full item from either a JSON body or a multipart
+// form, depending on the request's content type.
+func decodeItemInput(r *http.Request) (itemInput, error) {
+	if isJSONRequest(r) {
+		return parseItemJSON(r)
+	}
+	return parseItemForm(r)
+}
+
+var errInvalidBody = problem.New(http.StatusBadRequest, "invalid_request_body", "Invalid request body")
+
+// writeBodyError responds to a request whose JSON body was rejected by
+// validate.DecodeJSON, or was empty or null where a body is required.
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == nil || err == io.EOF {
+		err = errInvalidBody
+	}
+	problem.WriteError(w, r, err)
+}
+
+// parseItemForm reads the item fields from a multipart form. Invalid input
+// is reported as a *problem.Problem.
+func parseItemForm(r *http.Request) (itemInput, error) {
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		return itemInput{}, problem.New(http.StatusBadRequest, "invalid_form_data", "Invalid form data")
+	}
+
+	description := r.FormValue("description")
+	in := itemInput{
+		Name:        r.FormValue("name"),
+		Description: &description,
+		Categories:  r.Form["categories"],
+		Ingredients: r.Form["ingredients"],
+		Tags:        r.Form["tags"],
+		Seasonal:    r.FormValue("seasonal") == "true",
+	}
+
+	v := validate.New()
+	priceStr := r.FormValue("price_cents")
+	if priceStr == "" {
+		v.Add("price_cents", "required", "price_cents is required")
+	} else if priceCents, err := strconv.Atoi(priceStr); err != nil {
+		v.Add("price_cents", "invalid_type", "price_cents must be an integer")
+	} else {
+		in.PriceCents = priceCents
+	}
+	if err := checkItemInput(v, &in); err != nil {
+		return itemInput{}, err
+	}
+	return in, nil
+}
+
+// parseItemJSON reads a full item from a JSON body. Omitted lists are
+// replaced with empty ones, as with any full replace.
+func parseItemJSON(r *http.Request) (itemInput, error) {
+	var body itemJSON
+	if err := validate.DecodeJSON(r.Body, &body); err != nil {
+		if err == io.EOF {
+			return itemInput{}, errInvalidBody
+		}
+		return itemInput{}, err
+	}
+	return body.input()
+}
+
+// input checks an item sent as JSON against the item rules.
+func (body itemJSON) input() (itemInput, error) {
+	in := itemInput{
+		Description: body.Description,
+		Categories:  body.Categories,
+		Ingredients: body.Ingredients,
+		Tags:        body.Tags,
+		Seasonal:    body.Seasonal,
+	}
+	v := validate.New()
+	if body.Name != nil {
+		in.Name = *body.Name
+	}
+	if body.PriceCents == nil {
+		v.Add("price_cents", "required", "price_cents is required")
+	} else {
+		in.PriceCents = *body.PriceCents
+	}
+	if err := checkItemInput(v, &in); err != nil {
+		return itemInput{}, err
+	}
+	return in, nil
+}
+
+// applyItemPatch applies a JSON Merge Patch (RFC 7396) to in. Arrays are
+// replaced as a whole, and null removes optional values. The result is
+// validated as a whole, like a full replace.
+func applyItemPatch(in itemInput, patch map[string]json.RawMessage) (itemInput, error) {
+	v := validate.New()
+	for key, raw := range patch {
+		if !patchableFields[key] {
+			v.Add(key, "not_patchable", "field cannot be patched")
+			continue
+		}
+
+		isNull := string(bytes.TrimSpace(raw)) == "null"
+		var err error
+		switch key {
+		case "name":
+			if isNull {
+				v.Add(key, "required", "name cannot be removed")
+				continue
+			}
+			err = json.Unmarshal(raw, &in.Name)
+		case "description":
+			in.Description = nil
+			if !isNull {
+				err = json.Unmarshal(raw, &in.Description)
+			}
+		case "price_cents":
+			if isNull {
+				v.Add(key, "required", "price_cents cannot be removed")
+				continue
+			}
+			err = json.Unmarshal(raw, &in.PriceCents)
+		case "categories", "ingredients", "tags":
+			list := map[string]*[]string{
+				"categories":  &in.Categories,
+				"ingredients": &in.Ingredients,
+				"tags":        &in.Tags,
+			}[key]
+			*list = []string{}
+			if !isNull {
+				err = json.Unmarshal(raw, list)
+			}
+		case "seasonal":
+			in.Seasonal = false
+			if !isNull {
+				err = json.Unmarshal(raw, &in.Seasonal)
+			}
+		}
+		if err != nil {
+			v.Add(key, "invalid_type", fmt.Sprintf("invalid value for %s", key))
+		}
+	}
+
+	if err := checkItemInput(v, &in); err != nil {
+		return itemInput{}, err
+	}
+	return in, nil
+}
+
+// uploadOptionalImage uploads the form's image if one was sent. It writes the
+// error response itself and returns ok=false if the upload fails.
+func (h *SpeisekarteHandler) uploadOptionalImage(w http.ResponseWriter, r *http.Request) (url *string, ok bool) {
+	file, handler, err := r.FormFile("image")
+	if err != nil || file == nil {
+		return nil, true
+	}
+	defer file.Close()
+
+	uploaded, err := h.Images.Upload(r.Context(), file, handler)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Image upload failed", "err", err)
+		problem.Internal(w, r)
+		return nil, false
+	}
+	return &uploaded, true
+}
+
+// discardUpload deletes an image uploaded for a change that was not saved,
+// so that it isn't left in storage. It does nothing if url is nil.
+func (h *SpeisekarteHandler) discardUpload(r *http.Request, url *string) {
+	if url == nil {
+		return
+	}
+	// The request may already be cancelled; the cleanup should still run.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
+	defer cancel()
+	if err := h.Images.Delete(ctx, *url); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to delete unused image", "url", *url, "err", err)
+	}
+}
+
+// isUniqueViolation reports whether err is a duplicate key. Live item names
+// are kept unique by an exclusion constraint, which reports its own code.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "23505" || pgErr.Code == "23P01")
+}
+
+// isMissingRow reports whether err means the row asked for doesn't exist.
+// An id that isn't valid for its column, such as a malformed UUID, can't
+// name a row either; Postgres rejects it with invalid_text_representation.
+func isMissingRow(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.Is(err, pgx.ErrNoRows) || errors.As(err, &pgErr) && pgErr.Code == "22P02"
+}
+
+// deferNameCheck makes tx check that live item names are unique when it
+// commits rather than after every statement, so items can swap names.
+func deferNameCheck(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `SET CONSTRAINTS speisekarte_active_name_key DEFERRED`)
+	return err
+}
+
+// lockMenu takes the menu_state row lock that the menu triggers take on
+// every change to speisekarte. Write transactions take it before locking
+// any item, so two writers never hold an item each other's triggers wait for.
+func lockMenu(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `SELECT 1 FROM menu_state FOR UPDATE`)
+	return err
+}
+
+// listActiveItems returns every non-trashed item ordered by name.
+func listActiveItems(ctx context.Context, q querier) ([]models.SpeisekarteItem, error) {
+	return queryItems(ctx, q, `SELECT `+itemColumns+` FROM speisekarte WHERE deleted_at IS NULL ORDER BY name`)
+}
+
+// lockActiveItems is listActiveItems, locking the rows until tx ends.
+func lockActiveItems(ctx context.Context, tx pgx.Tx) ([]models.SpeisekarteItem, error) {
+	return queryItems(ctx, tx, `SELECT `+itemColumns+` FROM speisekarte WHERE deleted_at IS NULL ORDER BY name FOR UPDATE`)
+}
+
+func queryItems(ctx context.Context, q querier, sql string) ([]models.SpeisekarteItem, error) {
+	rows, err := q.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.SpeisekarteItem{}
+	for rows.Next() {
+		var item models.SpeisekarteItem
+		if err := scanItem(rows, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// lockActiveItem loads a non-trashed item and locks its row until tx ends.
+// It returns pgx.ErrNoRows if there is no such item.
+func lockActiveItem(ctx context.Context, tx pgx.Tx, id string) (models.SpeisekarteItem, error) {
+	var item models.SpeisekarteItem
+	err := scanItem(tx.QueryRow(ctx,
+		`SELECT `+itemColumns+` FROM speisekarte WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id), &item)
+	return item, err
+}
+
+func insertItem(ctx context.Context, tx pgx.Tx, in itemInput, image *string) (models.SpeisekarteItem, error) {
+	query := `INSERT INTO speisekarte (name, description, price_cents, categories, ingredients, tags, image, seasonal)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING ` + itemColumns
+
+	var item models.SpeisekarteItem
+	err := scanItem(tx.QueryRow(
+		ctx,
+		query,
+		in.Name,
+		in.Description,
+		in.PriceCents,
+		in.Categories,
+		in.Ingredients,
+		in.Tags,
+		image,
+		in.Seasonal,
+	), &item)
+	return item, err
+}
+
+func updateItem(ctx context.Context, tx pgx.Tx, id string, in itemInput, image *string) (models.SpeisekarteItem, error) {
+	query := `
+		UPDATE speisekarte
+		SET name = $1,
+			description = $2,
+			price_cents = $3,
+			categories = $4,
+			ingredients = $5,
+			tags = $6,
+			image = $7,
+			seasonal = $8,
+			updated_at = NOW()
+		WHERE id = $9
+		RETURNING ` + itemColumns
+
+	var item models.SpeisekarteItem
+	err := scanItem(tx.QueryRow(
+		ctx,
+		query,
+		in.Name,
+		in.Description,
+		in.PriceCents,
+		in.Categories,
+		in.Ingredients,
+		in.Tags,
+		image,
+		in.Seasonal,
+		id,
+	), &item)
+	return item, err
+}
+
+// trashItem moves an item to the trash; see trash.go for restore and purge.
+func trashItem(ctx context.Context, tx pgx.Tx, id string) (models.SpeisekarteItem, error) {
+	var item models.SpeisekarteItem
+	err := scanItem(tx.QueryRow(ctx,
+		`UPDATE speisekarte SET deleted_at = NOW() WHERE id = $1 RETURNING `+itemColumns, id), &item)
+	return item, err
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+// Errors returned by the stores for the conditions handlers report to
+// clients; any other error is a server failure.
+var (
+	errNotFound      = errors.New("not found")
+	errDuplicateName = errors.New("duplicate item name")
+)
+
+// menuStore is the data access behind the item and category routes and the
+// draft preview. The PostgreSQL implementation is pgxMenuStore.
+//
+// The stores cover what handler tests run against memoryStore. Drafts and
+// publishing, the trash, menu versions, import and export, the audit log,
+// webhooks, search and the event stream keep their SQL in their handlers;
+// they rely on PostgreSQL features such as row locks, full-text search and
+// LISTEN, and are tested end to end in the integration package.
+type menuStore interface {
+	// view runs fn on a consistent, read-only snapshot of the menu.
+	view(ctx context.Context, fn func(menuView) error) error
+	// item returns an item that is not in the trash, or errNotFound.
+	item(ctx context.Context, id string) (models.SpeisekarteItem, error)
+	// update runs fn in a transaction, which is committed if fn returns
+	// nil and rolled back otherwise.
+	update(ctx context.Context, fn func(menuTx) error) error
+}
+
+type menuView interface {
+	// state returns the menu version and the time of the last change.
+	state(ctx context.Context) (int64, time.Time, error)
+	// items lists the items matching q, one more than q.Limit if there is
+	// a next page.
+	items(ctx context.Context, q itemQuery) ([]models.SpeisekarteItem, error)
+	// previewItems is items for the menu as it will look once every
+	// pending draft is published.
+	previewItems(ctx context.Context, q itemQuery) ([]previewItem, error)
+	categories(ctx context.Context) ([]string, error)
+}
+
+// menuTx writes to the menu. Item methods return errNotFound for items that
+// are missing or in the trash, and errDuplicateName if another item has the
+// name.
+type menuTx interface {
+	// lockItem returns an item and keeps others from writing it until the
+	// transaction ends.
+	lockItem(ctx context.Context, id string) (models.SpeisekarteItem, error)
+	insertItem(ctx context.Context, in itemInput, image *string) (models.SpeisekarteItem, error)
+	updateItem(ctx context.Context, id string, in itemInput, image *string) (models.SpeisekarteItem, error)
+	setAvailable(ctx context.Context, id string, available bool) (models.SpeisekarteItem, error)
+	trashItem(ctx context.Context, id string) (models.SpeisekarteItem, error)
+	// lockPositions returns the position of every item, keyed by id.
+	lockPositions(ctx context.Context) (map[string]int, error)
+	// reorder moves ids to the front in the given order, keeps the others
+	// in their previous order and returns the positions that changed.
+	reorder(ctx context.Context, ids []string) (map[string]int, error)
+	recordAudit(ctx context.Context, actor auditActor, action, entityID string, before, after any) error
+	// snapshot records the menu as a new version.
+	snapshot(ctx context.Context, actor auditActor) error
+}
+
+// userStore is the data access behind login. The PostgreSQL implementation
+// is pgxUserStore.
+type userStore interface {
+	// userByEmail returns the user with the address, or errNotFound.
+	userByEmail(ctx context.Context, email string) (models.User, error)
+}
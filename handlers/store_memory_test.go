@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+// memoryStore is an in-memory menuStore and userStore for handler tests.
+// It follows the behaviour of the database: item versions and the menu
+// version are bumped on every write, positions are appended and names are
+// unique among the items not in the trash.
+type memoryStore struct {
+	mu    sync.Mutex
+	items map[string]models.SpeisekarteItem
+	users map[string]models.User
+	// drafts are the pending drafts that previewItems applies.
+	drafts    []models.SpeisekarteDraft
+	version   int64
+	updatedAt time.Time
+	now       time.Time
+	nextID    int
+
+	// audit lists the committed audit entries as "action entity-id".
+	audit     []string
+	snapshots int
+
+	// err, if set, is returned by every call to simulate a database outage.
+	err error
+}
+
+func newMemoryStore(items ...models.SpeisekarteItem) *memoryStore {
+	s := &memoryStore{
+		items:     make(map[string]models.SpeisekarteItem),
+		users:     make(map[string]models.User),
+		version:   1,
+		updatedAt: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		now:       time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+	for _, item := range items {
+		if item.Version == 0 {
+			item.Version = 1
+		}
+		s.items[item.ID] = item
+	}
+	return s
+}
+
+// tick advances the store's clock, so each write gets a distinct time.
+func (s *memoryStore) tick() time.Time {
+	s.now = s.now.Add(time.Second)
+	return s.now
+}
+
+func (s *memoryStore) view(ctx context.Context, fn func(menuView) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return fn(memoryView{s: s})
+}
+
+func (s *memoryStore) item(ctx context.Context, id string) (models.SpeisekarteItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return models.SpeisekarteItem{}, s.err
+	}
+	item, ok := s.items[id]
+	if !ok || item.DeletedAt != nil {
+		return models.SpeisekarteItem{}, errNotFound
+	}
+	return item, nil
+}
+
+func (s *memoryStore) update(ctx context.Context, fn func(menuTx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+
+	tx := &memoryTx{s: s, items: maps.Clone(s.items)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.items = tx.items
+	s.audit = append(s.audit, tx.audit...)
+	s.snapshots += tx.snapshots
+	if tx.changed {
+		s.version++
+		s.updatedAt = s.now
+	}
+	return nil
+}
+
+func (s *memoryStore) userByEmail(ctx context.Context, email string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return models.User{}, s.err
+	}
+	user, ok := s.users[email]
+	if !ok {
+		return models.User{}, errNotFound
+	}
+	return user, nil
+}
+
+// memoryView reads the store; the view holds its lock.
+type memoryView struct {
+	s *memoryStore
+}
+
+func (v memoryView) state(ctx context.Context) (int64, time.Time, error) {
+	return v.s.version, v.s.updatedAt, nil
+}
+
+func (v memoryView) items(ctx context.Context, q itemQuery) ([]models.SpeisekarteItem, error) {
+	return pageItems(q, slices.Collect(maps.Values(v.s.items)))
+}
+
+// previewItems applies the drafts the way previewSource does.
+func (v memoryView) previewItems(ctx context.Context, q itemQuery) ([]previewItem, error) {
+	items := maps.Clone(v.s.items)
+	draftIDs := make(map[string]*string)
+	position := 0
+	for _, item := range items {
+		position = max(position, item.Position)
+	}
+	for _, d := range v.s.drafts {
+		item := models.SpeisekarteItem{ID: d.ID, Available: true, CreatedAt: d.CreatedAt, Version: 1}
+		if d.ItemID != nil {
+			item = items[*d.ItemID]
+			if d.Action == models.DraftActionDelete {
+				delete(items, item.ID)
+				continue
+			}
+		} else {
+			position++
+			item.Position = position
+		}
+		item.Name, item.Description, item.PriceCents = d.Name, d.Description, d.PriceCents
+		item.Categories, item.Ingredients, item.Tags = d.Categories, d.Ingredients, d.Tags
+		item.Image, item.Seasonal, item.UpdatedAt = d.Image, d.Seasonal, d.UpdatedAt
+		items[item.ID] = item
+		draftIDs[item.ID] = &d.ID
+	}
+
+	page, err := pageItems(q, slices.Collect(maps.Values(items)))
+	if err != nil {
+		return nil, err
+	}
+	preview := []previewItem{}
+	for _, item := range page {
+		preview = append(preview, previewItem{SpeisekarteItem: item, DraftID: draftIDs[item.ID]})
+	}
+	return preview, nil
+}
+
+// pageItems filters, sorts and pages all the way itemQuery.sql does.
+func pageItems(q itemQuery, all []models.SpeisekarteItem) ([]models.SpeisekarteItem, error) {
+	var cursor any
+	if q.Cursor != nil {
+		var err error
+		if cursor, err = q.cursorValue(); err != nil {
+			return nil, err
+		}
+	}
+
+	order := func(a, b models.SpeisekarteItem) int {
+		c := cmp.Or(compareSortValues(itemSortValue(q.Sort, a), itemSortValue(q.Sort, b)), strings.Compare(a.ID, b.ID))
+		if q.Desc {
+			return -c
+		}
+		return c
+	}
+
+	var items []models.SpeisekarteItem
+	for _, item := range all {
+		if item.DeletedAt != nil || !matchesItemQuery(q, item) {
+			continue
+		}
+		if q.Cursor != nil {
+			c := cmp.Or(compareSortValues(itemSortValue(q.Sort, item), cursor), strings.Compare(item.ID, q.Cursor.ID))
+			if q.Desc {
+				c = -c
+			}
+			if c <= 0 {
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+	slices.SortFunc(items, order)
+	if q.Limit > 0 && len(items) > q.Limit+1 {
+		items = items[:q.Limit+1]
+	}
+	return items, nil
+}
+
+func (v memoryView) categories(ctx context.Context) ([]string, error) {
+	var categories []string
+	for _, item := range v.s.items {
+		if item.DeletedAt == nil {
+			categories = append(categories, item.Categories...)
+		}
+	}
+	slices.Sort(categories)
+	return slices.Compact(categories), nil
+}
+
+// matchesItemQuery applies the filters of q the way itemQuery.sql does.
+func matchesItemQuery(q itemQuery, item models.SpeisekarteItem) bool {
+	containsAll := func(have, want []string) bool {
+		for _, w := range want {
+			if !slices.Contains(have, w) {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case q.Category != "" && !slices.Contains(item.Categories, q.Category):
+		return false
+	case !containsAll(item.Tags, q.Tags), !containsAll(item.Ingredients, q.Ingredients):
+		return false
+	case slices.ContainsFunc(q.ExcludeIngredients, func(i string) bool { return slices.Contains(item.Ingredients, i) }):
+		return false
+	case q.MinPrice != nil && item.PriceCents < *q.MinPrice, q.MaxPrice != nil && item.PriceCents > *q.MaxPrice:
+		return false
+	case q.Seasonal != nil && item.Seasonal != *q.Seasonal, q.Available != nil && item.Available != *q.Available:
+		return false
+	}
+	return true
+}
+
+func itemSortValue(sort string, item models.SpeisekarteItem) any {
+	switch sort {
+	case "price":
+		return item.PriceCents
+	case "position":
+		return item.Position
+	case "created_at":
+		return item.CreatedAt
+	}
+	return item.Name
+}
+
+func compareSortValues(a, b any) int {
+	switch a := a.(type) {
+	case int:
+		return cmp.Compare(a, b.(int))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+// memoryTx works on a copy of the items that update keeps only if the
+// transaction succeeds.
+type memoryTx struct {
+	s         *memoryStore
+	items     map[string]models.SpeisekarteItem
+	audit     []string
+	snapshots int
+	changed   bool
+}
+
+func (t *memoryTx) active(id string) (models.SpeisekarteItem, error) {
+	item, ok := t.items[id]
+	if !ok || item.DeletedAt != nil {
+		return models.SpeisekarteItem{}, errNotFound
+	}
+	return item, nil
+}
+
+func (t *memoryTx) nameTaken(name, exceptID string) bool {
+	for _, item := range t.items {
+		if item.DeletedAt == nil && item.Name == name && item.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// save stores item as a write to it, bumping its version.
+func (t *memoryTx) save(item models.SpeisekarteItem) models.SpeisekarteItem {
+	item.Version++
+	t.items[item.ID] = item
+	t.changed = true
+	return item
+}
+
+func (t *memoryTx) lockItem(ctx context.Context, id string) (models.SpeisekarteItem, error) {
+	return t.active(id)
+}
+
+func (t *memoryTx) insertItem(ctx context.Context, in itemInput, image *string) (models.SpeisekarteItem, error) {
+	if t.nameTaken(in.Name, "") {
+		return models.SpeisekarteItem{}, errDuplicateName
+	}
+	position := 0
+	for _, item := range t.items {
+		position = max(position, item.Position)
+	}
+	t.s.nextID++
+	now := t.s.tick()
+	item := models.SpeisekarteItem{
+		ID:        fmt.Sprintf("00000000-0000-4000-8000-%012d", t.s.nextID),
+		Image:     image,
+		Available: true,
+		Position:  position + 1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	applyItemInput(&item, in)
+	return t.save(item), nil
+}
+
+func (t *memoryTx) updateItem(ctx context.Context, id string, in itemInput, image *string) (models.SpeisekarteItem, error) {
+	item, err := t.active(id)
+	if err != nil {
+		return item, err
+	}
+	if t.nameTaken(in.Name, id) {
+		return models.SpeisekarteItem{}, errDuplicateName
+	}
+	applyItemInput(&item, in)
+	item.Image = image
+	item.UpdatedAt = t.s.tick()
+	return t.save(item), nil
+}
+
+func applyItemInput(item *models.SpeisekarteItem, in itemInput) {
+	item.Name = in.Name
+	item.Description = in.Description
+	item.PriceCents = in.PriceCents
+	item.Categories = in.Categories
+	item.Ingredients = in.Ingredients
+	item.Tags = in.Tags
+	item.Seasonal = in.Seasonal
+}
+
+func (t *memoryTx) setAvailable(ctx context.Context, id string, available bool) (models.SpeisekarteItem, error) {
+	item, err := t.active(id)
+	if err != nil {
+		return item, err
+	}
+	item.Available = available
+	item.UpdatedAt = t.s.tick()
+	return t.save(item), nil
+}
+
+func (t *memoryTx) trashItem(ctx context.Context, id string) (models.SpeisekarteItem, error) {
+	item, err := t.active(id)
+	if err != nil {
+		return item, err
+	}
+	now := t.s.tick()
+	item.DeletedAt = &now
+	return t.save(item), nil
+}
+
+func (t *memoryTx) lockPositions(ctx context.Context) (map[string]int, error) {
+	positions := make(map[string]int)
+	for id, item := range t.items {
+		if item.DeletedAt == nil {
+			positions[id] = item.Position
+		}
+	}
+	return positions, nil
+}
+
+func (t *memoryTx) reorder(ctx context.Context, ids []string) (map[string]int, error) {
+	rank := func(id string) int {
+		if i := slices.Index(ids, id); i >= 0 {
+			return i
+		}
+		return len(ids)
+	}
+	var active []models.SpeisekarteItem
+	for _, item := range t.items {
+		if item.DeletedAt == nil {
+			active = append(active, item)
+		}
+	}
+	slices.SortFunc(active, func(a, b models.SpeisekarteItem) int {
+		return cmp.Or(cmp.Compare(rank(a.ID), rank(b.ID)), cmp.Compare(a.Position, b.Position), strings.Compare(a.ID, b.ID))
+	})
+
+	changed := make(map[string]int)
+	for i, item := range active {
+		if item.Position != i+1 {
+			item.Position = i + 1
+			t.save(item)
+			changed[item.ID] = item.Position
+		}
+	}
+	return changed, nil
+}
+
+func (t *memoryTx) recordAudit(ctx context.Context, actor auditActor, action, entityID string, before, after any) error {
+	t.audit = append(t.audit, action+" "+entityID)
+	return nil
+}
+
+func (t *memoryTx) snapshot(ctx context.Context, actor auditActor) error {
+	t.snapshots++
+	return nil
+}
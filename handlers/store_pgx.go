@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pgxMenuStore keeps the menu in the speisekarte table. Its writes run in a
+// single transaction together with their audit entries and menu snapshots.
+type pgxMenuStore struct {
+	db *pgxpool.Pool
+}
+
+// storeError translates the pgx errors handlers care about.
+func storeError(err error) error {
+	switch {
+	case isMissingRow(err):
+		return errNotFound
+	case isUniqueViolation(err):
+		return errDuplicateName
+	}
+	return err
+}
+
+func (s pgxMenuStore) view(ctx context.Context, fn func(menuView) error) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	return fn(pgxMenuView{tx: tx})
+}
+
+func (s pgxMenuStore) item(ctx context.Context, id string) (models.SpeisekarteItem, error) {
+	var item models.SpeisekarteItem
+	err := scanItem(s.db.QueryRow(ctx, `SELECT `+itemColumns+` FROM speisekarte WHERE id = $1 AND deleted_at IS NULL`, id), &item)
+	return item, storeError(err)
+}
+
+func (s pgxMenuStore) update(ctx context.Context, fn func(menuTx) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := lockMenu(ctx, tx); err != nil {
+		return fmt.Errorf("failed to lock menu: %w", err)
+	}
+
+	if err := fn(pgxMenuTx{tx: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+type pgxMenuView struct {
+	tx pgx.Tx
+}
+
+func (v pgxMenuView) state(ctx context.Context) (int64, time.Time, error) {
+	var version int64
+	var updatedAt time.Time
+	err := v.tx.QueryRow(ctx, `SELECT version, updated_at FROM menu_state`).Scan(&version, &updatedAt)
+	return version, updatedAt, err
+}
+
+func (v pgxMenuView) items(ctx context.Context, q itemQuery) ([]models.SpeisekarteItem, error) {
+	query, args, err := q.sql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := v.tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.SpeisekarteItem
+	for rows.Next() {
+		var item models.SpeisekarteItem
+		if err := scanItem(rows, &item); err != nil {
+			logging.FromContext(ctx).Error("Row scan failed", "err", err)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// previewSource is the menu as it will be once every pending draft is
+// published: the live items without drafts, the items with drafted edits
+// applied, leaving out drafted deletions, and the drafted new items after
+// all others. It has the columns of speisekarte and the draft_id of the
+// draft that changes an item.
+const previewSource = `(
+	SELECT s.id, s.name, s.description, s.price_cents, s.categories, s.ingredients, s.tags, s.image, s.seasonal,
+		s.available, s.position, s.created_at, s.updated_at, s.deleted_at, s.version, NULL::uuid AS draft_id
+	FROM speisekarte s
+	WHERE NOT EXISTS (SELECT 1 FROM speisekarte_drafts d WHERE d.item_id = s.id)
+	UNION ALL
+	SELECT s.id, d.name, d.description, d.price_cents, d.categories, d.ingredients, d.tags, d.image, d.seasonal,
+		s.available, s.position, s.created_at, d.updated_at, s.deleted_at, s.version, d.id
+	FROM speisekarte s
+	JOIN speisekarte_drafts d ON d.item_id = s.id AND d.action = 'upsert'
+	UNION ALL
+	SELECT d.id, d.name, d.description, d.price_cents, d.categories, d.ingredients, d.tags, d.image, d.seasonal,
+		true, ((SELECT COALESCE(MAX(position), 0) FROM speisekarte) + ROW_NUMBER() OVER (ORDER BY d.created_at, d.id))::integer,
+		d.created_at, d.updated_at, NULL, 1, d.id
+	FROM speisekarte_drafts d
+	WHERE d.item_id IS NULL
+) AS preview`
+
+func (v pgxMenuView) previewItems(ctx context.Context, q itemQuery) ([]previewItem, error) {
+	query, args, err := q.sqlFrom(previewSource, itemColumns+", draft_id")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := v.tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []previewItem{}
+	for rows.Next() {
+		var item previewItem
+		if err := rows.Scan(append(itemFields(&item.SpeisekarteItem), &item.DraftID)...); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (v pgxMenuView) categories(ctx context.Context) ([]string, error) {
+	rows, err := v.tx.Query(ctx,
+		"SELECT DISTINCT unnest(categories) AS category FROM speisekarte WHERE deleted_at IS NULL ORDER BY category")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []string
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			logging.FromContext(ctx).Error("Row scan failed", "err", err)
+			continue
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+type pgxMenuTx struct {
+	tx pgx.Tx
+}
+
+func (t pgxMenuTx) lockItem(ctx context.Context, id string) (models.SpeisekarteItem, error) {
+	item, err := lockActiveItem(ctx, t.tx, id)
+	return item, storeError(err)
+}
+
+func (t pgxMenuTx) insertItem(ctx context.Context, in itemInput, image *string) (models.SpeisekarteItem, error) {
+	item, err := insertItem(ctx, t.tx, in, image)
+	return item, storeError(err)
+}
+
+func (t pgxMenuTx) updateItem(ctx context.Context, id string, in itemInput, image *string) (models.SpeisekarteItem, error) {
+	item, err := updateItem(ctx, t.tx, id, in, image)
+	return item, storeError(err)
+}
+
+func (t pgxMenuTx) setAvailable(ctx context.Context, id string, available bool) (models.SpeisekarteItem, error) {
+	var item models.SpeisekarteItem
+	err := scanItem(t.tx.QueryRow(ctx,
+		`UPDATE speisekarte SET available = $1, updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL RETURNING `+itemColumns,
+		available, id), &item)
+	return item, storeError(err)
+}
+
+func (t pgxMenuTx) trashItem(ctx context.Context, id string) (models.SpeisekarteItem, error) {
+	item, err := trashItem(ctx, t.tx, id)
+	return item, storeError(err)
+}
+
+func (t pgxMenuTx) lockPositions(ctx context.Context) (map[string]int, error) {
+	rows, err := t.tx.Query(ctx, `SELECT id, position FROM speisekarte WHERE deleted_at IS NULL FOR UPDATE`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock items: %w", err)
+	}
+	defer rows.Close()
+
+	positions := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var position int
+		if err := rows.Scan(&id, &position); err != nil {
+			return nil, err
+		}
+		positions[id] = position
+	}
+	return positions, rows.Err()
+}
+
+func (t pgxMenuTx) reorder(ctx context.Context, ids []string) (map[string]int, error) {
+	rows, err := t.tx.Query(ctx,
+		`WITH wanted AS (
+			SELECT id, ord FROM unnest($1::uuid[]) WITH ORDINALITY AS t(id, ord)
+		), ranked AS (
+			SELECT s.id, ROW_NUMBER() OVER (ORDER BY w.ord NULLS LAST, s.position, s.id) AS n
+			FROM speisekarte s LEFT JOIN wanted w ON w.id = s.id
+			WHERE s.deleted_at IS NULL
+		)
+		UPDATE speisekarte s SET position = ranked.n
+		FROM ranked
+		WHERE s.id = ranked.id AND s.position <> ranked.n
+		RETURNING s.id, s.position`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reorder items: %w", err)
+	}
+	defer rows.Close()
+
+	changed := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var position int
+		if err := rows.Scan(&id, &position); err != nil {
+			return nil, err
+		}
+		changed[id] = position
+	}
+	return changed, rows.Err()
+}
+
+func (t pgxMenuTx) recordAudit(ctx context.Context, actor auditActor, action, entityID string, before, after any) error {
+	if err := recordAudit(ctx, t.tx, actor, action, auditEntityItem, entityID, before, after); err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+func (t pgxMenuTx) snapshot(ctx context.Context, actor auditActor) error {
+	if _, err := snapshotMenu(ctx, t.tx, actor, versionReasonChange, nil); err != nil {
+		return fmt.Errorf("failed to snapshot menu: %w", err)
+	}
+	return nil
+}
+
+// pgxUserStore reads users from the users table.
+type pgxUserStore struct {
+	db *pgxpool.Pool
+}
+
+func (s pgxUserStore) userByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	err := s.db.QueryRow(
+		ctx,
+		"SELECT id, email, password_hash FROM users WHERE email=$1",
+		email,
+	).Scan(&user.ID, &user.Email, &user.PasswordHash)
+	return user, storeError(err)
+}
@@ -0,0 +1,706 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/internal/validate"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	maxImportSize = 10 << 20 // 10MB
+
+	// Separates list entries (categories, ingredients, tags) in CSV and XLSX cells.
+	listSeparator = "|"
+
+	formatCSV  = "csv"
+	formatJSON = "json"
+	formatXLSX = "xlsx"
+
+	importActionCreate    = "create"
+	importActionUpdate    = "update"
+	importActionDelete    = "delete"
+	importActionUnchanged = "unchanged"
+
+	versionReasonImport = "import"
+)
+
+var transferColumns = []string{"id", "name", "description", "price_cents", "categories", "ingredients", "tags", "image", "seasonal"}
+
+var formatContentTypes = map[string]string{
+	formatCSV:  "text/csv",
+	formatJSON: "application/json",
+	formatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// importRecord is one item as read from an import file, before it is matched
+// against the live menu.
+type importRecord struct {
+	Row    int
+	ID     string
+	Input  itemInput
+	Image  *string
+	Errors []string
+}
+
+// importJSONItem mirrors models.SpeisekarteItem but keeps price_cents
+// optional so a missing price can be reported instead of read as 0.
+type importJSONItem struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description *string  `json:"description"`
+	PriceCents  *int     `json:"price_cents"`
+	Categories  []string `json:"categories"`
+	Ingredients []string `json:"ingredients"`
+	Tags        []string `json:"tags"`
+	Image       *string  `json:"image"`
+	Seasonal    bool     `json:"seasonal"`
+
+	// Read-only fields written by Export. They are accepted so an export can
+	// be imported again, and ignored.
+	Available json.RawMessage `json:"available"`
+	Position  json.RawMessage `json:"position"`
+	CreatedAt json.RawMessage `json:"created_at"`
+	UpdatedAt json.RawMessage `json:"updated_at"`
+	DeletedAt json.RawMessage `json:"deleted_at"`
+	Version   json.RawMessage `json:"version"`
+}
+
+type importRowResult struct {
+	Row    int      `json:"row,omitempty"`
+	Action string   `json:"action"`
+	ID     string   `json:"id,omitempty"`
+	Name   string   `json:"name"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type importSummary struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Deleted   int `json:"deleted"`
+	Unchanged int `json:"unchanged"`
+	Errors    int `json:"errors"`
+}
+
+type importReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Applied bool              `json:"applied"`
+	Summary importSummary     `json:"summary"`
+	Rows    []importRowResult `json:"rows"`
+}
+
+// Export downloads the live menu as CSV, JSON or XLSX (?format=, default csv).
+func (h *SpeisekarteHandler) Export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatCSV
+	}
+	if _, ok := formatContentTypes[format]; !ok {
+		problem.Error(w, r, http.StatusBadRequest, "unsupported_export_format", "Unsupported export format")
+		return
+	}
+
+	items, err := listActiveItems(r.Context(), h.DB)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Database query failed", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := encodeExport(&buf, items, format); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode export", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	filename := fmt.Sprintf("speisekarte-%s.%s", time.Now().Format("2006-01-02"), format)
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		logging.FromContext(r.Context()).Error("Error writing export response", "err", err)
+	}
+}
+
+// encodeExport writes items to w in format, which Import reads back.
+func encodeExport(w io.Writer, items []models.SpeisekarteItem, format string) error {
+	switch format {
+	case formatJSON:
+		return json.NewEncoder(w).Encode(items)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(transferColumns); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := cw.Write(exportRecord(item)); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case formatXLSX:
+		return writeXLSX(w, items)
+	}
+	return fmt.Errorf("unsupported export format %q", format)
+}
+
+func exportRecord(item models.SpeisekarteItem) []string {
+	var description, image string
+	if item.Description != nil {
+		description = *item.Description
+	}
+	if item.Image != nil {
+		image = *item.Image
+	}
+	return []string{
+		item.ID,
+		item.Name,
+		description,
+		strconv.Itoa(item.PriceCents),
+		strings.Join(item.Categories, listSeparator),
+		strings.Join(item.Ingredients, listSeparator),
+		strings.Join(item.Tags, listSeparator),
+		image,
+		strconv.FormatBool(item.Seasonal),
+	}
+}
+
+func writeXLSX(w io.Writer, items []models.SpeisekarteItem) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "Speisekarte"
+	if err := f.SetSheetName(f.GetSheetName(0), sheet); err != nil {
+		return err
+	}
+
+	header := make([]any, len(transferColumns))
+	for i, c := range transferColumns {
+		header[i] = c
+	}
+	if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+		return err
+	}
+	for i, item := range items {
+		record := exportRecord(item)
+		row := make([]any, len(record))
+		for j, v := range record {
+			row[j] = v
+		}
+		// Keep prices numeric so they can be edited as numbers.
+		row[3] = item.PriceCents
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			return err
+		}
+	}
+	return f.Write(w)
+}
+
+// Import creates and updates items from a CSV, JSON or XLSX file. Rows are
+// matched to live items by id, or by name when id is empty. With
+// ?delete_missing=true live items absent from the file are deleted. With
+// ?dry_run=true nothing is written and only the report is returned. The
+// import is applied in a single transaction, so any invalid row leaves the
+// menu unchanged.
+func (h *SpeisekarteHandler) Import(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dryRun := q.Get("dry_run") == "true"
+	deleteMissing := q.Get("delete_missing") == "true"
+
+	data, format, err := readImportFile(w, r)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid_import_file", err.Error())
+		return
+	}
+
+	records, err := parseImport(data, format)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid_import_file", err.Error())
+		return
+	}
+
+	// A dry run only reads the menu, so it takes no locks that would hold up
+	// other writers.
+	var tx pgx.Tx
+	var live []models.SpeisekarteItem
+	if dryRun {
+		live, err = listActiveItems(r.Context(), h.DB)
+	} else {
+		tx, err = h.DB.Begin(r.Context())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+			problem.Internal(w, r)
+			return
+		}
+		defer tx.Rollback(r.Context())
+		if err = lockMenu(r.Context(), tx); err == nil {
+			live, err = lockActiveItems(r.Context(), tx)
+		}
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to load menu", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	plan := planImport(records, live, deleteMissing)
+	report := importReport{DryRun: dryRun, Summary: plan.summary(), Rows: plan.results}
+
+	if report.Summary.Errors > 0 {
+		p := problem.New(http.StatusUnprocessableEntity, "import_invalid_rows", "Some rows of the import are invalid")
+		problem.Write(w, r, p.With("report", report))
+		return
+	}
+	if dryRun {
+		writeImportReport(w, r, http.StatusOK, report)
+		return
+	}
+
+	if err := plan.apply(r.Context(), tx, actorFromRequest(r)); err != nil {
+		if isUniqueViolation(err) {
+			problem.Error(w, r, http.StatusConflict, "duplicate_item_name", "Import would create a duplicate item name")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to apply import", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if _, err := snapshotMenu(r.Context(), tx, actorFromRequest(r), versionReasonImport, nil); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to snapshot menu", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	// Names are checked when the import commits.
+	if err := tx.Commit(r.Context()); err != nil {
+		if isUniqueViolation(err) {
+			problem.Error(w, r, http.StatusConflict, "duplicate_item_name", "Import would create a duplicate item name")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to commit import", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	h.Cache.Invalidate()
+	report.Applied = true
+	writeImportReport(w, r, http.StatusOK, report)
+}
+
+func writeImportReport(w http.ResponseWriter, r *http.Request, status int, report importReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding import report", "err", err)
+	}
+}
+
+// readImportFile accepts the file either as a multipart "file" field or as the
+// raw request body. The format comes from ?format=, the file extension or the
+// content type, in that order.
+func readImportFile(w http.ResponseWriter, r *http.Request) ([]byte, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	format := r.URL.Query().Get("format")
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var src io.Reader = r.Body
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			return nil, "", errors.New("Invalid form data")
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", errors.New("File is required")
+		}
+		defer file.Close()
+		src = file
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+		if format == "" {
+			mediaType, _, _ = mime.ParseMediaType(header.Header.Get("Content-Type"))
+		}
+	}
+
+	if format == "" {
+		for f, contentType := range formatContentTypes {
+			if mediaType == contentType {
+				format = f
+			}
+		}
+	}
+	if _, ok := formatContentTypes[format]; !ok {
+		return nil, "", errors.New("Unsupported import format, expected csv, json or xlsx")
+	}
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, "", errors.New("Failed to read import file")
+	}
+	return data, format, nil
+}
+
+func parseImport(data []byte, format string) ([]importRecord, error) {
+	switch format {
+	case formatJSON:
+		var items []importJSONItem
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&items); err != nil {
+			return nil, fmt.Errorf("Invalid JSON: %v", err)
+		}
+		records := make([]importRecord, 0, len(items))
+		for i, item := range items {
+			rec := importRecord{
+				Row: i + 1,
+				ID:  strings.TrimSpace(item.ID),
+				Input: itemInput{
+					Name:        strings.TrimSpace(item.Name),
+					Categories:  item.Categories,
+					Ingredients: item.Ingredients,
+					Tags:        item.Tags,
+					Seasonal:    item.Seasonal,
+				},
+			}
+			rec.Input.Description = item.Description
+			if item.Image != nil && *item.Image != "" {
+				rec.Image = item.Image
+			}
+			if item.PriceCents == nil {
+				rec.Errors = append(rec.Errors, "price_cents is required")
+			} else {
+				rec.Input.PriceCents = *item.PriceCents
+			}
+			records = append(records, rec)
+		}
+		return records, nil
+
+	case formatCSV:
+		cr := csv.NewReader(bytes.NewReader(data))
+		cr.FieldsPerRecord = -1
+		table, err := cr.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CSV: %v", err)
+		}
+		return parseTable(table)
+
+	case formatXLSX:
+		f, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid XLSX: %v", err)
+		}
+		defer f.Close()
+		table, err := f.GetRows(f.GetSheetName(0))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid XLSX: %v", err)
+		}
+		return parseTable(table)
+	}
+	return nil, errors.New("Unsupported import format")
+}
+
+// parseTable reads rows of cells with a header row naming the columns. Row
+// numbers in the result count the header as row 1, like a spreadsheet.
+func parseTable(table [][]string) ([]importRecord, error) {
+	if len(table) == 0 {
+		return nil, errors.New("Import file is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range table[0] {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"name", "price_cents"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("Missing required column %q", required)
+		}
+	}
+
+	records := make([]importRecord, 0, len(table)-1)
+	for i, cells := range table[1:] {
+		cell := func(column string) string {
+			idx, ok := columns[column]
+			if !ok || idx >= len(cells) {
+				return ""
+			}
+			return strings.TrimSpace(cells[idx])
+		}
+
+		blank := true
+		for _, c := range cells {
+			if strings.TrimSpace(c) != "" {
+				blank = false
+				break
+			}
+		}
+		if blank {
+			continue
+		}
+
+		rec := importRecord{
+			Row: i + 2,
+			ID:  cell("id"),
+			Input: itemInput{
+				Name:        cell("name"),
+				Description: optionalString(cell("description")),
+				Categories:  splitList(cell("categories")),
+				Ingredients: splitList(cell("ingredients")),
+				Tags:        splitList(cell("tags")),
+			},
+		}
+		if image := cell("image"); image != "" {
+			rec.Image = &image
+		}
+
+		if price := cell("price_cents"); price == "" {
+			rec.Errors = append(rec.Errors, "price_cents is required")
+		} else if n, err := strconv.Atoi(price); err != nil {
+			rec.Errors = append(rec.Errors, "price_cents must be a whole number of cents")
+		} else {
+			rec.Input.PriceCents = n
+		}
+
+		if seasonal := cell("seasonal"); seasonal != "" {
+			b, err := strconv.ParseBool(strings.ToLower(seasonal))
+			if err != nil {
+				rec.Errors = append(rec.Errors, "seasonal must be true or false")
+			}
+			rec.Input.Seasonal = b
+		}
+
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	parts := strings.Split(value, listSeparator)
+	list := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// importPlan is the set of changes an import will make, worked out before
+// anything is written.
+type importPlan struct {
+	results []importRowResult
+	creates []importRecord
+	updates []plannedUpdate
+	deletes []models.SpeisekarteItem
+}
+
+type plannedUpdate struct {
+	before models.SpeisekarteItem
+	record importRecord
+}
+
+func planImport(records []importRecord, live []models.SpeisekarteItem, deleteMissing bool) *importPlan {
+	plan := &importPlan{results: []importRowResult{}}
+
+	byID := make(map[string]models.SpeisekarteItem, len(live))
+	byName := make(map[string]models.SpeisekarteItem, len(live))
+	for _, item := range live {
+		byID[item.ID] = item
+		byName[item.Name] = item
+	}
+
+	matched := make(map[string]bool)
+	seenNames := make(map[string]int)
+
+	for _, rec := range records {
+		v := validate.New()
+		checkItemInput(v, &rec.Input)
+
+		result := importRowResult{Row: rec.Row, ID: rec.ID, Name: rec.Input.Name, Errors: rec.Errors}
+		for _, e := range v.Errors() {
+			result.Errors = append(result.Errors, e.Message)
+		}
+		if row, ok := seenNames[rec.Input.Name]; ok && rec.Input.Name != "" {
+			result.Errors = append(result.Errors, fmt.Sprintf("duplicate name, also used in row %d", row))
+		}
+		seenNames[rec.Input.Name] = rec.Row
+
+		var existing models.SpeisekarteItem
+		var found bool
+		if rec.ID != "" {
+			if existing, found = byID[rec.ID]; !found {
+				result.Errors = append(result.Errors, "no live item with this id")
+			}
+		} else {
+			existing, found = byName[rec.Input.Name]
+		}
+
+		if found {
+			result.ID = existing.ID
+			if matched[existing.ID] {
+				result.Errors = append(result.Errors, "item matched by more than one row")
+			}
+			matched[existing.ID] = true
+		}
+
+		switch {
+		case len(result.Errors) > 0:
+			result.Action = ""
+		case !found:
+			result.Action = importActionCreate
+			plan.creates = append(plan.creates, rec)
+		default:
+			want := existing
+			applyImportRecord(&want, rec)
+			if sameItemContent(existing, want) {
+				result.Action = importActionUnchanged
+			} else {
+				result.Action = importActionUpdate
+				plan.updates = append(plan.updates, plannedUpdate{before: existing, record: rec})
+			}
+		}
+		plan.results = append(plan.results, result)
+	}
+
+	// A name may also be taken by a live item that no row matched and that
+	// stays on the menu. Names of matched items are free to be reused, since
+	// their rows rename them too.
+	if !deleteMissing {
+		kept := make(map[string]string)
+		for _, item := range live {
+			if !matched[item.ID] {
+				kept[item.Name] = item.ID
+			}
+		}
+		for i := range plan.results {
+			result := &plan.results[i]
+			id, ok := kept[result.Name]
+			if !ok || result.Action == "" {
+				continue
+			}
+			result.Errors = append(result.Errors, fmt.Sprintf("name is already used by item %s", id))
+			result.Action = ""
+		}
+	}
+
+	if deleteMissing {
+		for _, item := range live {
+			if matched[item.ID] {
+				continue
+			}
+			plan.deletes = append(plan.deletes, item)
+			plan.results = append(plan.results, importRowResult{Action: importActionDelete, ID: item.ID, Name: item.Name})
+		}
+	}
+
+	return plan
+}
+
+// applyImportRecord overwrites item's editable fields with those from rec.
+// An empty image cell keeps the current image.
+func applyImportRecord(item *models.SpeisekarteItem, rec importRecord) {
+	item.Name = rec.Input.Name
+	item.Description = rec.Input.Description
+	item.PriceCents = rec.Input.PriceCents
+	item.Categories = rec.Input.Categories
+	item.Ingredients = rec.Input.Ingredients
+	item.Tags = rec.Input.Tags
+	item.Seasonal = rec.Input.Seasonal
+	if rec.Image != nil {
+		item.Image = rec.Image
+	}
+}
+
+func (p *importPlan) summary() importSummary {
+	var s importSummary
+	for _, r := range p.results {
+		switch {
+		case len(r.Errors) > 0:
+			s.Errors++
+		case r.Action == importActionCreate:
+			s.Created++
+		case r.Action == importActionUpdate:
+			s.Updated++
+		case r.Action == importActionDelete:
+			s.Deleted++
+		case r.Action == importActionUnchanged:
+			s.Unchanged++
+		}
+	}
+	return s
+}
+
+// apply writes the plan in tx. Deletes run first so their names can be
+// reused by created or renamed items, and names are only checked on commit
+// so updated items can swap names.
+func (p *importPlan) apply(ctx context.Context, tx pgx.Tx, actor auditActor) error {
+	if err := deferNameCheck(ctx, tx); err != nil {
+		return err
+	}
+	for _, item := range p.deletes {
+		trashed, err := trashItem(ctx, tx, item.ID)
+		if err != nil {
+			return fmt.Errorf("failed to delete item %s: %w", item.ID, err)
+		}
+		if err := recordAudit(ctx, tx, actor, "delete", auditEntityItem, item.ID, item, trashed); err != nil {
+			return err
+		}
+	}
+
+	for _, u := range p.updates {
+		image := u.before.Image
+		if u.record.Image != nil {
+			image = u.record.Image
+		}
+		after, err := updateItem(ctx, tx, u.before.ID, u.record.Input, image)
+		if err != nil {
+			return fmt.Errorf("failed to update item %q (row %d): %w", u.record.Input.Name, u.record.Row, err)
+		}
+		if err := recordAudit(ctx, tx, actor, "update", auditEntityItem, after.ID, u.before, after); err != nil {
+			return err
+		}
+	}
+
+	for _, rec := range p.creates {
+		created, err := insertItem(ctx, tx, rec.Input, rec.Image)
+		if err != nil {
+			return fmt.Errorf("failed to create item %q (row %d): %w", rec.Input.Name, rec.Row, err)
+		}
+		if err := recordAudit(ctx, tx, actor, "create", auditEntityItem, created.ID, nil, created); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+// liveMenu returns the items of testMenu that are not in the trash.
+func liveMenu() []models.SpeisekarteItem {
+	var live []models.SpeisekarteItem
+	for _, item := range testMenu() {
+		if item.DeletedAt == nil {
+			live = append(live, item)
+		}
+	}
+	return live
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	live := liveMenu()
+	description := "Dünn geklopft, mit \"Preiselbeeren\",\nPommes und Salat"
+	live[0].Description = &description
+
+	for _, format := range []string{formatJSON, formatCSV, formatXLSX} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeExport(&buf, live, format); err != nil {
+				t.Fatalf("export: %v", err)
+			}
+			records, err := parseImport(buf.Bytes(), format)
+			if err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			if len(records) != len(live) {
+				t.Fatalf("imported %d rows, want %d", len(records), len(live))
+			}
+
+			plan := planImport(records, live, true)
+			for _, row := range plan.results {
+				if row.Action != importActionUnchanged || len(row.Errors) > 0 {
+					t.Errorf("row %d (%s): action %q, errors %q; want unchanged", row.Row, row.Name, row.Action, row.Errors)
+				}
+			}
+			if want := (importSummary{Unchanged: len(live)}); plan.summary() != want {
+				t.Errorf("summary = %+v, want %+v", plan.summary(), want)
+			}
+		})
+	}
+}
+
+func TestImportJSONRejectsUnknownFields(t *testing.T) {
+	_, err := parseImport([]byte(`[{"name": "Apfelstrudel", "price_cents": 690, "prize": 1}]`), formatJSON)
+	if err == nil {
+		t.Error("import with a misspelled field succeeded")
+	}
+}
+
+func TestPlanImportNames(t *testing.T) {
+	live := liveMenu()
+	rename := func(id, name string) importRecord {
+		for _, item := range live {
+			if item.ID == id {
+				return importRecord{ID: id, Input: itemInput{
+					Name: name, PriceCents: item.PriceCents, Categories: item.Categories,
+					Ingredients: item.Ingredients, Tags: item.Tags, Seasonal: item.Seasonal,
+				}}
+			}
+		}
+		t.Fatalf("no item %s", id)
+		return importRecord{}
+	}
+
+	t.Run("taken by an item the file keeps", func(t *testing.T) {
+		records := []importRecord{rename(schnitzelID, "Apfelstrudel")}
+		records[0].Row = 1
+		plan := planImport(records, live, false)
+		row := plan.results[0]
+		if row.Action != "" || !slices.Equal(row.Errors, []string{"name is already used by item " + strudelID}) {
+			t.Errorf("row = %+v, want a name conflict on the row", row)
+		}
+	})
+
+	t.Run("freed by a deleted item", func(t *testing.T) {
+		plan := planImport([]importRecord{rename(schnitzelID, "Apfelstrudel")}, live, true)
+		if got := plan.summary(); got != (importSummary{Updated: 1, Deleted: 2}) {
+			t.Errorf("summary = %+v, want one update and two deletes", got)
+		}
+	})
+
+	t.Run("swapped between two rows", func(t *testing.T) {
+		records := []importRecord{rename(schnitzelID, "Käsespätzle"), rename(spaetzleID, "Wiener Schnitzel")}
+		plan := planImport(records, live, false)
+		if got := plan.summary(); got != (importSummary{Updated: 2}) {
+			t.Errorf("summary = %+v, want both items renamed", got)
+		}
+	})
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/gorilla/mux"
+)
+
+func (h *SpeisekarteHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+itemColumns+` FROM speisekarte WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Database query failed", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer rows.Close()
+
+	items := []models.SpeisekarteItem{}
+	for rows.Next() {
+		var item models.SpeisekarteItem
+		if err := scanItem(rows, &item); err != nil {
+			logging.FromContext(r.Context()).Error("Row scan failed", "err", err)
+			continue
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		logging.FromContext(r.Context()).Error("Row iteration error", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding trash response", "err", err)
+	}
+}
+
+func (h *SpeisekarteHandler) RestoreItem(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "missing_item_id", "Missing item ID")
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	if err := lockMenu(r.Context(), tx); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to lock menu", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	var before models.SpeisekarteItem
+	err = scanItem(tx.QueryRow(r.Context(),
+		`SELECT `+itemColumns+` FROM speisekarte WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE`, id), &before)
+	if err != nil {
+		if isMissingRow(err) {
+			problem.Error(w, r, http.StatusNotFound, "item_not_found_in_trash", "Item not found in trash")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to fetch trashed item", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	var nameTaken bool
+	err = tx.QueryRow(r.Context(),
+		`SELECT EXISTS (SELECT 1 FROM speisekarte WHERE name = $1 AND deleted_at IS NULL)`, before.Name).Scan(&nameTaken)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to check item name", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	if nameTaken {
+		problem.Error(w, r, http.StatusConflict, "duplicate_item_name", "An active item with this name already exists")
+		return
+	}
+
+	var restored models.SpeisekarteItem
+	err = scanItem(tx.QueryRow(r.Context(),
+		`UPDATE speisekarte SET deleted_at = NULL, updated_at = NOW() WHERE id = $1 RETURNING `+itemColumns, id), &restored)
+	if err != nil {
+		if isUniqueViolation(err) {
+			problem.Error(w, r, http.StatusConflict, "duplicate_item_name", "An active item with this name already exists")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to restore item", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, actorFromRequest(r), "restore", auditEntityItem, id, before, restored); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to record audit entry", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if _, err := snapshotMenu(r.Context(), tx, actorFromRequest(r), versionReasonChange, nil); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to snapshot menu", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to commit item restore", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	h.Cache.Invalidate()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(restored); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding item response", "err", err)
+	}
+}
+
+func (h *SpeisekarteHandler) PurgeItem(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		problem.Error(w, r, http.StatusBadRequest, "missing_item_id", "Missing item ID")
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	if err := lockMenu(r.Context(), tx); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to lock menu", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	var purged models.SpeisekarteItem
+	err = scanItem(tx.QueryRow(r.Context(),
+		`DELETE FROM speisekarte WHERE id = $1 AND deleted_at IS NOT NULL RETURNING `+itemColumns, id), &purged)
+	if err != nil {
+		if isMissingRow(err) {
+			problem.Error(w, r, http.StatusNotFound, "item_not_found_in_trash", "Item not found in trash")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to purge item", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, actorFromRequest(r), "purge", auditEntityItem, id, purged, nil); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to record audit entry", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to commit item purge", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// PurgeExpiredTrash permanently deletes items that have been in the trash for
+// longer than retention and returns how many were removed.
+func (h *SpeisekarteHandler) PurgeExpiredTrash(ctx context.Context, retention time.Duration) (int, error) {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := lockMenu(ctx, tx); err != nil {
+		return 0, fmt.Errorf("failed to lock menu: %w", err)
+	}
+
+	rows, err := tx.Query(ctx,
+		`DELETE FROM speisekarte WHERE deleted_at < $1 RETURNING `+itemColumns, time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge trash: %w", err)
+	}
+	var purged []models.SpeisekarteItem
+	for rows.Next() {
+		var item models.SpeisekarteItem
+		if err := scanItem(rows, &item); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan purged item: %w", err)
+		}
+		purged = append(purged, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to purge trash: %w", err)
+	}
+
+	for _, item := range purged {
+		if err := recordAudit(ctx, tx, auditActor{}, "purge", auditEntityItem, item.ID, item, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit trash purge: %w", err)
+	}
+	return len(purged), nil
+}
+
+// StartTrashPurger purges expired trash once immediately and then every
+// interval until ctx is cancelled.
+func (h *SpeisekarteHandler) StartTrashPurger(ctx context.Context, retention, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			n, err := h.PurgeExpiredTrash(ctx, retention)
+			if err != nil {
+				slog.Error("Trash purge failed", "err", err)
+			} else if n > 0 {
+				slog.Info("Purged trash", "items", n)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
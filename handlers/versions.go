@@ -0,0 +1,559 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/internal/validate"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	versionColumns = `id, created_at, created_by, reason, label, item_count`
+
+	versionReasonChange   = "change"
+	versionReasonPublish  = "publish"
+	versionReasonManual   = "manual"
+	versionReasonRollback = "rollback"
+
+	auditEntityVersion = "speisekarte_version"
+)
+
+type createVersionRequest struct {
+	Label string `json:"label"`
+}
+
+func scanVersion(row pgx.Row, v *models.MenuVersion) error {
+	return row.Scan(
+		&v.ID,
+		&v.CreatedAt,
+		&v.CreatedBy,
+		&v.Reason,
+		&v.Label,
+		&v.ItemCount,
+	)
+}
+
+// snapshotMenu records the live menu as seen by tx as a new version. Call it
+// after the change it describes so the snapshot includes that change.
+func snapshotMenu(ctx context.Context, tx pgx.Tx, actor auditActor, reason string, label *string) (models.MenuVersion, error) {
+	items, err := listActiveItems(ctx, tx)
+	if err != nil {
+		return models.MenuVersion{}, fmt.Errorf("failed to load menu for snapshot: %w", err)
+	}
+	raw, err := json.Marshal(items)
+	if err != nil {
+		return models.MenuVersion{}, fmt.Errorf("failed to encode menu snapshot: %w", err)
+	}
+
+	var createdBy *string
+	if actor.UserID != "" {
+		createdBy = &actor.UserID
+	}
+
+	var version models.MenuVersion
+	err = scanVersion(tx.QueryRow(ctx,
+		`INSERT INTO speisekarte_versions (created_by, reason, label, item_count, items)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING `+versionColumns,
+		createdBy, reason, label, len(items), raw), &version)
+	if err != nil {
+		return models.MenuVersion{}, fmt.Errorf("failed to insert menu snapshot: %w", err)
+	}
+	return version, nil
+}
+
+func loadVersionItems(ctx context.Context, q querier, id int64) ([]models.SpeisekarteItem, error) {
+	var items []models.SpeisekarteItem
+	if err := q.QueryRow(ctx, `SELECT items FROM speisekarte_versions WHERE id = $1`, id).Scan(&items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func parseVersionID(w http.ResponseWriter, r *http.Request, value string) (int64, bool) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 1 {
+		problem.Error(w, r, http.StatusBadRequest, "invalid_version_id", "Invalid version ID")
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *SpeisekarteHandler) GetVersions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_limit", "Invalid limit")
+			return
+		}
+		limit = min(n, 200)
+	}
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_offset", "Invalid offset")
+			return
+		}
+		offset = n
+	}
+
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+versionColumns+` FROM speisekarte_versions ORDER BY id DESC LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Database query failed", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer rows.Close()
+
+	versions := []models.MenuVersion{}
+	for rows.Next() {
+		var v models.MenuVersion
+		if err := scanVersion(rows, &v); err != nil {
+			logging.FromContext(r.Context()).Error("Row scan failed", "err", err)
+			continue
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		logging.FromContext(r.Context()).Error("Row iteration error", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(versions); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding versions response", "err", err)
+	}
+}
+
+func (h *SpeisekarteHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseVersionID(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var version models.MenuVersion
+	err := h.DB.QueryRow(r.Context(),
+		`SELECT `+versionColumns+`, items FROM speisekarte_versions WHERE id = $1`, id).Scan(
+		&version.ID,
+		&version.CreatedAt,
+		&version.CreatedBy,
+		&version.Reason,
+		&version.Label,
+		&version.ItemCount,
+		&version.Items,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			problem.Error(w, r, http.StatusNotFound, "version_not_found", "Version not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to fetch version", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(version); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding version response", "err", err)
+	}
+}
+
+// CreateVersion takes an on-demand snapshot of the live menu.
+func (h *SpeisekarteHandler) CreateVersion(w http.ResponseWriter, r *http.Request) {
+	var req createVersionRequest
+	if err := validate.DecodeJSON(r.Body, &req); err != nil && err != io.EOF {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	var label *string
+	if req.Label != "" {
+		label = &req.Label
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	version, err := snapshotMenu(r.Context(), tx, actorFromRequest(r), versionReasonManual, label)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to create version", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to commit version", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(version); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding version response", "err", err)
+	}
+}
+
+// DiffVersions compares version "from" with version "to", or with the live
+// menu when "to" is omitted.
+func (h *SpeisekarteHandler) DiffVersions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	fromID, ok := parseVersionID(w, r, q.Get("from"))
+	if !ok {
+		return
+	}
+
+	fromItems, err := loadVersionItems(r.Context(), h.DB, fromID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			problem.Error(w, r, http.StatusNotFound, "version_not_found", "Version not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to fetch version", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	var toID *int64
+	var toItems []models.SpeisekarteItem
+	if v := q.Get("to"); v != "" {
+		id, ok := parseVersionID(w, r, v)
+		if !ok {
+			return
+		}
+		toID = &id
+		toItems, err = loadVersionItems(r.Context(), h.DB, id)
+	} else {
+		toItems, err = listActiveItems(r.Context(), h.DB)
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			problem.Error(w, r, http.StatusNotFound, "version_not_found", "Version not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to fetch version", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	diff, err := diffMenus(fromItems, toItems)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to diff versions", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	diff.From = fromID
+	diff.To = toID
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(diff); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding diff response", "err", err)
+	}
+}
+
+// diffMenus matches items by ID and reports which were added, removed or
+// changed between from and to.
+func diffMenus(from, to []models.SpeisekarteItem) (models.VersionDiff, error) {
+	diff := models.VersionDiff{
+		Added:   []models.SpeisekarteItem{},
+		Removed: []models.SpeisekarteItem{},
+		Changed: []models.ItemChange{},
+	}
+
+	fromByID := make(map[string]models.SpeisekarteItem, len(from))
+	for _, item := range from {
+		fromByID[item.ID] = item
+	}
+	toByID := make(map[string]models.SpeisekarteItem, len(to))
+	for _, item := range to {
+		toByID[item.ID] = item
+	}
+
+	for _, item := range to {
+		old, ok := fromByID[item.ID]
+		if !ok {
+			diff.Added = append(diff.Added, item)
+			continue
+		}
+		changes, err := diffFields(old, item)
+		if err != nil {
+			return diff, err
+		}
+		if len(changes) > 0 {
+			diff.Changed = append(diff.Changed, models.ItemChange{ID: item.ID, Name: item.Name, Changes: changes})
+		}
+	}
+	for _, item := range from {
+		if _, ok := toByID[item.ID]; !ok {
+			diff.Removed = append(diff.Removed, item)
+		}
+	}
+
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Name < diff.Changed[j].Name })
+	return diff, nil
+}
+
+// RollbackToVersion makes the live menu match a version in one transaction:
+// items missing from the version are trashed, and every item in it is
+// restored to its recorded state, even if it has since been purged.
+func (h *SpeisekarteHandler) RollbackToVersion(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseVersionID(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	if err := lockMenu(r.Context(), tx); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to lock menu", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	target, err := loadVersionItems(r.Context(), tx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			problem.Error(w, r, http.StatusNotFound, "version_not_found", "Version not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to fetch version", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	actor := actorFromRequest(r)
+	if err := rollbackMenu(r.Context(), tx, actor, target); err != nil {
+		if isUniqueViolation(err) {
+			problem.Error(w, r, http.StatusConflict, "duplicate_item_name", "Rollback would create a duplicate item name")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to roll back menu", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	label := fmt.Sprintf("Rollback to version %d", id)
+	version, err := snapshotMenu(r.Context(), tx, actor, versionReasonRollback, &label)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to snapshot menu", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, actor, "rollback", auditEntityVersion, strconv.FormatInt(id, 10), nil, version); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to record audit entry", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		if isUniqueViolation(err) {
+			problem.Error(w, r, http.StatusConflict, "duplicate_item_name", "Rollback would create a duplicate item name")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to commit rollback", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	h.Cache.Invalidate()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(version); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding version response", "err", err)
+	}
+}
+
+// rollbackMenu writes target over the live menu in tx. Items may swap names
+// with each other, so names are only checked when tx commits. Positions are
+// restored too, except from versions taken before items had one. Whether an
+// item is sold out isn't part of the menu's history, so items keep their
+// current availability.
+func rollbackMenu(ctx context.Context, tx pgx.Tx, actor auditActor, target []models.SpeisekarteItem) error {
+	if err := deferNameCheck(ctx, tx); err != nil {
+		return err
+	}
+	rows, err := tx.Query(ctx, `SELECT `+itemColumns+` FROM speisekarte FOR UPDATE`)
+	if err != nil {
+		return fmt.Errorf("failed to lock menu: %w", err)
+	}
+	current := make(map[string]models.SpeisekarteItem)
+	for rows.Next() {
+		var item models.SpeisekarteItem
+		if err := scanItem(rows, &item); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan item: %w", err)
+		}
+		current[item.ID] = item
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to lock menu: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(target))
+	for _, item := range target {
+		wanted[item.ID] = true
+	}
+
+	// Trash first so restored items can take back names that are in use.
+	for id, item := range current {
+		if wanted[id] || item.DeletedAt != nil {
+			continue
+		}
+		trashed, err := trashItem(ctx, tx, id)
+		if err != nil {
+			return fmt.Errorf("failed to trash item %s: %w", id, err)
+		}
+		if err := recordAudit(ctx, tx, actor, "delete", auditEntityItem, id, item, trashed); err != nil {
+			return err
+		}
+	}
+
+	for _, want := range target {
+		before, exists := current[want.ID]
+		if exists && before.DeletedAt == nil && sameItemContent(before, want) && samePosition(before, want) {
+			continue
+		}
+
+		var after models.SpeisekarteItem
+		if exists {
+			err = scanItem(tx.QueryRow(ctx,
+				`UPDATE speisekarte
+				 SET name = $1, description = $2, price_cents = $3, categories = $4,
+					 ingredients = $5, tags = $6, image = $7, seasonal = $8,
+					 position = COALESCE(NULLIF($9, 0), position),
+					 deleted_at = NULL, updated_at = NOW()
+				 WHERE id = $10
+				 RETURNING `+itemColumns,
+				want.Name, want.Description, want.PriceCents, want.Categories,
+				want.Ingredients, want.Tags, want.Image, want.Seasonal, want.Position, want.ID), &after)
+		} else {
+			err = scanItem(tx.QueryRow(ctx,
+				`INSERT INTO speisekarte (id, name, description, price_cents, categories, ingredients, tags, image, seasonal, position, created_at)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, 0), $11)
+				 RETURNING `+itemColumns,
+				want.ID, want.Name, want.Description, want.PriceCents, want.Categories,
+				want.Ingredients, want.Tags, want.Image, want.Seasonal, want.Position, want.CreatedAt), &after)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore item %q: %w", want.Name, err)
+		}
+
+		var auditBefore any
+		if exists {
+			auditBefore = before
+		}
+		if err := recordAudit(ctx, tx, actor, "rollback", auditEntityItem, want.ID, auditBefore, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneVersions deletes all but the newest keep menu versions and returns
+// how many were removed. A keep of zero keeps every version.
+func (h *SpeisekarteHandler) PruneVersions(ctx context.Context, keep int) (int, error) {
+	if keep <= 0 {
+		return 0, nil
+	}
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Versions are otherwise immutable; the trigger lets this delete through.
+	if _, err := tx.Exec(ctx, `SET LOCAL gasthaus.prune_versions = 'on'`); err != nil {
+		return 0, fmt.Errorf("failed to allow pruning: %w", err)
+	}
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM speisekarte_versions
+		 WHERE id <= (SELECT id FROM speisekarte_versions ORDER BY id DESC OFFSET $1 LIMIT 1)`, keep)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune menu versions: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit version pruning: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// StartVersionPruner prunes menu versions once immediately and then every
+// interval until ctx is cancelled.
+func (h *SpeisekarteHandler) StartVersionPruner(ctx context.Context, keep int, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			n, err := h.PruneVersions(ctx, keep)
+			if err != nil {
+				slog.Error("Menu version pruning failed", "err", err)
+			} else if n > 0 {
+				slog.Info("Pruned menu versions", "versions", n)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sameItemContent reports whether two items have the same editable fields. A
+// missing description or image counts as empty.
+func sameItemContent(a, b models.SpeisekarteItem) bool {
+	return a.Name == b.Name &&
+		derefString(a.Description) == derefString(b.Description) &&
+		a.PriceCents == b.PriceCents &&
+		slices.Equal(a.Categories, b.Categories) &&
+		slices.Equal(a.Ingredients, b.Ingredients) &&
+		slices.Equal(a.Tags, b.Tags) &&
+		derefString(a.Image) == derefString(b.Image) &&
+		a.Seasonal == b.Seasonal
+}
+
+// samePosition reports whether a has the position recorded in version item
+// b. Versions taken before items had positions record none.
+func samePosition(a, b models.SpeisekarteItem) bool {
+	return b.Position == 0 || a.Position == b.Position
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
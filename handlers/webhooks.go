@@ -0,0 +1,621 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/internal/validate"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// webhookColumns leaves out the secret, which is only shown on creation.
+	webhookColumns  = `id, url, event_types, description, active, created_by, created_at, updated_at`
+	deliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+		last_attempt_at, response_status, last_error, created_at, delivered_at`
+	auditEntityWebhook = "webhook"
+
+	webhookMaxAttempts  = 10
+	webhookBaseBackoff  = 30 * time.Second
+	webhookMaxBackoff   = 6 * time.Hour
+	webhookTimeout      = 10 * time.Second
+	webhookBatchSize    = 10
+	webhookMaxErrorSize = 1 << 10
+	// webhookLease is how long a claimed delivery is hidden from other
+	// dispatchers; a crashed dispatcher's deliveries are retried after it.
+	webhookLease = 2 * time.Minute
+)
+
+// webhookEventTypes are the event types a subscription may ask for. "*"
+// subscribes to all of them.
+var webhookEventTypes = []string{
+	models.EventItemCreated,
+	models.EventItemUpdated,
+	models.EventItemDeleted,
+	models.EventItemAvailabilityChanged,
+	models.EventCategoriesChanged,
+	"*",
+}
+
+type WebhookHandler struct {
+	DB     *pgxpool.Pool
+	Client *http.Client
+}
+
+// webhookInput is the request body for creating or replacing a subscription.
+type webhookInput struct {
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	Description *string  `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+func (in webhookInput) validate() error {
+	var errs []problem.FieldError
+	u, err := url.Parse(in.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, problem.Field("url", "invalid", "url must be an absolute http or https URL"))
+	}
+	if len(in.EventTypes) == 0 {
+		errs = append(errs, problem.Field("event_types", "required", "event_types must not be empty"))
+	}
+	for _, t := range in.EventTypes {
+		if !slices.Contains(webhookEventTypes, t) {
+			errs = append(errs, problem.Field("event_types", "invalid", fmt.Sprintf("unknown event type %q", t)))
+		}
+	}
+	if len(errs) > 0 {
+		return problem.Validation(errs...)
+	}
+	return nil
+}
+
+func decodeWebhookInput(r *http.Request) (webhookInput, error) {
+	var in webhookInput
+	if err := validate.DecodeJSON(r.Body, &in); err != nil {
+		if err == io.EOF {
+			return webhookInput{}, errInvalidBody
+		}
+		return webhookInput{}, err
+	}
+	return in, in.validate()
+}
+
+func scanWebhook(row pgx.Row, s *models.WebhookSubscription) error {
+	return row.Scan(
+		&s.ID,
+		&s.URL,
+		&s.EventTypes,
+		&s.Description,
+		&s.Active,
+		&s.CreatedBy,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+}
+
+func scanDelivery(row pgx.Row, d *models.WebhookDelivery) error {
+	return row.Scan(
+		&d.ID,
+		&d.SubscriptionID,
+		&d.EventID,
+		&d.EventType,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastAttemptAt,
+		&d.ResponseStatus,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	)
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// signWebhook returns the X-Gasthaus-Signature value for a payload sent at
+// timestamp. Receivers recompute it over "<timestamp>.<body>".
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *WebhookHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(r.Context(), `SELECT `+webhookColumns+` FROM webhook_subscriptions ORDER BY created_at`)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Database query failed", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer rows.Close()
+
+	subscriptions := []models.WebhookSubscription{}
+	for rows.Next() {
+		var s models.WebhookSubscription
+		if err := scanWebhook(rows, &s); err != nil {
+			logging.FromContext(r.Context()).Error("Row scan failed", "err", err)
+			continue
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	if err := rows.Err(); err != nil {
+		logging.FromContext(r.Context()).Error("Row iteration error", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, subscriptions)
+}
+
+func (h *WebhookHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	var s models.WebhookSubscription
+	err := scanWebhook(h.DB.QueryRow(r.Context(),
+		`SELECT `+webhookColumns+` FROM webhook_subscriptions WHERE id = $1`, mux.Vars(r)["id"]), &s)
+	if err != nil {
+		if isMissingRow(err) {
+			problem.Error(w, r, http.StatusNotFound, "webhook_not_found", "Webhook not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to fetch webhook", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, s)
+}
+
+// CreateSubscription registers a webhook. The response is the only place
+// the generated signing secret is ever shown.
+func (h *WebhookHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	in, err := decodeWebhookInput(r)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	active := in.Active == nil || *in.Active
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to generate webhook secret", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	actor := actorFromRequest(r)
+	var createdBy *string
+	if actor.UserID != "" {
+		createdBy = &actor.UserID
+	}
+
+	var s models.WebhookSubscription
+	err = scanWebhook(tx.QueryRow(r.Context(),
+		`INSERT INTO webhook_subscriptions (url, secret, event_types, description, active, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+webhookColumns,
+		in.URL, secret, in.EventTypes, in.Description, active, createdBy), &s)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to create webhook", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, actor, "create", auditEntityWebhook, s.ID, nil, s); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to record audit entry", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to commit webhook", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	s.Secret = secret
+	w.Header().Set("Location", "/admin/webhooks/"+s.ID)
+	writeJSON(w, r, http.StatusCreated, s)
+}
+
+func (h *WebhookHandler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	in, err := decodeWebhookInput(r)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var before models.WebhookSubscription
+	err = scanWebhook(tx.QueryRow(r.Context(),
+		`SELECT `+webhookColumns+` FROM webhook_subscriptions WHERE id = $1 FOR UPDATE`, id), &before)
+	if err != nil {
+		if isMissingRow(err) {
+			problem.Error(w, r, http.StatusNotFound, "webhook_not_found", "Webhook not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to fetch webhook", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	active := before.Active
+	if in.Active != nil {
+		active = *in.Active
+	}
+
+	var after models.WebhookSubscription
+	err = scanWebhook(tx.QueryRow(r.Context(),
+		`UPDATE webhook_subscriptions
+		 SET url = $1, event_types = $2, description = $3, active = $4, updated_at = NOW()
+		 WHERE id = $5
+		 RETURNING `+webhookColumns,
+		in.URL, in.EventTypes, in.Description, active, id), &after)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to update webhook", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, actorFromRequest(r), "update", auditEntityWebhook, id, before, after); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to record audit entry", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to commit webhook update", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, after)
+}
+
+// DeleteSubscription removes a webhook together with its delivery log.
+func (h *WebhookHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to begin transaction", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var deleted models.WebhookSubscription
+	err = scanWebhook(tx.QueryRow(r.Context(),
+		`DELETE FROM webhook_subscriptions WHERE id = $1 RETURNING `+webhookColumns, id), &deleted)
+	if err != nil {
+		if isMissingRow(err) {
+			problem.Error(w, r, http.StatusNotFound, "webhook_not_found", "Webhook not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to delete webhook", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, actorFromRequest(r), "delete", auditEntityWebhook, id, deleted, nil); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to record audit entry", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to commit webhook deletion", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns a webhook's delivery log, newest first, optionally
+// filtered by ?status=.
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_limit", "Invalid limit")
+			return
+		}
+		limit = min(n, 200)
+	}
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_offset", "Invalid offset")
+			return
+		}
+		offset = n
+	}
+
+	var status *string
+	if v := q.Get("status"); v != "" {
+		status = &v
+	}
+
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		 WHERE subscription_id = $1 AND ($2::text IS NULL OR status = $2)
+		 ORDER BY id DESC
+		 LIMIT $3 OFFSET $4`,
+		mux.Vars(r)["id"], status, limit, offset)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Database query failed", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			logging.FromContext(r.Context()).Error("Row scan failed", "err", err)
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		if isMissingRow(err) {
+			problem.Error(w, r, http.StatusNotFound, "webhook_not_found", "Webhook not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Row iteration error", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, deliveries)
+}
+
+func (h *WebhookHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	var d models.WebhookDelivery
+	err := scanDelivery(h.DB.QueryRow(r.Context(),
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, mux.Vars(r)["deliveryID"]), &d)
+	if err != nil {
+		if isMissingRow(err) {
+			problem.Error(w, r, http.StatusNotFound, "delivery_not_found", "Delivery not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to fetch delivery", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, d)
+}
+
+// Redeliver queues a new delivery of the same payload. The original entry
+// is kept in the log unchanged.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	var d models.WebhookDelivery
+	err := scanDelivery(h.DB.QueryRow(r.Context(),
+		`INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		 SELECT subscription_id, event_id, event_type, payload FROM webhook_deliveries WHERE id = $1
+		 RETURNING `+deliveryColumns, mux.Vars(r)["deliveryID"]), &d)
+	if err != nil {
+		if isMissingRow(err) {
+			problem.Error(w, r, http.StatusNotFound, "delivery_not_found", "Delivery not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("Failed to queue redelivery", "err", err)
+		problem.Internal(w, r)
+		return
+	}
+
+	writeJSON(w, r, http.StatusAccepted, d)
+}
+
+// claimedDelivery is a due delivery together with where to send it.
+type claimedDelivery struct {
+	ID        int64
+	EventType string
+	Payload   []byte
+	Attempts  int
+	URL       string
+	Secret    string
+}
+
+// dispatchDue sends one batch of due deliveries and reports how many there
+// were. Claiming pushes next_attempt_at past the lease, so concurrent
+// dispatchers on other instances skip them. Deliveries of inactive
+// subscriptions wait until the subscription is active again.
+func (h *WebhookHandler) dispatchDue(ctx context.Context) (int, error) {
+	rows, err := h.DB.Query(ctx,
+		`UPDATE webhook_deliveries d
+		 SET attempts = d.attempts + 1, last_attempt_at = NOW(), next_attempt_at = $1
+		 FROM webhook_subscriptions s
+		 WHERE s.id = d.subscription_id AND s.active AND d.id IN (
+			SELECT due.id FROM webhook_deliveries due
+			JOIN webhook_subscriptions active ON active.id = due.subscription_id AND active.active
+			WHERE due.status = 'pending' AND due.next_attempt_at <= NOW()
+			ORDER BY due.next_attempt_at
+			LIMIT $2
+			FOR UPDATE OF due SKIP LOCKED
+		 )
+		 RETURNING d.id, d.event_type, d.payload, d.attempts, s.url, s.secret`,
+		time.Now().Add(webhookLease), webhookBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim deliveries: %w", err)
+	}
+	claimed, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (claimedDelivery, error) {
+		var c claimedDelivery
+		err := row.Scan(&c.ID, &c.EventType, &c.Payload, &c.Attempts, &c.URL, &c.Secret)
+		return c, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim deliveries: %w", err)
+	}
+
+	for _, c := range claimed {
+		status, sendErr := h.send(ctx, c)
+		if err := h.recordAttempt(ctx, c, status, sendErr); err != nil {
+			slog.Error("Failed to record webhook delivery", "delivery_id", c.ID, "err", err)
+		}
+	}
+	return len(claimed), nil
+}
+
+func (h *WebhookHandler) send(ctx context.Context, c claimedDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(c.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Gasthaus-Webhooks/1.0")
+	req.Header.Set("X-Gasthaus-Event", c.EventType)
+	req.Header.Set("X-Gasthaus-Delivery", strconv.FormatInt(c.ID, 10))
+	req.Header.Set("X-Gasthaus-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Gasthaus-Signature", signWebhook(c.Secret, timestamp, c.Payload))
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxErrorSize))
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+	return resp.StatusCode, nil
+}
+
+// recordAttempt stores the outcome of a delivery attempt and schedules the
+// next one with exponential backoff, or gives up after webhookMaxAttempts.
+func (h *WebhookHandler) recordAttempt(ctx context.Context, c claimedDelivery, status int, sendErr error) error {
+	var responseStatus *int
+	if status != 0 {
+		responseStatus = &status
+	}
+
+	if sendErr == nil {
+		_, err := h.DB.Exec(ctx,
+			`UPDATE webhook_deliveries
+			 SET status = 'succeeded', delivered_at = NOW(), response_status = $2, last_error = NULL
+			 WHERE id = $1`, c.ID, responseStatus)
+		return err
+	}
+
+	message := sendErr.Error()
+	if len(message) > webhookMaxErrorSize {
+		message = message[:webhookMaxErrorSize]
+	}
+	if c.Attempts >= webhookMaxAttempts {
+		slog.Warn("Webhook delivery is dead", "delivery_id", c.ID, "attempts", c.Attempts, "last_error", message)
+		_, err := h.DB.Exec(ctx,
+			`UPDATE webhook_deliveries SET status = 'dead', response_status = $2, last_error = $3 WHERE id = $1`,
+			c.ID, responseStatus, message)
+		return err
+	}
+
+	_, err := h.DB.Exec(ctx,
+		`UPDATE webhook_deliveries SET next_attempt_at = $2, response_status = $3, last_error = $4 WHERE id = $1`,
+		c.ID, time.Now().Add(webhookBackoff(c.Attempts)), responseStatus, message)
+	return err
+}
+
+// webhookBackoff returns the delay after the given number of failed
+// attempts: doubling from webhookBaseBackoff up to webhookMaxBackoff, with
+// up to 20% jitter so failing receivers are not hit in lockstep.
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookMaxBackoff
+	if attempts < 1 {
+		d = webhookBaseBackoff
+	} else if attempts < 20 {
+		d = min(webhookBaseBackoff<<(attempts-1), webhookMaxBackoff)
+	}
+	return d + mathrand.N(d/5+1)
+}
+
+// StartDispatcher sends due webhook deliveries every interval until ctx is
+// cancelled.
+func (h *WebhookHandler) StartDispatcher(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			for {
+				n, err := h.dispatchDue(ctx)
+				if err != nil {
+					slog.Error("Webhook dispatch failed", "err", err)
+				}
+				if err != nil || n < webhookBatchSize {
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding response", "err", err)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"type":"item.created"}`)
+	got := signWebhook("whsec_test", 1760000000, body)
+
+	// What a receiver computes from the headers and the raw body.
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("1760000000." + string(body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("signWebhook = %s, want %s", got, want)
+	}
+
+	digest, ok := strings.CutPrefix(got, "sha256=")
+	if !ok || len(digest) != 64 {
+		t.Errorf("signature %q is not sha256= and 64 hex digits", got)
+	}
+	if other := signWebhook("whsec_test", 1760000001, body); other == got {
+		t.Error("signature does not cover the timestamp")
+	}
+	if other := signWebhook("whsec_other", 1760000000, body); other == got {
+		t.Error("signature does not depend on the secret")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		base     time.Duration
+	}{
+		{attempts: 0, base: webhookBaseBackoff},
+		{attempts: 1, base: webhookBaseBackoff},
+		{attempts: 2, base: 2 * webhookBaseBackoff},
+		{attempts: 5, base: 16 * webhookBaseBackoff},
+		{attempts: 10, base: 512 * webhookBaseBackoff},
+		{attempts: 11, base: webhookMaxBackoff},
+		{attempts: 19, base: webhookMaxBackoff},
+		{attempts: 64, base: webhookMaxBackoff},
+	}
+	for _, tt := range tests {
+		// The jitter is random, so check the bounds repeatedly.
+		for range 100 {
+			d := webhookBackoff(tt.attempts)
+			if d < tt.base || d > tt.base+tt.base/5 {
+				t.Fatalf("webhookBackoff(%d) = %s, want between %s and %s", tt.attempts, d, tt.base, tt.base+tt.base/5)
+			}
+		}
+	}
+}
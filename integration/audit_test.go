@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/client"
+)
+
+func TestAuditFilters(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "auditfilters@example.com")
+	ctx := context.Background()
+
+	var userID string
+	if err := db.Pool.QueryRow(ctx, `SELECT id FROM users WHERE email = $1`, "auditfilters@example.com").Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Second)
+
+	item, err := c.CreateItem(ctx, client.ItemInput{Name: "Prüfpfad", PriceCents: 700, Categories: []string{"Prüfung"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.PatchItem(ctx, item.ID, map[string]any{"price_cents": 750}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteItem(ctx, item.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	mine := &client.AuditFilter{ActorID: userID, EntityType: "speisekarte"}
+	all, err := c.ListAuditEntries(ctx, mine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, e := range all.Entries {
+		actions = append(actions, e.Action)
+		if e.EntityID != item.ID || e.ActorID == nil || *e.ActorID != userID || e.ClientIP == nil {
+			t.Errorf("entry %+v, want it by %s on %s with a client IP", e, userID, item.ID)
+		}
+	}
+	if all.Total != 3 || len(actions) != 3 || actions[0] != "delete" || actions[2] != "create" {
+		t.Errorf("entries = %q (total %d), want delete, update and create, newest first", actions, all.Total)
+	}
+
+	updates, err := c.ListAuditEntries(ctx, &client.AuditFilter{ActorID: userID, Action: "update"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updates.Total != 1 || len(updates.Entries) != 1 || len(updates.Entries[0].Diff) == 0 {
+		t.Errorf("updates = %+v, want the one price change with its diff", updates)
+	}
+
+	page, err := c.ListAuditEntries(ctx, &client.AuditFilter{ActorID: userID, PageOptions: client.PageOptions{Limit: 1, Offset: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 || len(page.Entries) != 1 || page.Entries[0].Action != "update" {
+		t.Errorf("second page = %+v, want the update of 3 entries", page)
+	}
+
+	for _, window := range []client.AuditFilter{
+		{ActorID: userID, Until: start},
+		{ActorID: userID, Since: time.Now().Add(time.Minute)},
+	} {
+		list, err := c.ListAuditEntries(ctx, &window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if list.Total != 0 {
+			t.Errorf("entries outside of the time window: %+v", list.Entries)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gomisroca/gasthaus-backend/client"
+)
+
+func tokenSubject(t *testing.T, token string) string {
+	t.Helper()
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (any, error) { return []byte(jwtSecret), nil })
+	if err != nil {
+		t.Fatalf("invalid token: %v", err)
+	}
+	sub, _ := parsed.Claims.GetSubject()
+	return sub
+}
+
+func TestLoginAndRefresh(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+	userID := createUser(t, "login@example.com", "correct horse")
+
+	c, err := client.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Login(ctx, "login@example.com", "wrong horse"); !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("login with wrong password: %v, want ErrUnauthorized", err)
+	}
+	if err := c.Login(ctx, "nobody@example.com", "correct horse"); !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("login as unknown user: %v, want ErrUnauthorized", err)
+	}
+
+	if err := c.Login(ctx, "login@example.com", "correct horse"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if sub := tokenSubject(t, c.Token()); sub != userID {
+		t.Errorf("token subject = %q, want %q", sub, userID)
+	}
+
+	if err := c.RefreshToken(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if sub := tokenSubject(t, c.Token()); sub != userID {
+		t.Errorf("refreshed token subject = %q, want %q", sub, userID)
+	}
+
+	// The refreshed token is accepted by authenticated routes.
+	if _, err := c.CacheStats(ctx); err != nil {
+		t.Errorf("authenticated request: %v", err)
+	}
+
+	anonymous, err := client.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := anonymous.CacheStats(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("request without token: %v, want ErrUnauthorized", err)
+	}
+}
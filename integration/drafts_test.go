@@ -0,0 +1,320 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/client"
+	"github.com/gomisroca/gasthaus-backend/handlers"
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+// publishDueNow makes a scheduled publication due and runs the scheduler
+// until it is no longer scheduled.
+func publishDueNow(t *testing.T, c *client.Client, id string) models.Publication {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := db.Pool.Exec(ctx, `UPDATE speisekarte_publications SET publish_at = NOW() WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+	handlers.NewSpeisekarteHandler(db.Pool, nil).StartPublicationScheduler(ctx, 10*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		publications, err := c.ListPublications(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range publications {
+			if p.ID == id && p.Status != "scheduled" {
+				return p
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("publication %s was not run", id)
+	return models.Publication{}
+}
+
+func TestFailedPublicationHandsBackDrafts(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "failedpublication@example.com")
+	ctx := context.Background()
+
+	draft, err := c.SaveDraft(ctx, "", client.ItemInput{Name: "Geplant Neu", PriceCents: 900, Categories: []string{"Geplant"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Publish(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The name is taken before the publication runs.
+	if _, err := c.CreateItem(ctx, client.ItemInput{Name: "Geplant Neu", PriceCents: 900, Categories: []string{"Geplant"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	publication := publishDueNow(t, c, result.Publication.ID)
+	if publication.Status != "failed" || publication.Error == nil {
+		t.Errorf("publication = %+v, want it failed with an error", publication)
+	}
+
+	drafts, err := c.ListDrafts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range drafts {
+		if d.ID == draft.ID && d.PublicationID != nil {
+			t.Errorf("draft still belongs to publication %s", *d.PublicationID)
+		}
+	}
+	entries, err := c.ListAuditEntries(ctx, &client.AuditFilter{EntityID: publication.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries.Entries) == 0 || entries.Entries[0].Action != "fail" {
+		t.Errorf("audit entries = %+v, want the failure recorded", entries.Entries)
+	}
+
+	if err := c.DeleteDraft(ctx, draft.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduledDraftsCannotChange(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "scheduleddraft@example.com")
+	ctx := context.Background()
+
+	in := client.ItemInput{Name: "Geplant Alt", PriceCents: 800, Categories: []string{"Geplant"}}
+	item, err := c.CreateItem(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.PriceCents = 850
+	draft, err := c.SaveDraft(ctx, item.ID, in, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Publish(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in.PriceCents = 1
+	if _, err := c.SaveDraft(ctx, item.ID, in, nil); !errors.Is(err, client.ErrConflict) {
+		t.Errorf("replacing a scheduled draft: %v, want ErrConflict", err)
+	}
+	if _, err := c.UpdateDraft(ctx, draft.ID, in, nil); !errors.Is(err, client.ErrConflict) {
+		t.Errorf("editing a scheduled draft: %v, want ErrConflict", err)
+	}
+	if err := c.DeleteDraft(ctx, draft.ID); !errors.Is(err, client.ErrConflict) {
+		t.Errorf("discarding a scheduled draft: %v, want ErrConflict", err)
+	}
+
+	if _, err := c.CancelPublication(ctx, result.Publication.ID); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := c.SaveDraft(ctx, item.ID, in, nil)
+	if err != nil || saved.ID != draft.ID || saved.PriceCents != 1 {
+		t.Errorf("after cancelling, save = %+v, %v; want the draft replaced", saved, err)
+	}
+	if err := c.DeleteDraft(ctx, draft.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPreviewQuery(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "previewquery@example.com")
+	ctx := context.Background()
+
+	kept, err := c.CreateItem(ctx, client.ItemInput{Name: "Vorschau Alt", PriceCents: 500, Categories: []string{"Vorschau"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited, err := c.CreateItem(ctx, client.ItemInput{Name: "Vorschau Teuer", PriceCents: 600, Categories: []string{"Vorschau"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SaveDraft(ctx, edited.ID, client.ItemInput{Name: "Vorschau Teuer", PriceCents: 1600, Categories: []string{"Vorschau"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	created, err := c.SaveDraft(ctx, "", client.ItemInput{Name: "Vorschau Neu", PriceCents: 800, Categories: []string{"Vorschau"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	opts := &client.ListItemsOptions{Category: "Vorschau", Sort: "-price", Limit: 2}
+	for {
+		page, err := c.PreviewItems(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range page.Items {
+			got = append(got, item.Name)
+			if (item.DraftID != nil) == (item.ID == kept.ID) {
+				t.Errorf("%s has draft_id %v", item.Name, item.DraftID)
+			}
+			if item.ID == created.ID && !item.Available {
+				t.Errorf("new item %s is not available", item.Name)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	if want := []string{"Vorschau Teuer", "Vorschau Neu", "Vorschau Alt"}; !slices.Equal(got, want) {
+		t.Errorf("preview = %q, want %q", got, want)
+	}
+}
+
+func TestPublishDrafts(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "publishdrafts@example.com")
+	ctx := context.Background()
+	category := &client.ListItemsOptions{Category: "Entwurf"}
+
+	edited, err := c.CreateItem(ctx, client.ItemInput{Name: "Entwurf Alt", PriceCents: 900, Categories: []string{"Entwurf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := c.CreateItem(ctx, client.ItemInput{Name: "Entwurf Weg", PriceCents: 900, Categories: []string{"Entwurf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit, err := c.SaveDraft(ctx, edited.ID, client.ItemInput{Name: "Entwurf Alt", PriceCents: 950, Categories: []string{"Entwurf"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.UpdateDraft(ctx, edit.ID, client.ItemInput{Name: "Entwurf Neu Benannt", PriceCents: 990, Categories: []string{"Entwurf"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DraftDeletion(ctx, removed.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SaveDraft(ctx, "", client.ItemInput{Name: "Entwurf Hinzu", PriceCents: 700, Categories: []string{"Entwurf"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drafts don't change the live menu until they are published.
+	if got := listNames(t, c, category); !slices.Equal(got, []string{"Entwurf Alt", "Entwurf Weg"}) {
+		t.Errorf("live menu before publishing = %q", got)
+	}
+	result, err := c.Publish(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Published < 3 {
+		t.Errorf("published %d drafts, want at least 3", result.Published)
+	}
+	if got := listNames(t, c, category); !slices.Equal(got, []string{"Entwurf Hinzu", "Entwurf Neu Benannt"}) {
+		t.Errorf("live menu after publishing = %q", got)
+	}
+	if item, err := c.GetItem(ctx, edited.ID); err != nil || item.PriceCents != 990 || item.Version != 2 {
+		t.Errorf("edited item = %+v, %v; want the draft's price at version 2", item, err)
+	}
+
+	drafts, err := c.ListDrafts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range drafts {
+		if d.ItemID != nil && (*d.ItemID == edited.ID || *d.ItemID == removed.ID) {
+			t.Errorf("draft %+v is still pending", d)
+		}
+	}
+}
+
+// TestConcurrentUpdateAndPublish edits items while a publication writes
+// drafts of the same items. Both take the menu lock before any item, so
+// neither may fail with a deadlock.
+func TestConcurrentUpdateAndPublish(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "concurrentpublish@example.com")
+	ctx := context.Background()
+
+	var items []*models.SpeisekarteItem
+	for _, name := range []string{"Gleichzeitig Eins", "Gleichzeitig Zwei"} {
+		item, err := c.CreateItem(ctx, client.ItemInput{Name: name, PriceCents: 500, Categories: []string{"Gleichzeitig"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	input := func(item *models.SpeisekarteItem, price int) client.ItemInput {
+		return client.ItemInput{Name: item.Name, PriceCents: price, Categories: item.Categories}
+	}
+
+	for round := range 20 {
+		for _, item := range items {
+			if _, err := c.SaveDraft(ctx, item.ID, input(item, 600+round), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, len(items)+1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Publish(ctx, time.Time{})
+			errs <- err
+		}()
+		// Updated in the opposite order to the drafts.
+		for _, item := range slices.Backward(items) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.UpdateItem(ctx, item.ID, input(item, 700+round))
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("round %d: %v", round, err)
+			}
+		}
+	}
+}
+
+// TestDraftValidation checks that JSON drafts go through the item rules.
+func TestDraftValidation(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "draftvalidation@example.com")
+	ctx := context.Background()
+
+	invalid := client.ItemInput{Name: "  ", PriceCents: -1, Categories: []string{"Entwurf"}}
+	draft, err := c.SaveDraft(ctx, "", client.ItemInput{Name: "Entwurf Geprüft", PriceCents: 500, Categories: []string{"Entwurf"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.DeleteDraft(ctx, draft.ID) })
+
+	for name, save := range map[string]func() error{
+		"save":   func() error { _, err := c.SaveDraft(ctx, "", invalid, nil); return err },
+		"update": func() error { _, err := c.UpdateDraft(ctx, draft.ID, invalid, nil); return err },
+	} {
+		var apiErr *client.Error
+		if err := save(); !errors.As(err, &apiErr) || apiErr.Code != "validation_failed" {
+			t.Fatalf("%s: err = %v, want a validation error", name, err)
+		}
+		var fields []string
+		for _, f := range apiErr.Errors {
+			fields = append(fields, f.Field)
+		}
+		if !slices.Equal(fields, []string{"name", "price_cents"}) {
+			t.Errorf("%s: rejected fields = %q, want name and price_cents", name, fields)
+		}
+	}
+}
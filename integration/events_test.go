@@ -0,0 +1,81 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/client"
+	"github.com/gomisroca/gasthaus-backend/handlers"
+	"github.com/gomisroca/gasthaus-backend/internal/requestid"
+	"github.com/gomisroca/gasthaus-backend/models"
+	"github.com/gomisroca/gasthaus-backend/routes"
+)
+
+// errDone ends a stream once the expected events arrived.
+var errDone = errors.New("done")
+
+func TestEventStream(t *testing.T) {
+	requireDB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Unlike newServer, this server listens for changes, so its broker
+	// delivers new events.
+	speisekarte := handlers.NewSpeisekarteHandler(db.Pool, nil)
+	speisekarte.StartChangeListener(ctx)
+	srv := httptest.NewServer(requestid.Middleware(routes.NewRouter(db.Pool, speisekarte, &handlers.WebhookHandler{DB: db.Pool}, jwtSecret)))
+	t.Cleanup(srv.Close)
+	t.Cleanup(speisekarte.Events.Close)
+	c := newClient(t, srv, "events@example.com")
+
+	var since int64
+	if err := db.Pool.QueryRow(ctx, `SELECT COALESCE(MAX(id), 0) FROM menu_events`).Scan(&since); err != nil {
+		t.Fatal(err)
+	}
+	// Made before the stream starts, so it is only seen by resuming.
+	missed, err := c.CreateItem(ctx, client.ItemInput{Name: "Ereignis Verpasst", PriceCents: 500, Categories: []string{"Ereignisse"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]string)
+	var live *models.SpeisekarteItem
+	err = c.StreamEvents(ctx, strconv.FormatInt(since, 10), func(ev client.Event) error {
+		if ev.Type == client.EventReset {
+			return errors.New("told to reload instead of resuming")
+		}
+		var event models.MenuEvent
+		if err := json.Unmarshal(ev.Data, &event); err != nil {
+			return err
+		}
+		if ev.ID != strconv.FormatInt(event.ID, 10) {
+			t.Errorf("event id %s, data id %d", ev.ID, event.ID)
+		}
+		if event.ItemID != nil {
+			seen[*event.ItemID] = event.Type
+		}
+		switch {
+		case live == nil && seen[missed.ID] != "":
+			// Caught up; the next change arrives while connected.
+			item, err := c.CreateItem(ctx, client.ItemInput{Name: "Ereignis Live", PriceCents: 500, Categories: []string{"Ereignisse"}})
+			if err != nil {
+				return err
+			}
+			live = item
+		case live != nil && seen[live.ID] != "":
+			return errDone
+		}
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("stream ended with %v; saw %v", err, seen)
+	}
+	if seen[missed.ID] != models.EventItemCreated || seen[live.ID] != models.EventItemCreated {
+		t.Errorf("events = %v, want %s for both items", seen, models.EventItemCreated)
+	}
+}
@@ -0,0 +1,330 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/gomisroca/gasthaus-backend/client"
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+func listNames(t *testing.T, c *client.Client, opts *client.ListItemsOptions) []string {
+	t.Helper()
+	page, err := c.ListItems(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("listing items: %v", err)
+	}
+	var names []string
+	for _, item := range page.Items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+func TestItemLifecycle(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "lifecycle@example.com")
+	ctx := context.Background()
+	category := &client.ListItemsOptions{Category: "Lifecycle"}
+
+	// Create.
+	description := "Mit Speck und Zwiebeln"
+	created, err := c.CreateItem(ctx, client.ItemInput{
+		Name:        "Flammkuchen",
+		Description: &description,
+		PriceCents:  1190,
+		Categories:  []string{"Lifecycle"},
+		Ingredients: []string{"Speck", "Zwiebeln"},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if created.Version != 1 || !created.Available || created.PriceCents != 1190 || created.Position == 0 {
+		t.Errorf("created %+v", created)
+	}
+
+	var priceCents int
+	err = db.Pool.QueryRow(ctx, `SELECT price_cents FROM speisekarte WHERE id = $1`, created.ID).Scan(&priceCents)
+	if err != nil || priceCents != 1190 {
+		t.Errorf("stored price_cents = %d, %v", priceCents, err)
+	}
+
+	_, err = c.CreateItem(ctx, client.ItemInput{Name: "Flammkuchen", PriceCents: 990, Categories: []string{"Lifecycle"}})
+	if !errors.Is(err, client.ErrConflict) {
+		t.Errorf("create with duplicate name: %v, want ErrConflict", err)
+	}
+
+	// Read.
+	got, err := c.GetItem(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Name != "Flammkuchen" || got.Description == nil || *got.Description != description {
+		t.Errorf("got %+v", got)
+	}
+	if names := listNames(t, c, category); !slices.Equal(names, []string{"Flammkuchen"}) {
+		t.Errorf("items in category = %q", names)
+	}
+	categories, err := c.Categories(ctx)
+	if err != nil || !slices.Contains(categories, "Lifecycle") {
+		t.Errorf("categories = %q, %v", categories, err)
+	}
+
+	// Update, with and without a current ETag.
+	updated, err := c.UpdateItem(ctx, created.ID, client.ItemInput{
+		Name:       "Elsässer Flammkuchen",
+		PriceCents: 1290,
+		Categories: []string{"Lifecycle"},
+	}, client.IfUnchanged(*created))
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.Version != 2 || updated.Description != nil || len(updated.Ingredients) != 0 {
+		t.Errorf("updated %+v", updated)
+	}
+
+	_, err = c.PatchItem(ctx, created.ID, map[string]any{"price_cents": 1390}, client.IfUnchanged(*created))
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrPreconditionFailed) {
+		t.Fatalf("patch with stale ETag: %v, want ErrPreconditionFailed", err)
+	}
+	var current models.SpeisekarteItem
+	if ok, err := apiErr.Extension("current", &current); !ok || err != nil || current.Version != 2 {
+		t.Errorf("current item of the 412 = %+v, %v", current, err)
+	}
+
+	patched, err := c.PatchItem(ctx, created.ID, map[string]any{"price_cents": 1390}, client.IfUnchanged(*updated))
+	if err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	if patched.PriceCents != 1390 || patched.Name != "Elsässer Flammkuchen" || patched.Version != 3 {
+		t.Errorf("patched %+v", patched)
+	}
+
+	sold, err := c.SetItemAvailability(ctx, created.ID, false)
+	if err != nil {
+		t.Fatalf("availability: %v", err)
+	}
+	if sold.Available {
+		t.Error("item still available")
+	}
+	available := false
+	if names := listNames(t, c, &client.ListItemsOptions{Category: "Lifecycle", Available: &available}); len(names) != 1 {
+		t.Errorf("sold out items in category = %q", names)
+	}
+
+	// Delete, restore and purge.
+	if err := c.DeleteItem(ctx, created.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := c.GetItem(ctx, created.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("get deleted item: %v, want ErrNotFound", err)
+	}
+	if err := c.DeleteItem(ctx, created.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("delete twice: %v, want ErrNotFound", err)
+	}
+	if names := listNames(t, c, category); len(names) != 0 {
+		t.Errorf("items in category after delete = %q", names)
+	}
+
+	if _, err := c.RestoreItem(ctx, created.ID); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if _, err := c.GetItem(ctx, created.ID); err != nil {
+		t.Errorf("get restored item: %v", err)
+	}
+
+	if err := c.DeleteItem(ctx, created.ID); err != nil {
+		t.Fatalf("delete again: %v", err)
+	}
+	if err := c.PurgeItem(ctx, created.ID); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	trash, err := c.ListTrash(ctx)
+	if err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+	for _, item := range trash {
+		if item.ID == created.ID {
+			t.Error("purged item still in the trash")
+		}
+	}
+
+	// Every write was audited in its transaction.
+	audit, err := c.ListAuditEntries(ctx, &client.AuditFilter{EntityID: created.ID})
+	if err != nil {
+		t.Fatalf("audit: %v", err)
+	}
+	var actions []string
+	for _, entry := range audit.Entries {
+		actions = append(actions, entry.Action)
+	}
+	for _, want := range []string{"create", "update", "availability", "delete"} {
+		if !slices.Contains(actions, want) {
+			t.Errorf("audit actions %q lack %q", actions, want)
+		}
+	}
+}
+
+func TestItemPaging(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "paging@example.com")
+	ctx := context.Background()
+
+	for i, name := range []string{"Brezel", "Obatzda", "Weißwurst"} {
+		in := client.ItemInput{Name: name, PriceCents: 300 + 100*i, Categories: []string{"Paging"}}
+		if _, err := c.CreateItem(ctx, in); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	opts := &client.ListItemsOptions{Category: "Paging", Sort: "-price", Limit: 2}
+	first, err := c.ListItems(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Items) != 2 || first.Items[0].Name != "Weißwurst" || first.NextCursor == "" {
+		t.Fatalf("first page = %+v", first)
+	}
+
+	opts.Cursor = first.NextCursor
+	second, err := c.ListItems(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Items) != 1 || second.Items[0].Name != "Brezel" || second.NextCursor != "" {
+		t.Errorf("second page = %+v", second)
+	}
+}
+
+// TestItemQuery runs every filter, sort key and a cursor through the SQL
+// that GET /speisekarte/ builds.
+func TestItemQuery(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "itemquery@example.com")
+	ctx := context.Background()
+
+	for _, in := range []client.ItemInput{
+		{Name: "Abfrage Apfel", PriceCents: 500, Ingredients: []string{"Äpfel", "Zimt"}, Tags: []string{"vegetarisch"}, Seasonal: true},
+		{Name: "Abfrage Braten", PriceCents: 1800, Ingredients: []string{"Schwein", "Kümmel"}},
+		{Name: "Abfrage Käse", PriceCents: 1200, Ingredients: []string{"Käse", "Zwiebeln"}, Tags: []string{"vegetarisch"}},
+		{Name: "Abfrage Suppe", PriceCents: 800, Ingredients: []string{"Zwiebeln"}, Tags: []string{"vegan", "vegetarisch"}},
+	} {
+		in.Categories = []string{"Abfrage"}
+		item, err := c.CreateItem(ctx, in)
+		if err != nil {
+			t.Fatalf("create %s: %v", in.Name, err)
+		}
+		if in.Name == "Abfrage Braten" {
+			if _, err := c.SetItemAvailability(ctx, item.ID, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	price := func(n int) *int { return &n }
+	yes, no := true, false
+	filters := []struct {
+		name string
+		opts client.ListItemsOptions
+		want []string
+	}{
+		{name: "tag", opts: client.ListItemsOptions{Tags: []string{"vegetarisch"}}, want: []string{"Abfrage Apfel", "Abfrage Käse", "Abfrage Suppe"}},
+		{name: "all tags", opts: client.ListItemsOptions{Tags: []string{"vegan", "vegetarisch"}}, want: []string{"Abfrage Suppe"}},
+		{name: "ingredient", opts: client.ListItemsOptions{Ingredients: []string{"Zwiebeln"}}, want: []string{"Abfrage Käse", "Abfrage Suppe"}},
+		{name: "all ingredients", opts: client.ListItemsOptions{Ingredients: []string{"Käse", "Zwiebeln"}}, want: []string{"Abfrage Käse"}},
+		{name: "excluded ingredients", opts: client.ListItemsOptions{ExcludeIngredients: []string{"Zwiebeln", "Zimt"}}, want: []string{"Abfrage Braten"}},
+		{name: "min price", opts: client.ListItemsOptions{MinPrice: price(800)}, want: []string{"Abfrage Braten", "Abfrage Käse", "Abfrage Suppe"}},
+		{name: "max price", opts: client.ListItemsOptions{MaxPrice: price(800)}, want: []string{"Abfrage Apfel", "Abfrage Suppe"}},
+		{name: "seasonal", opts: client.ListItemsOptions{Seasonal: &yes}, want: []string{"Abfrage Apfel"}},
+		{name: "unavailable", opts: client.ListItemsOptions{Available: &no}, want: []string{"Abfrage Braten"}},
+	}
+	for _, tt := range filters {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Category = "Abfrage"
+			if got := listNames(t, c, &tt.opts); !slices.Equal(got, tt.want) {
+				t.Errorf("items = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Every sort key in both directions, read one item per page so each
+	// cursor goes back into the query.
+	byCreation := []string{"Abfrage Apfel", "Abfrage Braten", "Abfrage Käse", "Abfrage Suppe"}
+	sorts := map[string][]string{
+		"name":       byCreation,
+		"price":      {"Abfrage Apfel", "Abfrage Suppe", "Abfrage Käse", "Abfrage Braten"},
+		"created_at": byCreation,
+		"position":   byCreation,
+	}
+	for key, want := range sorts {
+		for _, desc := range []bool{false, true} {
+			sort := key
+			if desc {
+				sort = "-" + key
+				want = slices.Clone(want)
+				slices.Reverse(want)
+			}
+			t.Run("sort "+sort, func(t *testing.T) {
+				opts := &client.ListItemsOptions{Category: "Abfrage", Sort: sort, Limit: 1}
+				var got []string
+				for range len(want) + 1 {
+					page, err := c.ListItems(ctx, opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, item := range page.Items {
+						got = append(got, item.Name)
+					}
+					if page.NextCursor == "" {
+						break
+					}
+					opts.Cursor = page.NextCursor
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("items = %q, want %q", got, want)
+				}
+			})
+		}
+	}
+
+	t.Run("fields", func(t *testing.T) {
+		page, err := c.ListItems(ctx, &client.ListItemsOptions{Category: "Abfrage", Seasonal: &yes, Fields: []string{"name", "price_cents"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []models.SpeisekarteItem{{Name: "Abfrage Apfel", PriceCents: 500}}
+		if len(page.Items) != 1 || page.Items[0].Name != want[0].Name || page.Items[0].PriceCents != want[0].PriceCents ||
+			page.Items[0].ID != "" || page.Items[0].Ingredients != nil {
+			t.Errorf("items = %+v, want only name and price of %+v", page.Items, want)
+		}
+	})
+}
+
+func TestItemMalformedIDs(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "itemids@example.com")
+	ctx := context.Background()
+	const id = "not-a-uuid"
+	in := client.ItemInput{Name: "Ungültig", PriceCents: 100, Categories: []string{"Ungültig"}}
+
+	checks := map[string]error{}
+	_, checks["get"] = c.GetItem(ctx, id)
+	_, checks["update"] = c.UpdateItem(ctx, id, in)
+	_, checks["patch"] = c.PatchItem(ctx, id, map[string]any{"price_cents": 200})
+	_, checks["availability"] = c.SetItemAvailability(ctx, id, false)
+	_, checks["delete image"] = c.DeleteItemImage(ctx, id)
+	checks["delete"] = c.DeleteItem(ctx, id)
+	_, checks["restore"] = c.RestoreItem(ctx, id)
+	checks["purge"] = c.PurgeItem(ctx, id)
+	_, checks["update draft"] = c.UpdateDraft(ctx, id, in, nil)
+	checks["delete draft"] = c.DeleteDraft(ctx, id)
+	_, checks["cancel publication"] = c.CancelPublication(ctx, id)
+	for name, err := range checks {
+		if !errors.Is(err, client.ErrNotFound) {
+			t.Errorf("%s: err = %v, want not found", name, err)
+		}
+	}
+}
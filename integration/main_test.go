@@ -0,0 +1,92 @@
+// Package integration runs the API end to end against a real PostgreSQL
+// database; see internal/testdb for how to point it at a server. Without one
+// the tests are skipped.
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gomisroca/gasthaus-backend/client"
+	"github.com/gomisroca/gasthaus-backend/handlers"
+	"github.com/gomisroca/gasthaus-backend/internal/requestid"
+	"github.com/gomisroca/gasthaus-backend/internal/testdb"
+	"github.com/gomisroca/gasthaus-backend/routes"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const jwtSecret = "integration-secret"
+
+// db is the package's database, shared by all tests. Tests use their own
+// users and item names so they don't depend on each other.
+var (
+	db      *testdb.DB
+	dbError error
+)
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	db, dbError = testdb.New(ctx)
+	if dbError != nil && !errors.Is(dbError, testdb.ErrUnavailable) {
+		fmt.Fprintln(os.Stderr, dbError)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	if db != nil {
+		if err := db.Close(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+func requireDB(t *testing.T) {
+	t.Helper()
+	if db == nil {
+		t.Skip(dbError)
+	}
+}
+
+// newServer serves the full router on the test database.
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	requireDB(t)
+	speisekarte := handlers.NewSpeisekarteHandler(db.Pool, nil)
+	webhooks := &handlers.WebhookHandler{DB: db.Pool}
+	srv := httptest.NewServer(requestid.Middleware(routes.NewRouter(db.Pool, speisekarte, webhooks, jwtSecret)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// createUser adds a user who can log in with email and password.
+func createUser(t *testing.T, email, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id string
+	err = db.Pool.QueryRow(context.Background(),
+		`INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING id`, email, string(hash)).Scan(&id)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return id
+}
+
+// newClient returns a client for srv logged in as a new user.
+func newClient(t *testing.T, srv *httptest.Server, email string) *client.Client {
+	t.Helper()
+	createUser(t, email, "correct horse")
+	c, err := client.New(srv.URL, client.WithCredentials(email, "correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
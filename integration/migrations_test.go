@@ -0,0 +1,46 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/gomisroca/gasthaus-backend/internal"
+	"github.com/gomisroca/gasthaus-backend/internal/testdb"
+)
+
+// TestMigrationsRoundTrip migrates a fresh database down and up again, so
+// down migrations that leave objects behind show up as failures of the
+// second run.
+func TestMigrationsRoundTrip(t *testing.T) {
+	requireDB(t)
+	ctx := context.Background()
+	fresh, err := testdb.New(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := fresh.Close(ctx); err != nil {
+			t.Errorf("close: %v", err)
+		}
+	}()
+
+	path, err := testdb.MigrationPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.MigrateDown(fresh.URL, path); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if err := internal.MigrateUp(fresh.URL, path); err != nil {
+		t.Fatalf("up after down: %v", err)
+	}
+	if err := internal.MigrateUp(fresh.URL, path); err != migrate.ErrNoChange {
+		t.Errorf("second up: %v, want ErrNoChange", err)
+	}
+
+	var version int64
+	if err := fresh.Pool.QueryRow(ctx, `SELECT version FROM menu_state`).Scan(&version); err != nil {
+		t.Errorf("menu_state after round trip: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package integration
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gomisroca/gasthaus-backend/client"
+)
+
+func TestSearch(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "search@example.com")
+	ctx := context.Background()
+
+	description := "Flaumige Semmelknödel mit Pilzrahm"
+	knoedel, err := c.CreateItem(ctx, client.ItemInput{
+		Name: "Semmelknödel", Description: &description, PriceCents: 1150,
+		Categories: []string{"Suche"}, Ingredients: []string{"Steinpilze"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashed, err := c.CreateItem(ctx, client.ItemInput{Name: "Semmelknödelsuppe", PriceCents: 650, Categories: []string{"Suche"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteItem(ctx, trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := c.SearchItems(ctx, "Steinpilze", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != knoedel.ID || results[0].Rank <= 0 {
+		t.Fatalf("search by ingredient = %+v, want only %s", results, knoedel.Name)
+	}
+	if d := results[0].Highlights.Description; d == nil || !strings.Contains(*d, "<mark>") {
+		t.Errorf("description highlight = %v, want a <mark>", d)
+	}
+
+	// A misspelt name is found unless the search is exact; the item in
+	// the trash never is.
+	results, err = c.SearchItems(ctx, "Semmelknödl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != knoedel.ID {
+		t.Errorf("fuzzy search = %+v, want only %s", results, knoedel.Name)
+	}
+	results, err = c.SearchItems(ctx, "Semmelknödl", &client.SearchOptions{Exact: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("exact search = %+v, want no results", results)
+	}
+}
@@ -0,0 +1,87 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/gomisroca/gasthaus-backend/client"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "roundtrip@example.com")
+	ctx := context.Background()
+
+	if _, err := c.CreateItem(ctx, client.ItemInput{Name: "Leberkäse", PriceCents: 890, Categories: []string{"RoundTrip"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []client.ExportFormat{client.FormatJSON, client.FormatCSV, client.FormatXLSX} {
+		body, err := c.Export(ctx, format)
+		if err != nil {
+			t.Fatalf("export %s: %v", format, err)
+		}
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := c.Import(ctx, client.File{Filename: "menu." + string(format), Body: bytes.NewReader(data)}, nil)
+		if err != nil {
+			t.Fatalf("import %s: %v (report %+v)", format, err, client.ImportErrorReport(err))
+		}
+		if s := report.Summary; s.Created+s.Updated+s.Deleted+s.Errors != 0 || s.Unchanged == 0 {
+			t.Errorf("import of %s export: %+v, want every row unchanged", format, s)
+		}
+	}
+}
+
+func TestImportNames(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "importnames@example.com")
+	ctx := context.Background()
+
+	ids := map[string]string{}
+	for _, name := range []string{"Tausch Eins", "Tausch Zwei", "Tausch Drei"} {
+		item, err := c.CreateItem(ctx, client.ItemInput{Name: name, PriceCents: 500, Categories: []string{"Tausch"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = item.ID
+	}
+	importJSON := func(opts *client.ImportOptions, rows ...map[string]any) (*client.ImportReport, error) {
+		data, err := json.Marshal(rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Import(ctx, client.File{Filename: "menu.json", Body: bytes.NewReader(data)}, opts)
+	}
+	row := func(id, name string) map[string]any {
+		return map[string]any{"id": id, "name": name, "price_cents": 500, "categories": []string{"Tausch"}}
+	}
+
+	// A name held by an item the file does not touch is reported on the row.
+	_, err := importJSON(&client.ImportOptions{DryRun: true}, row(ids["Tausch Eins"], "Tausch Drei"))
+	report := client.ImportErrorReport(err)
+	if report == nil || len(report.Rows) != 1 || len(report.Rows[0].Errors) != 1 {
+		t.Fatalf("rename to a taken name: %v, report %+v", err, report)
+	}
+
+	// Two items can swap names.
+	report, err = importJSON(nil, row(ids["Tausch Eins"], "Tausch Zwei"), row(ids["Tausch Zwei"], "Tausch Eins"))
+	if err != nil || report.Summary.Updated != 2 {
+		t.Fatalf("swap: %v, report %+v", err, report)
+	}
+	got, err := c.GetItem(ctx, ids["Tausch Eins"])
+	if err != nil || got.Name != "Tausch Zwei" {
+		t.Errorf("after the swap item %s = %+v, %v", ids["Tausch Eins"], got, err)
+	}
+	if names := listNames(t, c, &client.ListItemsOptions{Category: "Tausch", Sort: "name"}); !slices.Equal(names, []string{"Tausch Drei", "Tausch Eins", "Tausch Zwei"}) {
+		t.Errorf("names = %q", names)
+	}
+}
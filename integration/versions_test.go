@@ -0,0 +1,190 @@
+package integration
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/gomisroca/gasthaus-backend/client"
+	"github.com/gomisroca/gasthaus-backend/handlers"
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+func TestRollbackSwapsNames(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "rollbackswap@example.com")
+	ctx := context.Background()
+
+	create := func(name string) string {
+		item, err := c.CreateItem(ctx, client.ItemInput{Name: name, PriceCents: 700, Categories: []string{"RollbackSwap"}})
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		return item.ID
+	}
+	rename := func(id, name string) {
+		if _, err := c.UpdateItem(ctx, id, client.ItemInput{Name: name, PriceCents: 700, Categories: []string{"RollbackSwap"}}); err != nil {
+			t.Fatalf("rename %s to %s: %v", id, name, err)
+		}
+	}
+	first, second := create("Rolle Eins"), create("Rolle Zwei")
+	version, err := c.CreateVersion(ctx, "before the swap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rename(first, "Rolle Tausch")
+	rename(second, "Rolle Eins")
+	rename(first, "Rolle Zwei")
+
+	if _, err := c.RollbackToVersion(ctx, version.ID); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	for id, want := range map[string]string{first: "Rolle Eins", second: "Rolle Zwei"} {
+		if item, err := c.GetItem(ctx, id); err != nil || item.Name != want {
+			t.Errorf("item %s after rollback = %+v, %v; want %s", id, item, err, want)
+		}
+	}
+}
+
+func TestPruneVersions(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "prune@example.com")
+	ctx := context.Background()
+
+	var ids []int64
+	for _, label := range []string{"one", "two", "three"} {
+		v, err := c.CreateVersion(ctx, label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, v.ID)
+	}
+
+	h := handlers.NewSpeisekarteHandler(db.Pool, nil)
+	if _, err := h.PruneVersions(ctx, 2); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	versions, err := c.ListVersions(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].ID != ids[2] || versions[1].ID != ids[1] {
+		t.Errorf("versions after pruning = %+v, want the newest two", versions)
+	}
+
+	// Outside the pruner versions stay immutable.
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM speisekarte_versions WHERE id = $1`, ids[1]); err == nil {
+		t.Error("deleting a version outside the pruner succeeded")
+	}
+}
+
+func TestRollbackRestoresPositions(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "rollbackposition@example.com")
+	ctx := context.Background()
+
+	var ids []string
+	for _, name := range []string{"Position Eins", "Position Zwei"} {
+		item, err := c.CreateItem(ctx, client.ItemInput{Name: name, PriceCents: 600, Categories: []string{"RollbackPosition"}})
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		ids = append(ids, item.ID)
+	}
+	version, err := c.CreateVersion(ctx, "before the reorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.ReorderItems(ctx, []string{ids[1], ids[0]}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetItemAvailability(ctx, ids[0], false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.RollbackToVersion(ctx, version.ID); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+
+	category := &client.ListItemsOptions{Category: "RollbackPosition", Sort: "position"}
+	if got := listNames(t, c, category); !slices.Equal(got, []string{"Position Eins", "Position Zwei"}) {
+		t.Errorf("items by position after rollback = %q", got)
+	}
+	if item, err := c.GetItem(ctx, ids[0]); err != nil || item.Available {
+		t.Errorf("item after rollback = %+v, %v; want it still sold out", item, err)
+	}
+}
+
+func TestVersionDiff(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "versiondiff@example.com")
+	ctx := context.Background()
+
+	create := func(name string) string {
+		item, err := c.CreateItem(ctx, client.ItemInput{Name: name, PriceCents: 800, Categories: []string{"VersionDiff"}})
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		return item.ID
+	}
+	removed, changed := create("Diff Entfernt"), create("Diff Geändert")
+	from, err := c.CreateVersion(ctx, "before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := c.GetVersion(ctx, from.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label := stored.Label; label == nil || *label != "before" || len(stored.Items) != stored.ItemCount {
+		t.Errorf("version = %+v, want label and all %d items", stored, stored.ItemCount)
+	}
+
+	if err := c.DeleteItem(ctx, removed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.PatchItem(ctx, changed, map[string]any{"price_cents": 850}); err != nil {
+		t.Fatal(err)
+	}
+	added := create("Diff Neu")
+
+	check := func(diff *models.VersionDiff) {
+		t.Helper()
+		ids := func(items []models.SpeisekarteItem) []string {
+			var out []string
+			for _, item := range items {
+				out = append(out, item.ID)
+			}
+			return out
+		}
+		if !slices.Contains(ids(diff.Added), added) || !slices.Contains(ids(diff.Removed), removed) {
+			t.Errorf("added %q, removed %q; want %s added and %s removed", ids(diff.Added), ids(diff.Removed), added, removed)
+		}
+		i := slices.IndexFunc(diff.Changed, func(c models.ItemChange) bool { return c.ID == changed })
+		if i < 0 {
+			t.Fatalf("changed = %+v, want %s", diff.Changed, changed)
+		}
+		if price := diff.Changed[i].Changes["price_cents"]; price.Old != float64(800) || price.New != float64(850) {
+			t.Errorf("price change = %+v, want 800 to 850", price)
+		}
+	}
+
+	live, err := c.DiffVersions(ctx, from.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(live)
+	to, err := c.CreateVersion(ctx, "after")
+	if err != nil {
+		t.Fatal(err)
+	}
+	between, err := c.DiffVersions(ctx, from.ID, &to.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(between)
+	if between.To == nil || *between.To != to.ID {
+		t.Errorf("diff to = %v, want %d", between.To, to.ID)
+	}
+}
@@ -0,0 +1,203 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/client"
+	"github.com/gomisroca/gasthaus-backend/handlers"
+	"github.com/gomisroca/gasthaus-backend/models"
+)
+
+// newReceiver answers webhook requests with the status in *status and counts
+// the signed requests it gets.
+func newReceiver(t *testing.T, status *atomic.Int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("X-Gasthaus-Signature"), "sha256=") {
+			received.Add(1)
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &received
+}
+
+// newSubscription subscribes to item.created at url and removes the
+// subscription with its deliveries when the test ends.
+func newSubscription(t *testing.T, c *client.Client, url string) *models.WebhookSubscription {
+	t.Helper()
+	s, err := c.CreateWebhook(context.Background(), client.WebhookInput{URL: url, EventTypes: []string{models.EventItemCreated}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.DeleteWebhook(context.Background(), s.ID) })
+	return s
+}
+
+// queueDelivery adds a delivery to subscription that is due now.
+func queueDelivery(t *testing.T, subscription string) int64 {
+	t.Helper()
+	var id int64
+	err := db.Pool.QueryRow(context.Background(),
+		`INSERT INTO webhook_deliveries (subscription_id, event_type, payload) VALUES ($1, $2, '{}') RETURNING id`,
+		subscription, models.EventItemCreated).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// dispatchUntil runs the dispatcher until the delivery satisfies done.
+func dispatchUntil(t *testing.T, c *client.Client, id int64, done func(models.WebhookDelivery) bool) models.WebhookDelivery {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	(&handlers.WebhookHandler{DB: db.Pool}).StartDispatcher(ctx, 10*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		d, err := c.GetWebhookDelivery(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done(*d) {
+			return *d
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("delivery %d did not reach the expected state", id)
+	return models.WebhookDelivery{}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "webhookretry@example.com")
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	receiver, received := newReceiver(t, &status)
+	s := newSubscription(t, c, receiver.URL)
+	id := queueDelivery(t, s.ID)
+
+	start := time.Now()
+	d := dispatchUntil(t, c, id, func(d models.WebhookDelivery) bool { return d.Attempts == 1 && d.LastError != nil })
+	if d.Status != "pending" || d.ResponseStatus == nil || *d.ResponseStatus != http.StatusServiceUnavailable {
+		t.Errorf("after a failed attempt: status %s, response %v; want pending with 503", d.Status, d.ResponseStatus)
+	}
+	// The first retry waits the base backoff of 30s plus up to 20% jitter.
+	if wait := d.NextAttemptAt.Sub(start); wait < 29*time.Second || wait > 37*time.Second {
+		t.Errorf("next attempt in %s, want about 30s", wait)
+	}
+
+	status.Store(http.StatusNoContent)
+	if _, err := db.Pool.Exec(context.Background(), `UPDATE webhook_deliveries SET next_attempt_at = NOW() WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+	d = dispatchUntil(t, c, id, func(d models.WebhookDelivery) bool { return d.Status != "pending" })
+	if d.Status != "succeeded" || d.Attempts != 2 || d.DeliveredAt == nil || d.LastError != nil {
+		t.Errorf("after the retry: %+v, want succeeded on the second attempt", d)
+	}
+	if n := received.Load(); n != 2 {
+		t.Errorf("receiver got %d signed requests, want 2", n)
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "webhookdead@example.com")
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	receiver, _ := newReceiver(t, &status)
+	s := newSubscription(t, c, receiver.URL)
+	id := queueDelivery(t, s.ID)
+
+	// One attempt short of the limit of 10.
+	if _, err := db.Pool.Exec(context.Background(), `UPDATE webhook_deliveries SET attempts = 9 WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+	d := dispatchUntil(t, c, id, func(d models.WebhookDelivery) bool { return d.Status != "pending" })
+	if d.Status != "dead" || d.Attempts != 10 || d.LastError == nil || d.DeliveredAt != nil {
+		t.Errorf("delivery = %+v, want it dead after 10 attempts", d)
+	}
+
+	redelivered, err := c.RedeliverWebhook(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redelivered.Status != "pending" || redelivered.Attempts != 0 {
+		t.Errorf("redelivery = %+v, want a fresh pending delivery", redelivered)
+	}
+}
+
+func TestWebhookInactiveSubscriptionWaits(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "webhookinactive@example.com")
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	receiver, _ := newReceiver(t, &status)
+	inactive := newSubscription(t, c, receiver.URL)
+	active := newSubscription(t, c, receiver.URL)
+
+	// Queued first, so it is due before the active subscription's delivery.
+	waiting := queueDelivery(t, inactive.ID)
+	off := false
+	if _, err := c.UpdateWebhook(context.Background(), inactive.ID, client.WebhookInput{
+		URL: receiver.URL, EventTypes: inactive.EventTypes, Active: &off,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sent := queueDelivery(t, active.ID)
+
+	dispatchUntil(t, c, sent, func(d models.WebhookDelivery) bool { return d.Status == "succeeded" })
+	d, err := c.GetWebhookDelivery(context.Background(), waiting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != "pending" || d.Attempts != 0 {
+		t.Errorf("delivery of the inactive subscription = %+v, want it untouched", d)
+	}
+}
+
+func TestWebhookMalformedIDs(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv, "webhookids@example.com")
+	ctx := context.Background()
+
+	checks := map[string]error{}
+	_, checks["get"] = c.GetWebhook(ctx, "not-a-uuid")
+	_, checks["update"] = c.UpdateWebhook(ctx, "not-a-uuid", client.WebhookInput{URL: "https://example.com/hook", EventTypes: []string{models.EventItemCreated}})
+	checks["delete"] = c.DeleteWebhook(ctx, "not-a-uuid")
+	_, checks["deliveries"] = c.ListWebhookDeliveries(ctx, "not-a-uuid", nil)
+	for name, err := range checks {
+		if !errors.Is(err, client.ErrNotFound) {
+			t.Errorf("%s: err = %v, want not found", name, err)
+		}
+	}
+
+	// The client only takes numeric delivery ids.
+	for _, rq := range []struct{ method, path string }{
+		{"GET", "/admin/webhooks/deliveries/abc"},
+		{"POST", "/admin/webhooks/deliveries/abc/redeliver"},
+	} {
+		req, err := http.NewRequest(rq.method, srv.URL+rq.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+c.Token())
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s %s = %d, want 404", rq.method, rq.path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Package clientip works out the address a request came from, for the audit
+// log.
+package clientip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// Middleware records each request's client address. Proxy headers are only
+// read when trustProxy is set; anyone can send them, so without a proxy that
+// sets them the connection's remote address is the only reliable one.
+func Middleware(trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, resolve(r, trustProxy))))
+		})
+	}
+}
+
+// FromRequest returns the address recorded by Middleware, or the remote
+// address for requests that didn't pass through it.
+func FromRequest(r *http.Request) string {
+	if ip, ok := r.Context().Value(contextKey{}).(string); ok {
+		return ip
+	}
+	return resolve(r, false)
+}
+
+// resolve trusts only what our proxy sets: Fly's proxy reports the client in
+// Fly-Client-IP and appends the address it saw to X-Forwarded-For, so the
+// rightmost hop is the only one a client can't forge. Without either it falls
+// back to the connection's remote address.
+func resolve(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if ip := strings.TrimSpace(r.Header.Get("Fly-Client-IP")); net.ParseIP(ip) != nil {
+			return ip
+		}
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,77 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string][]string
+		want   string
+	}{
+		{name: "remote address", want: "192.0.2.1"},
+		{
+			name:   "Fly-Client-IP",
+			header: map[string][]string{"Fly-Client-IP": {"203.0.113.7"}, "X-Forwarded-For": {"198.51.100.1, 203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "rightmost forwarded hop",
+			header: map[string][]string{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "last of several forwarded headers",
+			header: map[string][]string{"X-Forwarded-For": {"198.51.100.1", "203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "forwarded hop that isn't an address",
+			header: map[string][]string{"X-Forwarded-For": {"203.0.113.7, unknown"}},
+			want:   "192.0.2.1",
+		},
+		{
+			name:   "Fly-Client-IP that isn't an address",
+			header: map[string][]string{"Fly-Client-IP": {"spoofed"}},
+			want:   "192.0.2.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			for k, values := range tt.header {
+				for _, v := range values {
+					r.Header.Add(k, v)
+				}
+			}
+			if got := resolve(r, true); got != tt.want {
+				t.Errorf("behind a proxy: resolve = %q, want %q", got, tt.want)
+			}
+			if got := resolve(r, false); got != "192.0.2.1" {
+				t.Errorf("without a proxy: resolve = %q, want the remote address", got)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	for _, trustProxy := range []bool{false, true} {
+		want := "192.0.2.1"
+		if trustProxy {
+			want = "203.0.113.7"
+		}
+		var got string
+		h := Middleware(trustProxy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FromRequest(r)
+		}))
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Fly-Client-IP", "203.0.113.7")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if got != want {
+			t.Errorf("trustProxy %v: FromRequest = %q, want %q", trustProxy, got, want)
+		}
+	}
+}
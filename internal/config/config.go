@@ -0,0 +1,355 @@
+// Package config loads the server configuration.
+//
+// Every setting has an environment variable and a command-line flag of the
+// same name in lower case with dashes, e.g. TRASH_RETENTION and
+// -trash-retention. Settings are read from, in increasing precedence:
+//
+//  1. the defaults documented on Config
+//  2. an env file of KEY=value lines: -config or CONFIG_FILE, or .env in
+//     the working directory if it exists
+//  3. the environment
+//  4. flags, given before the command: server -port 9000 serve
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// DefaultFile is the env file read when none is given. It is optional.
+const DefaultFile = ".env"
+
+// Config holds all settings. The env tag names a setting, default is used
+// when it is not set and secret settings are masked by Print; a secret of
+// "url" masks only the password of a URL or key=value connection string.
+type Config struct {
+	Port           int        `env:"PORT" default:"8080" usage:"port the API listens on"`
+	MetricsAddr    string     `env:"METRICS_ADDR" default:":9091" usage:"address to serve /metrics on; it must not be the API port"`
+	DatabaseURL    string     `env:"DATABASE_URL" secret:"url" usage:"PostgreSQL connection string"`
+	MigrationsPath string     `env:"MIGRATIONS_PATH" default:"db/migrations" usage:"directory of the SQL migrations"`
+	AutoMigrate    bool       `env:"AUTO_MIGRATE" default:"false" usage:"apply pending migrations when the server starts"`
+	LogLevel       slog.Level `env:"LOG_LEVEL" default:"info" usage:"lowest level logged: debug, info, warn or error"`
+	// TraceExporter is otlp, stdout or none. The otlp exporter reads the
+	// standard OTEL_EXPORTER_OTLP_* variables.
+	TraceExporter string `env:"TRACE_EXPORTER" default:"none" usage:"where to send traces: otlp, stdout or none"`
+
+	// TrustProxy reads client addresses for the audit log from the headers
+	// Fly's proxy sets. Without a proxy clients could forge them.
+	TrustProxy bool `env:"TRUST_PROXY" default:"false" usage:"take client addresses from Fly-Client-IP and X-Forwarded-For; set only behind Fly's proxy"`
+
+	JWTSecret string `env:"JWT_SECRET" secret:"true" usage:"key that signs access tokens"`
+	// FrontendOrigins are the origins CORS allows, comma-separated.
+	FrontendOrigins []string `env:"FRONTEND_ORIGIN" usage:"comma-separated origins allowed to call the API"`
+
+	SupabaseProjectRef     string `env:"SUPABASE_PROJECT_REF" usage:"Supabase project that stores item images"`
+	SupabaseServiceRoleKey string `env:"SUPABASE_SERVICE_ROLE_KEY" secret:"true" usage:"Supabase key for image uploads"`
+
+	TrashRetention                time.Duration `env:"TRASH_RETENTION" default:"720h" usage:"how long deleted items stay in the trash"`
+	MenuVersionsKept              int           `env:"MENU_VERSIONS_KEPT" default:"500" usage:"how many menu versions to keep; older ones are deleted, 0 keeps all"`
+	HTTPCacheMaxAge               time.Duration `env:"HTTP_CACHE_MAX_AGE" default:"1m" usage:"max-age of public menu responses; 0 disables shared caching"`
+	HTTPCacheStaleWhileRevalidate time.Duration `env:"HTTP_CACHE_STALE_WHILE_REVALIDATE" default:"5m" usage:"stale-while-revalidate of public menu responses"`
+	MenuCacheTTL                  time.Duration `env:"MENU_CACHE_TTL" default:"5m" usage:"how long the server caches menu responses"`
+	MenuCacheStaleTTL             time.Duration `env:"MENU_CACHE_STALE_TTL" default:"1m" usage:"how long an expired menu response is served while it is refreshed"`
+
+	// File is the env file that was read, if any.
+	File string `env:"-"`
+
+	sources  map[string]string
+	problems []string
+}
+
+// setting is one field of Config.
+type setting struct {
+	env, def, usage, secret string
+	value                   reflect.Value
+}
+
+func (c *Config) settings() []setting {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	var settings []setting
+	for i := range t.NumField() {
+		f := t.Field(i)
+		env := f.Tag.Get("env")
+		if env == "" || env == "-" {
+			continue
+		}
+		settings = append(settings, setting{
+			env:    env,
+			def:    f.Tag.Get("default"),
+			usage:  f.Tag.Get("usage"),
+			secret: f.Tag.Get("secret"),
+			value:  v.Field(i),
+		})
+	}
+	return settings
+}
+
+func flagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(env), "_", "-")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses s into the setting's field.
+func (s setting) set(raw string) error {
+	if u, ok := s.value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(raw)); err != nil {
+			return fmt.Errorf("invalid value %q", raw)
+		}
+		return nil
+	}
+	switch {
+	case s.value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		s.value.SetInt(int64(d))
+	case s.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		s.value.SetInt(int64(n))
+	case s.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		s.value.SetBool(b)
+	case s.value.Kind() == reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		s.value.Set(reflect.ValueOf(list))
+	default:
+		s.value.SetString(raw)
+	}
+	return nil
+}
+
+// String formats the setting's value the way it is written in an env file.
+func (s setting) String() string {
+	switch v := s.value.Interface().(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case time.Duration:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Load reads the configuration for a command line whose flags come before
+// the command, and returns the remaining arguments. It only fails if the
+// flags or the env file cannot be read; invalid values are reported by
+// Validate.
+func Load(args []string) (*Config, []string, error) {
+	c := &Config{sources: make(map[string]string)}
+	settings := c.settings()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("config", "", "env file to read settings from (default "+DefaultFile+" if present)")
+	flags := make(map[string]string)
+	for _, s := range settings {
+		env := s.env
+		record := func(v string) error { flags[env] = v; return nil }
+		if s.value.Kind() == reflect.Bool {
+			fs.BoolFunc(flagName(env), s.usage, record)
+		} else {
+			fs.Func(flagName(env), s.usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("%v\n\n%s", err, FlagUsage())
+	}
+
+	fileValues := map[string]string{}
+	c.File = *file
+	if c.File == "" {
+		c.File = os.Getenv("CONFIG_FILE")
+	}
+	switch {
+	case c.File != "":
+		values, err := godotenv.Read(c.File)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		fileValues = values
+	default:
+		if values, err := godotenv.Read(DefaultFile); err == nil {
+			c.File, fileValues = DefaultFile, values
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", DefaultFile, err)
+		}
+	}
+
+	for _, s := range settings {
+		raw, source := s.def, "default"
+		if v := fileValues[s.env]; v != "" {
+			raw, source = v, c.File
+		}
+		if v := os.Getenv(s.env); v != "" {
+			raw, source = v, "env"
+		}
+		if v, ok := flags[s.env]; ok {
+			raw, source = v, "flag"
+		}
+		if raw == "" {
+			continue
+		}
+		c.sources[s.env] = source
+		if err := s.set(raw); err != nil {
+			c.problems = append(c.problems, fmt.Sprintf("%s: %v", s.env, err))
+			// Keep the default so the value is not reported twice.
+			if s.def != "" {
+				s.set(s.def)
+			}
+		}
+	}
+	return c, fs.Args(), nil
+}
+
+// FlagUsage describes the flags Load accepts.
+func FlagUsage() string {
+	var b strings.Builder
+	b.WriteString("Flags (before the command):\n  -config FILE\n\tenv file to read settings from (default " + DefaultFile + " if present)\n")
+	for _, s := range (&Config{}).settings() {
+		fmt.Fprintf(&b, "  -%s\n\t%s (%s)\n", flagName(s.env), s.usage, s.env)
+	}
+	return b.String()
+}
+
+// ValidationError lists every problem with a configuration.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// Validate reports unparseable and inconsistent values, and the settings
+// named in required that are not set, all at once.
+func (c *Config) Validate(required ...string) error {
+	problems := append(ValidationError{}, c.problems...)
+	for _, env := range required {
+		if _, ok := c.sources[env]; !ok {
+			problems = append(problems, env+" is required")
+		}
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT: %d is not a valid port", c.Port))
+	}
+	if c.MenuVersionsKept < 0 {
+		problems = append(problems, "MENU_VERSIONS_KEPT: must not be negative")
+	}
+	switch c.TraceExporter {
+	case "otlp", "stdout", "none":
+	default:
+		problems = append(problems, fmt.Sprintf("TRACE_EXPORTER: %q is not otlp, stdout or none", c.TraceExporter))
+	}
+	// The API port is public, so metrics get a listener of their own.
+	if _, port, err := net.SplitHostPort(c.MetricsAddr); err != nil {
+		problems = append(problems, fmt.Sprintf("METRICS_ADDR: %q is not a host:port address", c.MetricsAddr))
+	} else if port == strconv.Itoa(c.Port) {
+		problems = append(problems, fmt.Sprintf("METRICS_ADDR: %q is the API port", c.MetricsAddr))
+	}
+	if strings.Contains(c.DatabaseURL, "://") {
+		if u, err := url.Parse(c.DatabaseURL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			problems = append(problems, "DATABASE_URL: must be a postgres:// URL or a key=value connection string")
+		}
+	}
+	for _, origin := range c.FrontendOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "") {
+			problems = append(problems, fmt.Sprintf("FRONTEND_ORIGIN: %q is not an origin like https://example.com", origin))
+		}
+	}
+	if (c.SupabaseProjectRef == "") != (c.SupabaseServiceRoleKey == "") {
+		problems = append(problems, "SUPABASE_PROJECT_REF and SUPABASE_SERVICE_ROLE_KEY must be set together")
+	}
+	for _, d := range []struct {
+		env   string
+		value time.Duration
+	}{
+		{"TRASH_RETENTION", c.TrashRetention},
+		{"HTTP_CACHE_MAX_AGE", c.HTTPCacheMaxAge},
+		{"HTTP_CACHE_STALE_WHILE_REVALIDATE", c.HTTPCacheStaleWhileRevalidate},
+		{"MENU_CACHE_TTL", c.MenuCacheTTL},
+		{"MENU_CACHE_STALE_TTL", c.MenuCacheStaleTTL},
+	} {
+		if d.value < 0 {
+			problems = append(problems, d.env+": must not be negative")
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// Print writes every setting as an env file line, followed by where its
+// value came from. Secrets are masked.
+func (c *Config) Print(w io.Writer) error {
+	if c.File != "" {
+		if _, err := fmt.Fprintf(w, "# config file: %s\n", c.File); err != nil {
+			return err
+		}
+	}
+	for _, s := range c.settings() {
+		source, ok := c.sources[s.env]
+		if !ok {
+			source = "unset"
+		}
+		value := s.String()
+		if !ok {
+			value = ""
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s # %s\n", s.env, mask(s.secret, value), source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dsnPassword matches the password of a key=value connection string, quoted
+// or not.
+var dsnPassword = regexp.MustCompile(`(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+func mask(secret, value string) string {
+	switch {
+	case value == "" || secret == "":
+		return value
+	case secret == "url" && !strings.Contains(value, "://"):
+		return dsnPassword.ReplaceAllString(value, "${1}xxxxx")
+	case secret == "url":
+		u, err := url.Parse(value)
+		if err != nil {
+			return "********"
+		}
+		return u.Redacted()
+	}
+	return "********"
+}
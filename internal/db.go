@@ -3,19 +3,24 @@ package internal
 import (
 	"context"
 	"fmt"
-	"os"
 
+	"github.com/gomisroca/gasthaus-backend/internal/tracing"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func SetupDB() (*pgxpool.Pool, error) {
-	connString := os.Getenv("DATABASE_URL")
+func SetupDB(connString string) (*pgxpool.Pool, error) {
 	if connString == "" {
-		return nil, fmt.Errorf("DATABASE_URL not set in environment")
+		return nil, fmt.Errorf("DATABASE_URL is not set")
 	}
 
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	config.ConnConfig.Tracer = tracing.QueryTracer{}
+
 	// Database connection setup
-	dbpool, err := pgxpool.New(context.Background(), connString)
+	dbpool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
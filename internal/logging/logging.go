@@ -0,0 +1,157 @@
+// Package logging sets up structured logging and writes an access log line
+// for every request. Handlers log through FromContext so that their lines
+// carry the request id of the access log line they belong to.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/requestid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New returns a logger that writes JSON lines at level and above.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// request is shared by the middlewares of one request. The router and the
+// auth middleware run on copies of the request further down the chain, so
+// they report the route and user here rather than in a new context.
+type request struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+	route  string
+}
+
+type contextKey struct{}
+
+func fromContext(ctx context.Context) *request {
+	req, _ := ctx.Value(contextKey{}).(*request)
+	return req
+}
+
+// FromContext returns the request's logger, or the default logger outside
+// of Middleware.
+func FromContext(ctx context.Context) *slog.Logger {
+	if req := fromContext(ctx); req != nil {
+		req.mu.Lock()
+		defer req.mu.Unlock()
+		return req.logger
+	}
+	return slog.Default()
+}
+
+// SetUserID adds the authenticated user to the request's log lines.
+func SetUserID(ctx context.Context, userID string) {
+	if req := fromContext(ctx); req != nil {
+		req.mu.Lock()
+		req.logger = req.logger.With("user_id", userID)
+		req.mu.Unlock()
+	}
+}
+
+// Route returns the path template recorded by RouteMiddleware, or "" if no
+// route matched. It is known once the router has handled the request.
+func Route(ctx context.Context) string {
+	if req := fromContext(ctx); req != nil {
+		req.mu.Lock()
+		defer req.mu.Unlock()
+		return req.route
+	}
+	return ""
+}
+
+// RouteMiddleware records the path template of the matched route, e.g.
+// /speisekarte/{id}, so requests can be grouped without their ids. Install
+// it with mux.Router.Use.
+func RouteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if req := fromContext(r.Context()); req != nil {
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil {
+					req.mu.Lock()
+					req.route = tmpl
+					req.mu.Unlock()
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware puts a logger carrying the request id, and the trace id if the
+// request is traced, into the context and logs every request once it is
+// done. It runs inside requestid.Middleware and tracing.Middleware.
+func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			req := &request{logger: logger}
+			if id := requestid.FromContext(r.Context()); id != "" {
+				req.logger = req.logger.With("request_id", id)
+			}
+			if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+				req.logger = req.logger.With("trace_id", span.TraceID().String())
+			}
+			rw := &responseWriter{ResponseWriter: w}
+
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), contextKey{}, req)))
+
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			if status >= 500 {
+				level = slog.LevelError
+			}
+			// The logger carries user_id if SetUserID was called.
+			req.mu.Lock()
+			defer req.mu.Unlock()
+			req.logger.LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("route", req.route),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.Int64("bytes", rw.bytes),
+			)
+		})
+	}
+}
+
+// responseWriter records the status and size of a response.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, which the
+// event stream needs to flush.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gomisroca/gasthaus-backend/internal/requestid"
+	"github.com/gorilla/mux"
+)
+
+func TestMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, slog.LevelInfo)
+
+	r := mux.NewRouter()
+	r.Use(RouteMiddleware)
+	r.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		SetUserID(r.Context(), "user-1")
+		FromContext(r.Context()).Warn("handler line")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+	handler := requestid.Middleware(Middleware(logger)(r))
+
+	req := httptest.NewRequest(http.MethodPost, "/items/42", nil)
+	req.Header.Set(requestid.Header, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2:\n%s", len(lines), out.String())
+	}
+	var handlerLine, access map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &handlerLine); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &access); err != nil {
+		t.Fatal(err)
+	}
+
+	if handlerLine["request_id"] != "req-1" || handlerLine["user_id"] != "user-1" {
+		t.Errorf("handler line = %v, want the request and user id", handlerLine)
+	}
+	want := map[string]any{
+		"msg":        "request",
+		"request_id": "req-1",
+		"user_id":    "user-1",
+		"method":     "POST",
+		"route":      "/items/{id}",
+		"path":       "/items/42",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(5),
+	}
+	for k, v := range want {
+		if access[k] != v {
+			t.Errorf("access log %s = %v, want %v", k, access[k], v)
+		}
+	}
+	if _, ok := access["duration_ms"].(float64); !ok {
+		t.Errorf("access log has no duration_ms: %v", access)
+	}
+}
+
+func TestMiddlewareUnmatchedRoute(t *testing.T) {
+	var out bytes.Buffer
+	r := mux.NewRouter()
+	r.Use(RouteMiddleware)
+	handler := requestid.Middleware(Middleware(New(&out, slog.LevelInfo))(r))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	var access map[string]any
+	if err := json.Unmarshal(out.Bytes(), &access); err != nil {
+		t.Fatal(err)
+	}
+	if access["status"] != float64(http.StatusNotFound) || access["route"] != "" {
+		t.Errorf("access log = %v, want a 404 without a route", access)
+	}
+	if id, _ := access["request_id"].(string); id == "" {
+		t.Error("access log has no generated request id")
+	}
+	if _, ok := access["user_id"]; ok {
+		t.Error("anonymous request logged a user id")
+	}
+}
@@ -0,0 +1,222 @@
+// Package menucache caches encoded public menu responses.
+//
+// Concurrent misses for the same key share a single load, entries past
+// their TTL are served stale while one background load refreshes them, and
+// Invalidate discards every entry along with any load already in flight.
+package menucache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Entry is a cached response body with the validators it was read at.
+type Entry struct {
+	Body         []byte
+	ETag         string
+	LastModified time.Time
+	// Header holds further response headers, such as pagination links.
+	Header http.Header
+}
+
+// Loader produces a fresh entry for a key.
+type Loader func(ctx context.Context) (Entry, error)
+
+type Config struct {
+	// TTL is how long an entry is served without reloading it.
+	TTL time.Duration
+	// StaleTTL is how long after TTL an entry may still be served while it
+	// is refreshed in the background. Zero disables stale serving.
+	StaleTTL time.Duration
+	// MaxEntries bounds the number of keys; the oldest entry is evicted
+	// first. Zero means no limit.
+	MaxEntries int
+	// RefreshTimeout bounds a single load.
+	RefreshTimeout time.Duration
+	// Observe, if set, is called with the result of every Get.
+	Observe func(key string, result Result)
+}
+
+// Result is the outcome of a Get.
+type Result string
+
+const (
+	Hit   Result = "hit"
+	Stale Result = "stale"
+	Miss  Result = "miss"
+)
+
+// DefaultConfig matches the cache duration the menu endpoints always had.
+var DefaultConfig = Config{
+	TTL:            5 * time.Minute,
+	StaleTTL:       time.Minute,
+	MaxEntries:     256,
+	RefreshTimeout: 10 * time.Second,
+}
+
+// Stats are cumulative counters since the cache was created.
+type Stats struct {
+	Hits          uint64 `json:"hits"`
+	StaleHits     uint64 `json:"stale_hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	LoadErrors    uint64 `json:"load_errors"`
+	Invalidations uint64 `json:"invalidations"`
+	Entries       int    `json:"entries"`
+}
+
+type cached struct {
+	Entry
+	storedAt time.Time
+}
+
+type Cache struct {
+	cfg   Config
+	group singleflight.Group
+
+	mu         sync.RWMutex
+	entries    map[string]cached
+	generation uint64
+
+	hits, staleHits, misses, evictions, loadErrors, invalidations atomic.Uint64
+}
+
+func New(cfg Config) *Cache {
+	if cfg.RefreshTimeout <= 0 {
+		cfg.RefreshTimeout = DefaultConfig.RefreshTimeout
+	}
+	return &Cache{cfg: cfg, entries: make(map[string]cached)}
+}
+
+// Get returns the entry for key, calling load on a miss. Only one load per
+// key runs at a time; other callers wait for its result.
+func (c *Cache) Get(ctx context.Context, key string, load Loader) (Entry, error) {
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	generation := c.generation
+	c.mu.RUnlock()
+
+	if ok {
+		age := time.Since(e.storedAt)
+		if age < c.cfg.TTL {
+			c.hits.Add(1)
+			c.observe(key, Hit)
+			return e.Entry, nil
+		}
+		if age < c.cfg.TTL+c.cfg.StaleTTL {
+			c.staleHits.Add(1)
+			c.observe(key, Stale)
+			c.refresh(key, generation, load)
+			return e.Entry, nil
+		}
+	}
+
+	c.misses.Add(1)
+	c.observe(key, Miss)
+	// The load is shared, so it must not be cancelled with the request
+	// that happened to start it.
+	ch := c.group.DoChan(flightKey(generation, key), func() (any, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.cfg.RefreshTimeout)
+		defer cancel()
+		return c.load(loadCtx, key, generation, load)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return Entry{}, res.Err
+		}
+		return res.Val.(Entry), nil
+	case <-ctx.Done():
+		return Entry{}, ctx.Err()
+	}
+}
+
+func (c *Cache) observe(key string, result Result) {
+	if c.cfg.Observe != nil {
+		c.cfg.Observe(key, result)
+	}
+}
+
+// refresh reloads key in the background unless a load is already running.
+func (c *Cache) refresh(key string, generation uint64, load Loader) {
+	c.group.DoChan(flightKey(generation, key), func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), c.cfg.RefreshTimeout)
+		defer cancel()
+		entry, err := c.load(ctx, key, generation, load)
+		if err != nil {
+			slog.Error("Menu cache refresh failed", "key", key, "err", err)
+		}
+		return entry, err
+	})
+}
+
+// load runs the loader and stores its result, unless the cache was
+// invalidated while it ran and the result may already be outdated.
+func (c *Cache) load(ctx context.Context, key string, generation uint64, load Loader) (Entry, error) {
+	entry, err := load(ctx)
+	if err != nil {
+		c.loadErrors.Add(1)
+		return Entry{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return entry, nil
+	}
+	if _, exists := c.entries[key]; !exists && c.cfg.MaxEntries > 0 && len(c.entries) >= c.cfg.MaxEntries {
+		c.evictOldest()
+	}
+	c.entries[key] = cached{Entry: entry, storedAt: time.Now()}
+	return entry, nil
+}
+
+// evictOldest must be called with mu held.
+func (c *Cache) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, e := range c.entries {
+		if oldestKey == "" || e.storedAt.Before(oldest) {
+			oldestKey, oldest = key, e.storedAt
+		}
+	}
+	delete(c.entries, oldestKey)
+	c.evictions.Add(1)
+}
+
+// Invalidate drops every entry. Loads that started before the call still
+// answer their waiters but are not stored.
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cached)
+	c.generation++
+	c.invalidations.Add(1)
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.RLock()
+	entries := len(c.entries)
+	c.mu.RUnlock()
+
+	return Stats{
+		Hits:          c.hits.Load(),
+		StaleHits:     c.staleHits.Load(),
+		Misses:        c.misses.Load(),
+		Evictions:     c.evictions.Load(),
+		LoadErrors:    c.loadErrors.Load(),
+		Invalidations: c.invalidations.Load(),
+		Entries:       entries,
+	}
+}
+
+func flightKey(generation uint64, key string) string {
+	return fmt.Sprintf("%d/%s", generation, key)
+}
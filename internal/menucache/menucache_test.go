@@ -0,0 +1,227 @@
+package menucache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingLoader counts its calls and holds every load until release is
+// closed. Each load returns the body "v<n>" for the n-th call.
+type blockingLoader struct {
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+	// ctxErr is the error of the context of the last finished load.
+	ctxErr atomic.Value
+}
+
+func newBlockingLoader() *blockingLoader {
+	return &blockingLoader{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (l *blockingLoader) load(ctx context.Context) (Entry, error) {
+	n := l.calls.Add(1)
+	l.started <- struct{}{}
+	<-l.release
+	l.ctxErr.Store(fmt.Sprint(ctx.Err()))
+	return Entry{Body: []byte(fmt.Sprintf("v%d", n))}, nil
+}
+
+func (l *blockingLoader) waitStarted(t *testing.T) {
+	t.Helper()
+	select {
+	case <-l.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("load did not start")
+	}
+}
+
+func counting(calls *atomic.Int32, body string) Loader {
+	return func(context.Context) (Entry, error) {
+		calls.Add(1)
+		return Entry{Body: []byte(body)}, nil
+	}
+}
+
+// waitFor polls cond until it holds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrentMissesShareOneLoad(t *testing.T) {
+	c := New(Config{TTL: time.Hour})
+	loader := newBlockingLoader()
+
+	const callers = 10
+	var wg sync.WaitGroup
+	bodies := make([]string, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e, err := c.Get(context.Background(), "menu", loader.load)
+			if err != nil {
+				t.Error(err)
+			}
+			bodies[i] = string(e.Body)
+		}()
+	}
+	loader.waitStarted(t)
+	waitFor(t, "every caller to miss", func() bool { return c.Stats().Misses == callers })
+	// Give the last callers time to join the load after counting their miss.
+	time.Sleep(10 * time.Millisecond)
+	close(loader.release)
+	wg.Wait()
+
+	if n := loader.calls.Load(); n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+	for i, body := range bodies {
+		if body != "v1" {
+			t.Errorf("caller %d got %q, want v1", i, body)
+		}
+	}
+}
+
+func TestLoadFinishingAfterInvalidateIsNotStored(t *testing.T) {
+	c := New(Config{TTL: time.Hour})
+	loader := newBlockingLoader()
+
+	done := make(chan Entry)
+	go func() {
+		e, err := c.Get(context.Background(), "menu", loader.load)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- e
+	}()
+	loader.waitStarted(t)
+	c.Invalidate()
+	close(loader.release)
+
+	if e := <-done; string(e.Body) != "v1" {
+		t.Errorf("waiter got %q, want the result of its load", e.Body)
+	}
+	if n := c.Stats().Entries; n != 0 {
+		t.Errorf("%d entries after the outdated load, want 0", n)
+	}
+
+	var calls atomic.Int32
+	if e, _ := c.Get(context.Background(), "menu", counting(&calls, "fresh")); string(e.Body) != "fresh" || calls.Load() != 1 {
+		t.Errorf("next Get returned %q after %d loads, want a fresh load", e.Body, calls.Load())
+	}
+}
+
+func TestStaleEntryIsServedWhileOneRefreshRuns(t *testing.T) {
+	// Every entry is stale as soon as it is stored.
+	c := New(Config{TTL: time.Nanosecond, StaleTTL: time.Hour})
+	loader := newBlockingLoader()
+	close(loader.release)
+	if _, err := c.Get(context.Background(), "menu", loader.load); err != nil {
+		t.Fatal(err)
+	}
+	loader.waitStarted(t)
+	loader.release = make(chan struct{})
+
+	for range 10 {
+		e, err := c.Get(context.Background(), "menu", loader.load)
+		if err != nil || string(e.Body) != "v1" {
+			t.Fatalf("stale Get = %q, %v; want v1 without waiting", e.Body, err)
+		}
+	}
+	loader.waitStarted(t)
+	if n := loader.calls.Load(); n != 2 {
+		t.Errorf("loader called %d times, want the first load and one refresh", n)
+	}
+	if s := c.Stats(); s.StaleHits != 10 || s.Misses != 1 {
+		t.Errorf("stats = %+v, want 10 stale hits and 1 miss", s)
+	}
+
+	close(loader.release)
+	waitFor(t, "the refreshed entry", func() bool {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return string(c.entries["menu"].Body) == "v2"
+	})
+}
+
+func TestEvictionRemovesOldestEntry(t *testing.T) {
+	c := New(Config{TTL: time.Hour, MaxEntries: 2})
+	var calls atomic.Int32
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := c.Get(context.Background(), key, counting(&calls, key)); err != nil {
+			t.Fatal(err)
+		}
+		// Keep the stored times apart.
+		time.Sleep(time.Millisecond)
+	}
+	if s := c.Stats(); s.Entries != 2 || s.Evictions != 1 {
+		t.Errorf("stats = %+v, want 2 entries and 1 eviction", s)
+	}
+
+	calls.Store(0)
+	c.Get(context.Background(), "b", counting(&calls, "b"))
+	c.Get(context.Background(), "c", counting(&calls, "c"))
+	if n := calls.Load(); n != 0 {
+		t.Errorf("newer entries were reloaded %d times", n)
+	}
+	c.Get(context.Background(), "a", counting(&calls, "a"))
+	if n := calls.Load(); n != 1 {
+		t.Error("oldest entry was not evicted")
+	}
+}
+
+func TestCancelledCallerDoesNotCancelSharedLoad(t *testing.T) {
+	c := New(Config{TTL: time.Hour})
+	loader := newBlockingLoader()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := c.Get(ctx, "menu", loader.load)
+		first <- err
+	}()
+	loader.waitStarted(t)
+
+	second := make(chan Entry)
+	go func() {
+		e, err := c.Get(context.Background(), "menu", loader.load)
+		if err != nil {
+			t.Error(err)
+		}
+		second <- e
+	}()
+	waitFor(t, "the second caller to miss", func() bool { return c.Stats().Misses == 2 })
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got %v, want context.Canceled", err)
+	}
+	close(loader.release)
+
+	if e := <-second; string(e.Body) != "v1" {
+		t.Errorf("second caller got %q, want v1", e.Body)
+	}
+	if n := loader.calls.Load(); n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+	if err := loader.ctxErr.Load(); err != "<nil>" {
+		t.Errorf("load context error = %v, want none", err)
+	}
+	if n := c.Stats().Entries; n != 1 {
+		t.Errorf("%d entries, want the shared load stored", n)
+	}
+}
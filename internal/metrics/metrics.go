@@ -0,0 +1,139 @@
+// Package metrics collects Prometheus metrics and serves them at /metrics.
+// Everything is registered with Registry rather than the global default, so
+// only this service's metrics are exposed.
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/menucache"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gasthaus"
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "menu_cache_lookups_total",
+		Help:      "Menu cache lookups by cache and result: hit, stale or miss.",
+	}, []string{"cache", "result"})
+
+	uploadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_upload_duration_seconds",
+		Help:      "Duration of requests storing images in Supabase by result: success or failure.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		cacheLookups,
+		uploadDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Middleware counts and times requests. It labels them with the route
+// template rather than the path, which has unbounded values, so it must run
+// inside logging.Middleware to see the route the router recorded.
+func Middleware(next http.Handler) http.Handler {
+	route := promhttp.WithLabelFromCtx("route", logging.Route)
+	return promhttp.InstrumentHandlerCounter(httpRequests,
+		promhttp.InstrumentHandlerDuration(httpDuration, next, route), route)
+}
+
+// ObserveMenuCache counts a menu cache lookup. It is meant for
+// menucache.Config.Observe; the cache name is the key up to the query, e.g.
+// items or categories.
+func ObserveMenuCache(key string, result menucache.Result) {
+	name, _, _ := strings.Cut(key, "?")
+	cacheLookups.WithLabelValues(name, string(result)).Inc()
+}
+
+// ObserveUpload records how long an image upload took and whether it failed.
+func ObserveUpload(start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	uploadDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// RegisterPool exposes the statistics of a connection pool.
+func RegisterPool(pool *pgxpool.Pool) error {
+	return Registry.Register(poolCollector{pool})
+}
+
+var (
+	poolAcquiredConns = prometheus.NewDesc(namespace+"_db_pool_acquired_connections",
+		"Connections currently in use.", nil, nil)
+	poolIdleConns = prometheus.NewDesc(namespace+"_db_pool_idle_connections",
+		"Connections currently idle.", nil, nil)
+	poolTotalConns = prometheus.NewDesc(namespace+"_db_pool_connections",
+		"Connections currently open, including those being established.", nil, nil)
+	poolMaxConns = prometheus.NewDesc(namespace+"_db_pool_max_connections",
+		"Maximum size of the pool.", nil, nil)
+	poolAcquires = prometheus.NewDesc(namespace+"_db_pool_acquires_total",
+		"Successful connection acquires.", nil, nil)
+	poolEmptyAcquires = prometheus.NewDesc(namespace+"_db_pool_empty_acquires_total",
+		"Successful acquires that had to wait for a connection.", nil, nil)
+	poolCanceledAcquires = prometheus.NewDesc(namespace+"_db_pool_canceled_acquires_total",
+		"Acquires canceled by their context.", nil, nil)
+	poolAcquireSeconds = prometheus.NewDesc(namespace+"_db_pool_acquire_seconds_total",
+		"Time spent acquiring connections.", nil, nil)
+	poolWaitSeconds = prometheus.NewDesc(namespace+"_db_pool_wait_seconds_total",
+		"Time spent waiting for a connection because none was idle.", nil, nil)
+)
+
+// poolCollector reads the pool statistics on every scrape.
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquires, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireSeconds, prometheus.CounterValue, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(poolWaitSeconds, prometheus.CounterValue, s.EmptyAcquireWaitTime().Seconds())
+}
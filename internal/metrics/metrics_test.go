@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/menucache"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMiddlewareLabelsRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(logging.RouteMiddleware)
+	r.HandleFunc("/speisekarte/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := logging.Middleware(logging.New(io.Discard, slog.LevelInfo))(Middleware(r))
+
+	for _, path := range []string{"/speisekarte/1", "/speisekarte/2", "/unknown"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("/speisekarte/{id}", "get", "404")); got != 2 {
+		t.Errorf("requests for the item route = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("", "get", "404")); got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+	if n := testutil.CollectAndCount(httpDuration); n != 2 {
+		t.Errorf("got %d duration series, want 2", n)
+	}
+}
+
+func TestObserveMenuCache(t *testing.T) {
+	ObserveMenuCache("items?category=Suppen", menucache.Hit)
+	ObserveMenuCache("items?", menucache.Hit)
+	ObserveMenuCache("categories", menucache.Miss)
+
+	if got := testutil.ToFloat64(cacheLookups.WithLabelValues("items", "hit")); got != 2 {
+		t.Errorf("items hits = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(cacheLookups.WithLabelValues("categories", "miss")); got != 1 {
+		t.Errorf("categories misses = %v, want 1", got)
+	}
+}
+
+func TestObserveUpload(t *testing.T) {
+	ObserveUpload(time.Now(), nil)
+	ObserveUpload(time.Now(), errors.New("upload failed with status 500"))
+	ObserveUpload(time.Now(), errors.New("upload request failed"))
+
+	for result, want := range map[string]uint64{"success": 1, "failure": 2} {
+		var m dto.Metric
+		if err := uploadDuration.WithLabelValues(result).(prometheus.Histogram).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.GetHistogram().GetSampleCount(); got != want {
+			t.Errorf("%s uploads = %d, want %d", result, got, want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	for _, name := range []string{"go_goroutines", "gasthaus_menu_cache_lookups_total"} {
+		if !strings.Contains(rec.Body.String(), name) {
+			t.Errorf("output lacks %s", name)
+		}
+	}
+}
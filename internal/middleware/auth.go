@@ -2,11 +2,12 @@ package middleware
 
 import (
 	"context"
-	"log"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
 )
 
 type contextKey string
@@ -18,13 +19,13 @@ func JWTAuth(secret string) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+				problem.Error(w, r, http.StatusUnauthorized, "authorization_header_missing", "Authorization header missing")
 				return
 			}
 
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || parts[0] != "Bearer" {
-				http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
+				problem.Error(w, r, http.StatusUnauthorized, "invalid_authorization_header", "Invalid authorization header")
 				return
 			}
 
@@ -37,23 +38,24 @@ func JWTAuth(secret string) func(http.Handler) http.Handler {
 				return []byte(secret), nil
 			})
 			if err != nil {
-				log.Printf("JWT validation failed: %v", err)
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				logging.FromContext(r.Context()).Info("JWT validation failed", "err", err)
+				problem.Error(w, r, http.StatusUnauthorized, "invalid_token", "Invalid token")
 				return
 			}
 
 			claims, ok := token.Claims.(jwt.MapClaims)
 			if !ok {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+				problem.Error(w, r, http.StatusUnauthorized, "invalid_token_claims", "Invalid token claims")
 				return
 			}
 
 			userID, ok := claims["sub"].(string)
 			if !ok || userID == "" {
-				http.Error(w, "Invalid token subject", http.StatusUnauthorized)
+				problem.Error(w, r, http.StatusUnauthorized, "invalid_token_subject", "Invalid token subject")
 				return
 			}
 
+			logging.SetUserID(r.Context(), userID)
 			ctx := context.WithValue(r.Context(), UserIDKey, userID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -9,36 +10,66 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
-func RunMigrations() error {
-	connString := os.Getenv("DATABASE_URL")
-	if connString == "" {
-		return fmt.Errorf("DATABASE_URL environment variable not set")
-	}
+// RunMigrations applies the pending migrations in migrationPath to the
+// database at connString.
+func RunMigrations(connString, migrationPath string) error {
+	wd, _ := os.Getwd()
+	slog.Info("Running migrations", "path", migrationPath, "working_directory", wd)
 
-	migrationPath := os.Getenv("MIGRATIONS_PATH")
-	if migrationPath == "" {
-		migrationPath = "db/migrations"
+	if err := MigrateUp(connString, migrationPath); err != nil {
+		if err == migrate.ErrNoChange {
+			slog.Info("No new migrations to apply")
+			return nil
+		}
+		return err
 	}
 
-	wd, _ := os.Getwd()
-	fmt.Printf("Running migrations from '%s' (working directory: %s)\n", migrationPath, wd)
+	slog.Info("Migrations applied")
+	return nil
+}
 
-	m, err := migrate.New(
-		"file://"+migrationPath,
-		connString,
-	)
+// MigrateUp applies the pending migrations in migrationPath to the database
+// at connString. It returns migrate.ErrNoChange if there were none.
+func MigrateUp(connString, migrationPath string) error {
+	m, err := NewMigrate(connString, migrationPath)
 	if err != nil {
-		return fmt.Errorf("migration setup failed: %w", err)
+		return err
 	}
+	defer m.Close()
 
 	if err := m.Up(); err != nil {
 		if err == migrate.ErrNoChange {
-			fmt.Println("No new migrations to apply.")
-			return nil
+			return err
 		}
 		return fmt.Errorf("migration failed: %w", err)
 	}
+	return nil
+}
 
-	fmt.Println("Migrations applied successfully!")
+// MigrateDown reverts every applied migration in migrationPath, leaving the
+// database at connString as it was before the first one.
+func MigrateDown(connString, migrationPath string) error {
+	m, err := NewMigrate(connString, migrationPath)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Down(); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("migration failed: %w", err)
+	}
 	return nil
+}
+
+// NewMigrate returns a migrator for the migrations in migrationPath and the
+// database at connString. The caller closes it.
+func NewMigrate(connString, migrationPath string) (*migrate.Migrate, error) {
+	m, err := migrate.New(
+		"file://"+migrationPath,
+		connString,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("migration setup failed: %w", err)
+	}
+	return m, nil
 }
\ No newline at end of file
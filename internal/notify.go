@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	listenMinBackoff = time.Second
+	listenMaxBackoff = 30 * time.Second
+)
+
+// Listen receives notifications on channel over a dedicated connection until
+// ctx is cancelled. Pooled connections cannot be used because LISTEN is tied
+// to a session. onNotify is called with each payload; onConnect is called
+// every time the LISTEN is (re)established, since notifications sent while
+// disconnected are lost.
+func Listen(ctx context.Context, config *pgx.ConnConfig, channel string, onConnect func(), onNotify func(payload string)) {
+	backoff := listenMinBackoff
+	for {
+		err := listenOnce(ctx, config, channel, func() {
+			backoff = listenMinBackoff
+			onConnect()
+		}, onNotify)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("Listener disconnected", "channel", channel, "err", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, listenMaxBackoff)
+	}
+}
+
+func listenOnce(ctx context.Context, config *pgx.ConnConfig, channel string, onConnect func(), onNotify func(payload string)) error {
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("unable to listen: %w", err)
+	}
+	onConnect()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		onNotify(notification.Payload)
+	}
+}
@@ -0,0 +1,156 @@
+// Package problem writes error responses as RFC 9457 problem details
+// (application/problem+json).
+//
+// Every problem has a stable, machine-readable code. Validation problems
+// list the failing fields, and internal errors only carry the request id,
+// never the underlying error.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/requestid"
+)
+
+const (
+	ContentType = "application/problem+json"
+
+	typePrefix = "urn:gasthaus:problem:"
+
+	CodeInternal   = "internal_error"
+	CodeValidation = "validation_failed"
+)
+
+// FieldError describes why one input field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Problem struct {
+	Status int
+	Code   string
+	Detail string
+	Errors []FieldError
+	// Extensions are added as further members of the problem object.
+	Extensions map[string]any
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{Status: status, Code: code, Detail: detail}
+}
+
+// Validation reports invalid input with one entry per failing field.
+func Validation(errs ...FieldError) *Problem {
+	return &Problem{
+		Status: http.StatusBadRequest,
+		Code:   CodeValidation,
+		Detail: "The request contains invalid fields",
+		Errors: errs,
+	}
+}
+
+// Field is shorthand for a FieldError.
+func Field(field, code, message string) FieldError {
+	return FieldError{Field: field, Code: code, Message: message}
+}
+
+// With returns a copy of p with an extension member set.
+func (p *Problem) With(key string, value any) *Problem {
+	c := *p
+	c.Extensions = maps.Clone(p.Extensions)
+	if c.Extensions == nil {
+		c.Extensions = make(map[string]any)
+	}
+	c.Extensions[key] = value
+	return &c
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return http.StatusText(p.Status)
+}
+
+// Write sends p with the request's path as its instance and the request id.
+// r may be nil when there is no request to refer to.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	body := make(map[string]any, len(p.Extensions)+7)
+	maps.Copy(body, p.Extensions)
+	body["type"] = typePrefix + p.Code
+	body["title"] = http.StatusText(p.Status)
+	body["status"] = p.Status
+	body["code"] = p.Code
+	if p.Detail != "" {
+		body["detail"] = p.Detail
+	}
+	if len(p.Errors) > 0 {
+		body["errors"] = p.Errors
+	}
+	if r != nil {
+		body["instance"] = r.URL.Path
+		if id := requestid.FromContext(r.Context()); id != "" {
+			body["request_id"] = id
+		}
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logging.FromContext(requestContext(r)).Error("Error encoding problem response", "err", err)
+	}
+}
+
+// Error writes a problem with the given status, code and detail.
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	Write(w, r, New(status, code, detail))
+}
+
+// Internal writes a 500 problem. Log the cause before calling it; the
+// client only receives the request id.
+func Internal(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, New(http.StatusInternalServerError, CodeInternal, ""))
+}
+
+// WriteError writes err if it is a *Problem, or a 500 otherwise.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var p *Problem
+	if errors.As(err, &p) {
+		Write(w, r, p)
+		return
+	}
+	logging.FromContext(requestContext(r)).Error("Unexpected error", "err", err)
+	Internal(w, r)
+}
+
+// requestContext returns r's context, or the background context if r is
+// nil, for logging.
+func requestContext(r *http.Request) context.Context {
+	if r == nil {
+		return context.Background()
+	}
+	return r.Context()
+}
+
+// NotFoundHandler answers requests that match no route.
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, http.StatusNotFound, "route_not_found", "No such endpoint")
+	})
+}
+
+// MethodNotAllowedHandler answers requests whose path matches a route but
+// whose method does not.
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed for this endpoint")
+	})
+}
@@ -0,0 +1,167 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gomisroca/gasthaus-backend/internal/requestid"
+)
+
+// write runs fn for a request to /speisekarte/42 with request id "req-1"
+// and decodes the problem it writes.
+func write(t *testing.T, fn func(http.ResponseWriter, *http.Request)) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/speisekarte/42?fields=name", nil)
+	r = r.WithContext(requestid.NewContext(r.Context(), "req-1"))
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Length", "12")
+	fn(rec, r)
+
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != "" {
+		t.Errorf("Content-Length = %q left from before the error", cl)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding problem: %v; body: %s", err, rec.Body)
+	}
+	return rec, body
+}
+
+func TestWrite(t *testing.T) {
+	rec, body := write(t, func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, http.StatusConflict, "duplicate_item_name", "Item with this name already exists")
+	})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	want := map[string]any{
+		"type":       "urn:gasthaus:problem:duplicate_item_name",
+		"title":      "Conflict",
+		"status":     float64(http.StatusConflict),
+		"code":       "duplicate_item_name",
+		"detail":     "Item with this name already exists",
+		"instance":   "/speisekarte/42",
+		"request_id": "req-1",
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("body = %v, want %v", body, want)
+	}
+}
+
+func TestWriteValidation(t *testing.T) {
+	rec, body := write(t, func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, Validation(
+			Field("name", "required", "name is required"),
+			Field("price_cents", "too_small", "price_cents must be at least 0"),
+		))
+	})
+	if rec.Code != http.StatusBadRequest || body["code"] != CodeValidation {
+		t.Fatalf("status %d, code %v; want 400 %s", rec.Code, body["code"], CodeValidation)
+	}
+	want := []any{
+		map[string]any{"field": "name", "code": "required", "message": "name is required"},
+		map[string]any{"field": "price_cents", "code": "too_small", "message": "price_cents must be at least 0"},
+	}
+	if !reflect.DeepEqual(body["errors"], want) {
+		t.Errorf("errors = %v, want %v", body["errors"], want)
+	}
+}
+
+func TestWithAddsExtension(t *testing.T) {
+	p := New(http.StatusPreconditionFailed, "precondition_failed", "Item has changed")
+	extended := p.With("current_etag", `"42-3"`).With("version", 3)
+	if p.Extensions != nil {
+		t.Errorf("With changed the original: %v", p.Extensions)
+	}
+
+	_, body := write(t, func(w http.ResponseWriter, r *http.Request) { Write(w, r, extended) })
+	if body["current_etag"] != `"42-3"` || body["version"] != float64(3) {
+		t.Errorf("body = %v, want the extension members", body)
+	}
+	// Standard members win over extensions of the same name.
+	_, body = write(t, func(w http.ResponseWriter, r *http.Request) { Write(w, r, p.With("status", "ok")) })
+	if body["status"] != float64(http.StatusPreconditionFailed) {
+		t.Errorf("status = %v, want it not overridden", body["status"])
+	}
+}
+
+func TestInternal(t *testing.T) {
+	for name, fn := range map[string]func(http.ResponseWriter, *http.Request){
+		"internal":    Internal,
+		"plain error": func(w http.ResponseWriter, r *http.Request) { WriteError(w, r, errors.New("connection refused")) },
+		"wrapped error": func(w http.ResponseWriter, r *http.Request) {
+			WriteError(w, r, fmt.Errorf("saving: %w", errors.New("boom")))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec, body := write(t, fn)
+			if rec.Code != http.StatusInternalServerError || body["code"] != CodeInternal {
+				t.Fatalf("status %d, code %v; want 500 %s", rec.Code, body["code"], CodeInternal)
+			}
+			if _, ok := body["detail"]; ok {
+				t.Errorf("internal error has a detail: %v", body)
+			}
+			if body["request_id"] != "req-1" {
+				t.Errorf("request_id = %v, want req-1", body["request_id"])
+			}
+		})
+	}
+}
+
+func TestWriteErrorUnwrapsProblems(t *testing.T) {
+	rec, body := write(t, func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, fmt.Errorf("importing: %w", New(http.StatusRequestEntityTooLarge, "file_too_large", "File is too large")))
+	})
+	if rec.Code != http.StatusRequestEntityTooLarge || body["code"] != "file_too_large" {
+		t.Errorf("status %d, code %v; want the wrapped problem", rec.Code, body["code"])
+	}
+}
+
+func TestWriteWithoutRequest(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Write(rec, nil, New(http.StatusServiceUnavailable, "unavailable", ""))
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["instance"]; ok {
+		t.Errorf("body = %v, want no instance without a request", body)
+	}
+
+	// An extension that cannot be encoded is logged, not a panic.
+	rec = httptest.NewRecorder()
+	Write(rec, nil, New(http.StatusBadRequest, "bad", "").With("callback", func() {}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec = httptest.NewRecorder()
+	WriteError(rec, nil, errors.New("boom"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRoutingHandlers(t *testing.T) {
+	tests := []struct {
+		handler    http.Handler
+		wantStatus int
+		wantCode   string
+	}{
+		{handler: NotFoundHandler(), wantStatus: http.StatusNotFound, wantCode: "route_not_found"},
+		{handler: MethodNotAllowedHandler(), wantStatus: http.StatusMethodNotAllowed, wantCode: "method_not_allowed"},
+	}
+	for _, tt := range tests {
+		rec, body := write(t, tt.handler.ServeHTTP)
+		if rec.Code != tt.wantStatus || body["code"] != tt.wantCode {
+			t.Errorf("status %d, code %v; want %d %s", rec.Code, body["code"], tt.wantStatus, tt.wantCode)
+		}
+	}
+}
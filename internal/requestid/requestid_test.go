@@ -0,0 +1,69 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		// keep is whether the incoming id is used.
+		keep bool
+	}{
+		{name: "none"},
+		{name: "from a proxy", incoming: "fly-abc_123.4", keep: true},
+		{name: "longest allowed", incoming: strings.Repeat("a", maxLength), keep: true},
+		{name: "too long", incoming: strings.Repeat("a", maxLength+1)},
+		{name: "spaces", incoming: "abc def"},
+		{name: "header injection", incoming: "abc\r\nSet-Cookie: x"},
+		{name: "non-ASCII", incoming: "äbc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = FromContext(r.Context())
+			}))
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set(Header, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if got := rec.Header().Get(Header); got != seen || seen == "" {
+				t.Fatalf("response id %q, context id %q; want the same non-empty id", got, seen)
+			}
+			if tt.keep && seen != tt.incoming {
+				t.Errorf("id = %q, want the incoming %q", seen, tt.incoming)
+			}
+			if !tt.keep && (seen == tt.incoming || !valid(seen)) {
+				t.Errorf("id = %q, want a new one", seen)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	a, b := New(), New()
+	if len(a) != 32 || !valid(a) {
+		t.Errorf("New() = %q, want 32 hex digits", a)
+	}
+	if a == b {
+		t.Errorf("New() returned %q twice", a)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if id := FromContext(context.Background()); id != "" {
+		t.Errorf("FromContext outside of Middleware = %q, want empty", id)
+	}
+	if id := FromContext(NewContext(context.Background(), "req-1")); id != "req-1" {
+		t.Errorf("FromContext = %q, want req-1", id)
+	}
+}
@@ -8,9 +8,14 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
-	"os"
+	"strings"
+	"time"
 
+	"github.com/gomisroca/gasthaus-backend/internal/metrics"
+	"github.com/gomisroca/gasthaus-backend/internal/tracing"
 	"github.com/lucsky/cuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 const maxUploadSize = 5 << 20 // 5MB
@@ -21,16 +26,28 @@ var allowedMIMETypes = map[string]bool{
 	"image/webp": true,
 }
 
-func UploadToSupabase(ctx context.Context, file multipart.File, handler *multipart.FileHeader) (string, error) {
-	// Validate env vars
-	projectRef := os.Getenv("SUPABASE_PROJECT_REF")
-	if projectRef == "" {
-		return "", fmt.Errorf("SUPABASE_PROJECT_REF environment variable not set")
-	}
-	serviceRoleKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-	if serviceRoleKey == "" {
-		return "", fmt.Errorf("SUPABASE_SERVICE_ROLE_KEY environment variable not set")
+// Supabase stores uploaded images in a Supabase project's storage.
+type Supabase struct {
+	ProjectRef     string
+	ServiceRoleKey string
+}
+
+// Upload stores the image and returns its public URL. A nil or empty
+// Supabase rejects every upload.
+func (s *Supabase) Upload(ctx context.Context, file multipart.File, handler *multipart.FileHeader) (_ string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "supabase.Upload")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if s == nil || s.ProjectRef == "" || s.ServiceRoleKey == "" {
+		return "", fmt.Errorf("image uploads are not configured")
 	}
+	projectRef := s.ProjectRef
 
 	// Validate MIME type
 	contentType := handler.Header.Get("Content-Type")
@@ -58,25 +75,77 @@ func UploadToSupabase(ctx context.Context, file multipart.File, handler *multipa
 	filePath := fmt.Sprintf("uploads/%s", c)
 	url := fmt.Sprintf("https://%s.supabase.co/storage/v1/object/%s/%s", projectRef, bucket, filePath)
 
-	// Build and send upload request
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(buf.Bytes()))
+	span.SetAttributes(attribute.String("image.content_type", contentType), attribute.Int("image.size", buf.Len()))
+	start := time.Now()
+	err = s.put(ctx, url, contentType, buf.Bytes())
+	metrics.ObserveUpload(start, err)
+	if err != nil {
+		return "", err
+	}
+
+	publicURL := fmt.Sprintf("https://%s.supabase.co/storage/v1/object/public/%s/%s", projectRef, bucket, filePath)
+	return publicURL, nil
+}
+
+// put sends an object to storage.
+func (s *Supabase) put(ctx context.Context, url, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
-		return "", fmt.Errorf("failed to create upload request: %w", err)
+		return fmt.Errorf("failed to create upload request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+serviceRoleKey)
+	req.Header.Set("Authorization", "Bearer "+s.ServiceRoleKey)
 	req.Header.Set("Content-Type", contentType)
 
-	client := &http.Client{}
+	client := &http.Client{Transport: tracing.Transport(http.DefaultTransport)}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("upload request failed: %w", err)
+		return fmt.Errorf("upload request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		return "", fmt.Errorf("upload failed with status %s", resp.Status)
+		return fmt.Errorf("upload failed with status %s", resp.Status)
 	}
+	return nil
+}
 
-	publicURL := fmt.Sprintf("https://%s.supabase.co/storage/v1/object/public/%s/%s", projectRef, bucket, filePath)
-	return publicURL, nil
+// Delete removes an image that Upload returned. It is used when the change
+// the image was uploaded for is not saved.
+func (s *Supabase) Delete(ctx context.Context, publicURL string) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "supabase.Delete")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if s == nil || s.ProjectRef == "" || s.ServiceRoleKey == "" {
+		return fmt.Errorf("image uploads are not configured")
+	}
+	prefix := fmt.Sprintf("https://%s.supabase.co/storage/v1/object/public/", s.ProjectRef)
+	object, ok := strings.CutPrefix(publicURL, prefix)
+	if !ok {
+		return fmt.Errorf("not an uploaded image: %s", publicURL)
+	}
+
+	url := fmt.Sprintf("https://%s.supabase.co/storage/v1/object/%s", s.ProjectRef, object)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.ServiceRoleKey)
+
+	client := &http.Client{Transport: tracing.Transport(http.DefaultTransport)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("delete request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("delete failed with status %s", resp.Status)
+	}
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,137 @@
+// Package testdb provides throwaway PostgreSQL databases for integration
+// tests.
+//
+// It needs a locally installed server. TEST_DATABASE_URL names a database
+// on it that the tests may connect to with the right to create databases;
+// it defaults to DefaultURL. New creates a fresh database next to it and
+// migrates it up; Close migrates it down again and drops it, so both
+// directions of every migration are exercised.
+package testdb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gomisroca/gasthaus-backend/internal"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultURL is the server used when TEST_DATABASE_URL is not set.
+const DefaultURL = "postgres://postgres@localhost:5432/postgres?sslmode=disable"
+
+// ErrUnavailable is returned by New when no server can be reached. Tests
+// should skip rather than fail in that case.
+var ErrUnavailable = errors.New("testdb: no PostgreSQL server available")
+
+type DB struct {
+	// URL is the connection string of the database.
+	URL string
+	// Pool is connected to the database.
+	Pool *pgxpool.Pool
+
+	name          string
+	serverURL     string
+	migrationPath string
+}
+
+// New creates a database with a unique name and applies all migrations in
+// db/migrations to it.
+func New(ctx context.Context) (*DB, error) {
+	serverURL := os.Getenv("TEST_DATABASE_URL")
+	if serverURL == "" {
+		serverURL = DefaultURL
+	}
+	migrationPath, err := MigrationPath()
+	if err != nil {
+		return nil, err
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := pgx.Connect(connectCtx, serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close(ctx)
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	db := &DB{
+		name:          "gasthaus_test_" + hex.EncodeToString(suffix),
+		serverURL:     serverURL,
+		migrationPath: migrationPath,
+	}
+	if db.URL, err = withDatabase(serverURL, db.name); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{db.name}.Sanitize()); err != nil {
+		return nil, fmt.Errorf("failed to create test database: %w", err)
+	}
+	if err := internal.MigrateUp(db.URL, migrationPath); err != nil {
+		return nil, errors.Join(err, db.drop(ctx))
+	}
+	if db.Pool, err = pgxpool.New(ctx, db.URL); err != nil {
+		return nil, errors.Join(err, db.drop(ctx))
+	}
+	return db, nil
+}
+
+// Close reverts all migrations, which fails if a down migration is broken,
+// and drops the database.
+func (db *DB) Close(ctx context.Context) error {
+	db.Pool.Close()
+	downErr := internal.MigrateDown(db.URL, db.migrationPath)
+	return errors.Join(downErr, db.drop(ctx))
+}
+
+func (db *DB) drop(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, db.serverURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, "DROP DATABASE IF EXISTS "+pgx.Identifier{db.name}.Sanitize()+" WITH (FORCE)")
+	if err != nil {
+		return fmt.Errorf("failed to drop test database: %w", err)
+	}
+	return nil
+}
+
+// withDatabase returns serverURL with its database replaced by name.
+func withDatabase(serverURL, name string) (string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Scheme == "" {
+		return "", fmt.Errorf("testdb: TEST_DATABASE_URL must be a postgres:// URL")
+	}
+	u.Path = "/" + name
+	return u.String(), nil
+}
+
+// MigrationPath returns the absolute path of db/migrations, found by walking
+// up from the working directory to the module root.
+func MigrationPath() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return filepath.Join(dir, "db", "migrations"), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("testdb: module root not found")
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// record installs a tracer provider that keeps finished spans in memory.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+
+	r := mux.NewRouter()
+	r.Use(RouteMiddleware)
+	r.HandleFunc("/speisekarte/{id}", func(w http.ResponseWriter, r *http.Request) {
+		QueryTracer{}.TraceQueryEnd(QueryTracer{}.TraceQueryStart(r.Context(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"}), nil, pgx.TraceQueryEndData{})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/speisekarte/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	Middleware(r).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want the query and the request", len(spans))
+	}
+	query, server := spans[0], spans[1]
+	if server.Name() != "GET /speisekarte/{id}" {
+		t.Errorf("server span = %q, want it named after the route", server.Name())
+	}
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace id = %s, want the caller's", got)
+	}
+	if query.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("query span is not a child of the request")
+	}
+}
+
+func TestMiddlewareUnmatchedRoute(t *testing.T) {
+	recorder := record(t)
+	r := mux.NewRouter()
+	r.Use(RouteMiddleware)
+
+	Middleware(r).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nope", nil))
+
+	if spans := recorder.Ended(); len(spans) != 1 || spans[0].Name() != "POST" {
+		t.Errorf("spans = %v, want one named POST", spans)
+	}
+}
+
+func TestSetupWithoutExporterIgnoresCallerTrace(t *testing.T) {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	shutdown, err := Setup(context.Background(), "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	var traceID trace.TraceID
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID = trace.SpanContextFromContext(r.Context()).TraceID()
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if traceID.IsValid() {
+		t.Errorf("trace id = %s, want none without an exporter", traceID)
+	}
+}
+
+func TestQueryTracerRecordsErrors(t *testing.T) {
+	recorder := record(t)
+	ctx := QueryTracer{}.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+		SQL:  "UPDATE speisekarte SET name = $1 WHERE id = $2",
+		Args: []any{"secret", 1},
+	})
+	QueryTracer{}.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("deadlock detected")})
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "UPDATE" {
+		t.Errorf("name = %q, want UPDATE", span.Name())
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("status = %v, want an error", span.Status())
+	}
+	for _, attr := range span.Attributes() {
+		if attr.Value.AsString() == "secret" {
+			t.Errorf("query argument recorded in %s", attr.Key)
+		}
+	}
+}
+
+func TestQueryOperation(t *testing.T) {
+	tests := map[string]string{
+		"SELECT id FROM speisekarte":                      "SELECT",
+		"\n\t\tinsert into users (email) values ($1)":     "INSERT",
+		"-- purge the trash\nDELETE FROM speisekarte":     "DELETE",
+		"WITH moved AS (SELECT 1) UPDATE speisekarte SET": "WITH",
+		"SELECT\tid FROM users":                           "SELECT",
+		"begin;":                                          "BEGIN",
+		"":                                                "QUERY",
+	}
+	for sql, want := range tests {
+		if got := queryOperation(sql); got != want {
+			t.Errorf("queryOperation(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+)
+
+// MaxBodySize bounds the JSON bodies read by DecodeJSON.
+const MaxBodySize = 1 << 20
+
+// DecodeJSON decodes a single JSON value from body into v. Unknown fields
+// and values of the wrong type are reported per field as a validation
+// *problem.Problem; anything else that is not valid JSON as a bad request.
+// An empty body returns io.EOF, for callers where the body is optional.
+func DecodeJSON(body io.Reader, v any) error {
+	dec := json.NewDecoder(io.LimitReader(body, MaxBodySize))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == nil {
+		if dec.More() {
+			return problem.New(http.StatusBadRequest, "invalid_request_body", "Request body must be a single JSON value")
+		}
+		return nil
+	}
+
+	if err == io.EOF {
+		return err
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return problem.Validation(problem.Field(typeErr.Field, "invalid_type",
+			typeErr.Field+" must be of type "+typeErr.Type.String()))
+	}
+	// encoding/json has no typed error for unknown fields.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		return problem.Validation(problem.Field(field, "unknown_field", field+" is not a known field"))
+	}
+	return problem.New(http.StatusBadRequest, "invalid_request_body", "Invalid request body")
+}
@@ -0,0 +1,63 @@
+package validate
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	type body struct {
+		Name  string `json:"name"`
+		Price int    `json:"price_cents"`
+	}
+	tests := []struct {
+		name      string
+		in        string
+		want      body
+		wantEOF   bool
+		wantCode  string
+		wantField string
+	}{
+		{name: "valid", in: `{"name":"Strudel","price_cents":690}`, want: body{Name: "Strudel", Price: 690}},
+		{name: "trailing whitespace", in: "{\"name\":\"Strudel\"}\n", want: body{Name: "Strudel"}},
+		{name: "empty body", in: "", wantEOF: true},
+		{name: "unknown field", in: `{"name":"Strudel","colour":"gold"}`, wantCode: problem.CodeValidation, wantField: "colour"},
+		{name: "wrong type", in: `{"price_cents":"cheap"}`, wantCode: problem.CodeValidation, wantField: "price_cents"},
+		{name: "trailing value", in: `{"name":"Strudel"} {"name":"Torte"}`, wantCode: "invalid_request_body"},
+		{name: "not JSON", in: `name=Strudel`, wantCode: "invalid_request_body"},
+		{name: "truncated", in: `{"name":`, wantCode: "invalid_request_body"},
+		{name: "too large", in: `{"name":"` + strings.Repeat("a", MaxBodySize) + `"}`, wantCode: "invalid_request_body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got body
+			err := DecodeJSON(strings.NewReader(tt.in), &got)
+			switch {
+			case tt.wantEOF:
+				if err != io.EOF {
+					t.Fatalf("err = %v, want io.EOF", err)
+				}
+			case tt.wantCode != "":
+				var p *problem.Problem
+				if !errors.As(err, &p) || p.Code != tt.wantCode || p.Status != http.StatusBadRequest {
+					t.Fatalf("err = %v, want a 400 problem %q", err, tt.wantCode)
+				}
+				if tt.wantField != "" && (len(p.Errors) != 1 || p.Errors[0].Field != tt.wantField) {
+					t.Errorf("field errors = %+v, want one for %s", p.Errors, tt.wantField)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("decoded %+v, want %+v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+// Package validate checks and normalises request input declaratively.
+//
+// Each field is checked against a list of rules. Rules may normalise the
+// value in place (trimming, removing duplicates), and the first failing rule
+// of a field is reported. All fields are checked, so a client receives every
+// error at once:
+//
+//	v := validate.New()
+//	v.String("name", &in.Name, validate.Trim, validate.Required, validate.MaxLength(100))
+//	v.Int("price_cents", in.PriceCents, validate.Min(0))
+//	if err := v.Err(); err != nil { ... }
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+)
+
+// Rule checks, and may normalise, a single value. It returns a Failure to
+// reject it.
+type Rule[T any] func(value *T) *Failure
+
+// Failure is a rejected value's error code and message. The field name is
+// added by the Validator.
+type Failure struct {
+	Code    string
+	Message string
+}
+
+func fail(code, format string, args ...any) *Failure {
+	return &Failure{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+type Validator struct {
+	errs []problem.FieldError
+}
+
+func New() *Validator {
+	return &Validator{}
+}
+
+func check[T any](v *Validator, field string, value *T, rules []Rule[T]) {
+	for _, rule := range rules {
+		if f := rule(value); f != nil {
+			v.errs = append(v.errs, problem.Field(field, f.Code, field+" "+f.Message))
+			return
+		}
+	}
+}
+
+func (v *Validator) String(field string, value *string, rules ...Rule[string]) {
+	check(v, field, value, rules)
+}
+
+// OptionalString checks value unless it is nil. Use EmptyToNil first to
+// treat blank values as absent.
+func (v *Validator) OptionalString(field string, value **string, rules ...Rule[string]) {
+	if *value == nil {
+		return
+	}
+	check(v, field, *value, rules)
+}
+
+func (v *Validator) Strings(field string, value *[]string, rules ...Rule[[]string]) {
+	check(v, field, value, rules)
+}
+
+func (v *Validator) Int(field string, value int, rules ...Rule[int]) {
+	check(v, field, &value, rules)
+}
+
+// Add records an error found outside of the declared rules.
+func (v *Validator) Add(field, code, message string) {
+	v.errs = append(v.errs, problem.Field(field, code, message))
+}
+
+// Errors returns a copy of the collected field errors ordered by field, so
+// the order doesn't depend on the order the fields were checked in.
+func (v *Validator) Errors() []problem.FieldError {
+	errs := slices.Clone(v.errs)
+	slices.SortStableFunc(errs, func(a, b problem.FieldError) int { return strings.Compare(a.Field, b.Field) })
+	return errs
+}
+
+// Err returns a validation *problem.Problem listing Errors, or nil if every
+// field passed.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return problem.Validation(v.Errors()...)
+}
+
+// Trim removes surrounding whitespace and collapses inner runs of
+// whitespace to a single space.
+func Trim(s *string) *Failure {
+	*s = strings.Join(strings.Fields(*s), " ")
+	return nil
+}
+
+// TrimLines trims like Trim but keeps line breaks, for multi-line text.
+func TrimLines(s *string) *Failure {
+	lines := strings.Split(strings.ReplaceAll(*s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	*s = strings.TrimSpace(strings.Join(lines, "\n"))
+	return nil
+}
+
+func Required(s *string) *Failure {
+	if *s == "" {
+		return fail("required", "is required")
+	}
+	return nil
+}
+
+func MaxLength(n int) Rule[string] {
+	return func(s *string) *Failure {
+		if utf8.RuneCountInString(*s) > n {
+			return fail("too_long", "must be at most %d characters", n)
+		}
+		return nil
+	}
+}
+
+// MaxBytes limits the encoded length, for values such as passwords whose
+// consumers count bytes rather than characters.
+func MaxBytes(n int) Rule[string] {
+	return func(s *string) *Failure {
+		if len(*s) > n {
+			return fail("too_long", "must be at most %d bytes", n)
+		}
+		return nil
+	}
+}
+
+// Email accepts a bare address such as "name@example.com", without a
+// display name.
+func Email(s *string) *Failure {
+	addr, err := mail.ParseAddress(*s)
+	if err != nil || addr.Address != *s {
+		return fail("invalid", "must be a valid email address")
+	}
+	return nil
+}
+
+// NoControl rejects control characters other than line breaks and tabs.
+func NoControl(s *string) *Failure {
+	for _, r := range *s {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return fail("invalid_characters", "must not contain control characters")
+		}
+	}
+	return nil
+}
+
+// Matches rejects values that do not match re; description says what is
+// allowed, e.g. "letters, digits and punctuation".
+func Matches(re *regexp.Regexp, description string) Rule[string] {
+	return func(s *string) *Failure {
+		if !re.MatchString(*s) {
+			return fail("invalid_characters", "may only contain %s", description)
+		}
+		return nil
+	}
+}
+
+// OneOf rejects values outside of allowed.
+func OneOf(allowed ...string) Rule[string] {
+	return func(s *string) *Failure {
+		if !slices.Contains(allowed, *s) {
+			return fail("invalid", "must be one of %s", strings.Join(allowed, ", "))
+		}
+		return nil
+	}
+}
+
+// EmptyToNil clears an optional string that is blank after trimming.
+func EmptyToNil(s **string) {
+	if *s != nil && strings.TrimSpace(**s) == "" {
+		*s = nil
+	}
+}
+
+// Each applies string rules to every element, reporting the first failure.
+func Each(rules ...Rule[string]) Rule[[]string] {
+	return func(list *[]string) *Failure {
+		for i := range *list {
+			for _, rule := range rules {
+				if f := rule(&(*list)[i]); f != nil {
+					f.Message = fmt.Sprintf("entry %d %s", i+1, f.Message)
+					return f
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// Compact trims every element and drops empty ones and duplicates, keeping
+// the first occurrence. Duplicates are compared case-insensitively.
+func Compact(list *[]string) *Failure {
+	out := make([]string, 0, len(*list))
+	seen := make(map[string]bool, len(*list))
+	for _, s := range *list {
+		s = strings.Join(strings.Fields(s), " ")
+		key := strings.ToLower(s)
+		if s == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, s)
+	}
+	*list = out
+	return nil
+}
+
+func MinItems(n int) Rule[[]string] {
+	return func(list *[]string) *Failure {
+		if len(*list) < n {
+			if n == 1 {
+				return fail("required", "must not be empty")
+			}
+			return fail("too_few", "must have at least %d entries", n)
+		}
+		return nil
+	}
+}
+
+func MaxItems(n int) Rule[[]string] {
+	return func(list *[]string) *Failure {
+		if len(*list) > n {
+			return fail("too_many", "must have at most %d entries", n)
+		}
+		return nil
+	}
+}
+
+func Min(n int) Rule[int] {
+	return func(v *int) *Failure {
+		if *v < n {
+			return fail("too_small", "must be at least %d", n)
+		}
+		return nil
+	}
+}
+
+func Max(n int) Rule[int] {
+	return func(v *int) *Failure {
+		if *v > n {
+			return fail("too_large", "must be at most %d", n)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,170 @@
+package validate
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+)
+
+func TestStringRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule[string]
+		in       string
+		want     string
+		wantCode string
+	}{
+		{name: "trim", rule: Trim, in: "  Wiener \t Schnitzel \n", want: "Wiener Schnitzel"},
+		{name: "trim lines", rule: TrimLines, in: " erste  Zeile \r\n\n  zweite\t Zeile \n", want: "erste Zeile\n\nzweite Zeile"},
+		{name: "required", rule: Required, in: "", wantCode: "required"},
+		{name: "required present", rule: Required, in: "x", want: "x"},
+		{name: "max length counts characters", rule: MaxLength(5), in: "Käse!", want: "Käse!"},
+		{name: "max length exceeded", rule: MaxLength(4), in: "Käse!", wantCode: "too_long"},
+		{name: "max bytes counts bytes", rule: MaxBytes(5), in: "Käse!", wantCode: "too_long"},
+		{name: "email", rule: Email, in: "gast@example.com", want: "gast@example.com"},
+		{name: "email with display name", rule: Email, in: "Gast <gast@example.com>", wantCode: "invalid"},
+		{name: "email without domain", rule: Email, in: "gast", wantCode: "invalid"},
+		{name: "line breaks and tabs", rule: NoControl, in: "a\nb\tc", want: "a\nb\tc"},
+		{name: "control character", rule: NoControl, in: "a\x00b", wantCode: "invalid_characters"},
+		{name: "matches", rule: Matches(regexp.MustCompile(`^[a-z]+$`), "letters"), in: "abc", want: "abc"},
+		{name: "does not match", rule: Matches(regexp.MustCompile(`^[a-z]+$`), "letters"), in: "ab1", wantCode: "invalid_characters"},
+		{name: "one of", rule: OneOf("json", "csv"), in: "csv", want: "csv"},
+		{name: "not one of", rule: OneOf("json", "csv"), in: "xml", wantCode: "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := tt.in
+			f := tt.rule(&value)
+			if tt.wantCode != "" {
+				if f == nil || f.Code != tt.wantCode {
+					t.Fatalf("failure = %+v, want code %q", f, tt.wantCode)
+				}
+				return
+			}
+			if f != nil {
+				t.Fatalf("unexpected failure %+v", f)
+			}
+			if value != tt.want {
+				t.Errorf("value = %q, want %q", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestListRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule[[]string]
+		in       []string
+		want     []string
+		wantCode string
+		wantMsg  string
+	}{
+		{name: "compact", rule: Compact, in: []string{" Käse ", "", "käse", "Zwiebeln  rot", "  "}, want: []string{"Käse", "Zwiebeln rot"}},
+		{name: "min one", rule: MinItems(1), in: nil, wantCode: "required"},
+		{name: "min two", rule: MinItems(2), in: []string{"a"}, wantCode: "too_few"},
+		{name: "max", rule: MaxItems(1), in: []string{"a", "b"}, wantCode: "too_many"},
+		{name: "each", rule: Each(MaxLength(3)), in: []string{"abc", "de"}, want: []string{"abc", "de"}},
+		{name: "each names the entry", rule: Each(MaxLength(3)), in: []string{"abc", "defg"}, wantCode: "too_long", wantMsg: "entry 2 must be at most 3 characters"},
+		{name: "each normalises", rule: Each(Trim), in: []string{" a ", "b  c"}, want: []string{"a", "b c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := slices.Clone(tt.in)
+			f := tt.rule(&value)
+			if tt.wantCode != "" {
+				if f == nil || f.Code != tt.wantCode {
+					t.Fatalf("failure = %+v, want code %q", f, tt.wantCode)
+				}
+				if tt.wantMsg != "" && f.Message != tt.wantMsg {
+					t.Errorf("message = %q, want %q", f.Message, tt.wantMsg)
+				}
+				return
+			}
+			if f != nil {
+				t.Fatalf("unexpected failure %+v", f)
+			}
+			if !slices.Equal(value, tt.want) {
+				t.Errorf("value = %q, want %q", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntRules(t *testing.T) {
+	tests := []struct {
+		rule     Rule[int]
+		in       int
+		wantCode string
+	}{
+		{rule: Min(0), in: 0},
+		{rule: Min(0), in: -1, wantCode: "too_small"},
+		{rule: Max(10), in: 10},
+		{rule: Max(10), in: 11, wantCode: "too_large"},
+	}
+	for _, tt := range tests {
+		value := tt.in
+		var got string
+		if f := tt.rule(&value); f != nil {
+			got = f.Code
+		}
+		if got != tt.wantCode {
+			t.Errorf("rule(%d) code = %q, want %q", tt.in, got, tt.wantCode)
+		}
+	}
+}
+
+func TestEmptyToNil(t *testing.T) {
+	blank, text := "  ", "x"
+	for _, tt := range []struct {
+		in      *string
+		wantNil bool
+	}{{in: nil, wantNil: true}, {in: &blank, wantNil: true}, {in: &text}} {
+		value := tt.in
+		EmptyToNil(&value)
+		if (value == nil) != tt.wantNil {
+			t.Errorf("EmptyToNil(%v) = %v", tt.in, value)
+		}
+	}
+}
+
+func TestValidator(t *testing.T) {
+	v := New()
+	name, price := "  ", -1
+	tags := []string{"a", "b"}
+	var description *string
+	v.String("name", &name, Trim, Required, MaxLength(1))
+	v.OptionalString("description", &description, Required)
+	v.Strings("tags", &tags, MaxItems(1))
+	v.Int("price_cents", price, Min(0))
+	v.Add("image", "required", "image is required")
+
+	// Only the first failing rule of a field is reported, and fields are
+	// ordered by name.
+	want := []problem.FieldError{
+		problem.Field("image", "required", "image is required"),
+		problem.Field("name", "required", "name is required"),
+		problem.Field("price_cents", "too_small", "price_cents must be at least 0"),
+		problem.Field("tags", "too_many", "tags must have at most 1 entries"),
+	}
+	if got := v.Errors(); !slices.Equal(got, want) {
+		t.Errorf("Errors() = %+v, want %+v", got, want)
+	}
+
+	var p *problem.Problem
+	if err := v.Err(); !errors.As(err, &p) || p.Code != problem.CodeValidation || !slices.Equal(p.Errors, want) {
+		t.Errorf("Err() = %v, want a validation problem with the sorted errors", err)
+	}
+
+	// Sorting leaves the validator's own list alone, so it can be added to.
+	v.Add("description", "invalid", "description is invalid")
+	if got := v.Errors(); len(got) != 5 || got[0].Field != "description" {
+		t.Errorf("Errors() after Add = %+v", got)
+	}
+	if err := New().Err(); err != nil {
+		t.Errorf("Err() of a passing validator = %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEntry struct {
+	ID         int64           `json:"id" db:"id"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+	ActorID    *string         `json:"actor_id" db:"actor_id"`
+	Action     string          `json:"action" db:"action"`
+	EntityType string          `json:"entity_type" db:"entity_type"`
+	EntityID   string          `json:"entity_id" db:"entity_id"`
+	ClientIP   *string         `json:"client_ip" db:"client_ip"`
+	Diff       json.RawMessage `json:"diff" db:"diff"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+const (
+	DraftActionUpsert = "upsert"
+	DraftActionDelete = "delete"
+)
+
+// SpeisekarteDraft is an unpublished change to the menu. ItemID is nil for
+// drafts that create a new item.
+type SpeisekarteDraft struct {
+	ID            string    `json:"id" db:"id"`
+	ItemID        *string   `json:"item_id" db:"item_id"`
+	Action        string    `json:"action" db:"action"`
+	Name          string    `json:"name" db:"name"`
+	Description   *string   `json:"description" db:"description"`
+	Categories    []string  `json:"categories" db:"categories"`
+	Ingredients   []string  `json:"ingredients" db:"ingredients"`
+	Tags          []string  `json:"tags" db:"tags"`
+	PriceCents    int       `json:"price_cents" db:"price_cents"`
+	Image         *string   `json:"image" db:"image"`
+	Seasonal      bool      `json:"seasonal" db:"seasonal"`
+	PublicationID *string   `json:"publication_id" db:"publication_id"`
+	CreatedBy     *string   `json:"created_by" db:"created_by"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type Publication struct {
+	ID          string     `json:"id" db:"id"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	CreatedBy   *string    `json:"created_by" db:"created_by"`
+	PublishAt   time.Time  `json:"publish_at" db:"publish_at"`
+	PublishedAt *time.Time `json:"published_at" db:"published_at"`
+	Status      string     `json:"status" db:"status"`
+	Error       *string    `json:"error" db:"error"`
+}
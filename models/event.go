@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Menu event types streamed to live clients.
+const (
+	EventItemCreated             = "item.created"
+	EventItemUpdated             = "item.updated"
+	EventItemDeleted             = "item.deleted"
+	EventItemAvailabilityChanged = "item.availability_changed"
+	EventCategoriesChanged       = "categories.changed"
+)
+
+type MenuEvent struct {
+	ID        int64           `json:"id" db:"id"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+	Type      string          `json:"type" db:"type"`
+	ItemID    *string         `json:"item_id,omitempty" db:"item_id"`
+	Data      json.RawMessage `json:"data" db:"data"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// MenuVersion is an immutable snapshot of every live menu item. Items is only
+// populated when a single version is requested.
+type MenuVersion struct {
+	ID        int64             `json:"id" db:"id"`
+	CreatedAt time.Time         `json:"created_at" db:"created_at"`
+	CreatedBy *string           `json:"created_by" db:"created_by"`
+	Reason    string            `json:"reason" db:"reason"`
+	Label     *string           `json:"label" db:"label"`
+	ItemCount int               `json:"item_count" db:"item_count"`
+	Items     []SpeisekarteItem `json:"items,omitempty" db:"items"`
+}
+
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+type ItemChange struct {
+	ID      string                 `json:"id"`
+	Name    string                 `json:"name"`
+	Changes map[string]FieldChange `json:"changes"`
+}
+
+// VersionDiff compares two menu versions. A nil To means the live menu.
+type VersionDiff struct {
+	From    int64             `json:"from"`
+	To      *int64            `json:"to"`
+	Added   []SpeisekarteItem `json:"added"`
+	Removed []SpeisekarteItem `json:"removed"`
+	Changed []ItemChange      `json:"changed"`
+}
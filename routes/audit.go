@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gomisroca/gasthaus-backend/handlers"
+	"github.com/gomisroca/gasthaus-backend/internal/middleware"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func RegisterAuditRoutes(r *mux.Router, dbpool *pgxpool.Pool, jwtSecret string) {
+	sr := r.PathPrefix("/admin/audit").Subrouter()
+	h := &handlers.AuditHandler{DB: dbpool}
+	auth := middleware.JWTAuth(jwtSecret)
+
+	sr.Handle("", auth(http.HandlerFunc(h.ListEntries))).Methods("GET")
+}
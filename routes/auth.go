@@ -8,7 +8,7 @@ import (
 
 func RegisterAuthRoutes(r *mux.Router, dbpool *pgxpool.Pool, jwtSecret string) {
 	sr := r.PathPrefix("/auth").Subrouter()
-	h := &handlers.AuthHandler{DB: dbpool, JWTSecret: jwtSecret}
+	h := handlers.NewAuthHandler(dbpool, jwtSecret)
 
 	sr.HandleFunc("/login", h.Login).Methods("POST")
 	sr.HandleFunc("/refresh-token", h.RefreshToken).Methods("GET")
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gomisroca/gasthaus-backend/handlers"
+	"github.com/gomisroca/gasthaus-backend/internal/logging"
+	"github.com/gomisroca/gasthaus-backend/internal/problem"
+	"github.com/gomisroca/gasthaus-backend/internal/tracing"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NewRouter registers every route of the API. Keep api/openapi.json in sync
+// when adding or removing routes; TestRouterMatchesSpec checks it.
+func NewRouter(dbpool *pgxpool.Pool, speisekarte *handlers.SpeisekarteHandler, webhooks *handlers.WebhookHandler, jwtSecret string) *mux.Router {
+	r := mux.NewRouter()
+	r.NotFoundHandler = problem.NotFoundHandler()
+	r.MethodNotAllowedHandler = problem.MethodNotAllowedHandler()
+	r.Use(logging.RouteMiddleware, tracing.RouteMiddleware)
+
+	fs := http.FileServer(http.Dir("static/"))
+	r.Handle("/static/", http.StripPrefix("/static/", fs))
+
+	r.HandleFunc("/", handlers.HealthCheck(dbpool)).Methods("GET")
+	r.HandleFunc("/openapi.json", handlers.OpenAPISpec).Methods("GET")
+	r.HandleFunc("/docs", handlers.APIDocs).Methods("GET")
+	RegisterAuthRoutes(r, dbpool, jwtSecret)
+	RegisterSpeisekarteRoutes(r, speisekarte, jwtSecret)
+	RegisterAuditRoutes(r, dbpool, jwtSecret)
+	RegisterWebhookRoutes(r, webhooks, jwtSecret)
+
+	return r
+}
@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gomisroca/gasthaus-backend/api"
+	"github.com/gomisroca/gasthaus-backend/handlers"
+	"github.com/gorilla/mux"
+)
+
+type openAPIOperation struct {
+	OperationID string                `json:"operationId"`
+	Security    []map[string][]string `json:"security"`
+	Responses   map[string]any        `json:"responses"`
+}
+
+type openAPIDoc struct {
+	OpenAPI string                                 `json:"openapi"`
+	Paths   map[string]map[string]openAPIOperation `json:"paths"`
+}
+
+// routeKey identifies an operation as "METHOD /path/{param}".
+func routeKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+func loadSpec(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(api.Spec, &doc); err != nil {
+		t.Fatalf("api/openapi.json is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.1") {
+		t.Fatalf("openapi = %q, want 3.1.x", doc.OpenAPI)
+	}
+	return doc
+}
+
+// routerOperations lists the method and path template of every route that
+// is restricted to methods. Routes that differ only by query matchers, such
+// as GET /speisekarte/?preview=true, are one operation.
+func routerOperations(t *testing.T) []string {
+	t.Helper()
+	r := NewRouter(nil, &handlers.SpeisekarteHandler{}, &handlers.WebhookHandler{}, "secret")
+
+	var ops []string
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		for _, m := range methods {
+			if key := routeKey(m, path); !slices.Contains(ops, key) {
+				ops = append(ops, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking routes: %v", err)
+	}
+	slices.Sort(ops)
+	return ops
+}
+
+func TestRouterMatchesSpec(t *testing.T) {
+	doc := loadSpec(t)
+
+	var specOps []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			specOps = append(specOps, routeKey(method, path))
+		}
+	}
+	slices.Sort(specOps)
+
+	routerOps := routerOperations(t)
+	for _, op := range routerOps {
+		if !slices.Contains(specOps, op) {
+			t.Errorf("%s is routed but missing from api/openapi.json", op)
+		}
+	}
+	for _, op := range specOps {
+		if !slices.Contains(routerOps, op) {
+			t.Errorf("%s is in api/openapi.json but not routed", op)
+		}
+	}
+}
+
+func TestSpecOperations(t *testing.T) {
+	doc := loadSpec(t)
+
+	seen := make(map[string]string)
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			key := routeKey(method, path)
+			if op.OperationID == "" {
+				t.Errorf("%s has no operationId", key)
+			} else if other, ok := seen[op.OperationID]; ok {
+				t.Errorf("%s and %s share operationId %q", key, other, op.OperationID)
+			}
+			seen[op.OperationID] = key
+
+			if len(op.Responses) == 0 {
+				t.Errorf("%s documents no responses", key)
+			}
+			// Routes behind JWTAuth must declare the bearer scheme and its 401.
+			if len(op.Security) > 0 {
+				if _, ok := op.Responses["401"]; !ok {
+					t.Errorf("%s requires auth but documents no 401 response", key)
+				}
+			}
+		}
+	}
+}
+
+var pathParam = regexp.MustCompile(`\{[^}]+\}`)
+
+// TestSpecSecurity checks that every operation the spec marks as
+// authenticated rejects requests without a token.
+func TestSpecSecurity(t *testing.T) {
+	doc := loadSpec(t)
+	r := NewRouter(nil, &handlers.SpeisekarteHandler{}, &handlers.WebhookHandler{}, "secret")
+
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			if len(op.Security) == 0 {
+				continue
+			}
+			req := httptest.NewRequest(strings.ToUpper(method), pathParam.ReplaceAllString(path, "1"), nil)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s without a token: status %d, want 401", routeKey(method, path), rec.Code)
+			}
+		}
+	}
+}
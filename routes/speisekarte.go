@@ -6,18 +6,42 @@ import (
 	"github.com/gomisroca/gasthaus-backend/handlers"
 	"github.com/gomisroca/gasthaus-backend/internal/middleware"
 	"github.com/gorilla/mux"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func RegisterSpeisekarteRoutes(r *mux.Router, dbpool *pgxpool.Pool, jwtSecret string) {
+func RegisterSpeisekarteRoutes(r *mux.Router, h *handlers.SpeisekarteHandler, jwtSecret string) {
 	sr := r.PathPrefix("/speisekarte").Subrouter()
-	h := &handlers.SpeisekarteHandler{DB: dbpool}
 	auth := middleware.JWTAuth(jwtSecret)
 
+	sr.Handle("/", auth(http.HandlerFunc(h.GetItems))).Methods("GET").Queries("preview", "true")
 	sr.HandleFunc("/", h.GetItems).Methods("GET")
 	sr.Handle("/", auth(http.HandlerFunc(h.AddItem))).Methods("POST")
 	sr.HandleFunc("/categories", h.GetCategories).Methods("GET")
+	sr.HandleFunc("/search", h.SearchItems).Methods("GET")
+	sr.Handle("/positions", auth(http.HandlerFunc(h.ReorderItems))).Methods("PUT")
+	sr.HandleFunc("/events", h.StreamEvents).Methods("GET")
+	sr.Handle("/cache/stats", auth(http.HandlerFunc(h.CacheStats))).Methods("GET")
+	sr.Handle("/export", auth(http.HandlerFunc(h.Export))).Methods("GET")
+	sr.Handle("/import", auth(http.HandlerFunc(h.Import))).Methods("POST")
+	sr.Handle("/trash", auth(http.HandlerFunc(h.GetTrash))).Methods("GET")
+	sr.Handle("/trash/{id}/restore", auth(http.HandlerFunc(h.RestoreItem))).Methods("POST")
+	sr.Handle("/trash/{id}", auth(http.HandlerFunc(h.PurgeItem))).Methods("DELETE")
+	sr.Handle("/drafts", auth(http.HandlerFunc(h.GetDrafts))).Methods("GET")
+	sr.Handle("/drafts", auth(http.HandlerFunc(h.SaveDraft))).Methods("POST")
+	sr.Handle("/drafts/publish", auth(http.HandlerFunc(h.Publish))).Methods("POST")
+	sr.Handle("/drafts/{id}", auth(http.HandlerFunc(h.UpdateDraft))).Methods("PUT")
+	sr.Handle("/drafts/{id}", auth(http.HandlerFunc(h.DeleteDraft))).Methods("DELETE")
+	sr.Handle("/publications", auth(http.HandlerFunc(h.GetPublications))).Methods("GET")
+	sr.Handle("/publications/{id}", auth(http.HandlerFunc(h.CancelPublication))).Methods("DELETE")
+	sr.Handle("/versions", auth(http.HandlerFunc(h.GetVersions))).Methods("GET")
+	sr.Handle("/versions", auth(http.HandlerFunc(h.CreateVersion))).Methods("POST")
+	sr.Handle("/versions/diff", auth(http.HandlerFunc(h.DiffVersions))).Methods("GET")
+	sr.Handle("/versions/{id}", auth(http.HandlerFunc(h.GetVersion))).Methods("GET")
+	sr.Handle("/versions/{id}/rollback", auth(http.HandlerFunc(h.RollbackToVersion))).Methods("POST")
 	sr.HandleFunc("/{id}", h.GetUniqueItem).Methods("GET")
 	sr.Handle("/{id}", auth(http.HandlerFunc(h.UpdateItem))).Methods("PUT")
+	sr.Handle("/{id}", auth(http.HandlerFunc(h.PatchItem))).Methods("PATCH")
 	sr.Handle("/{id}", auth(http.HandlerFunc(h.DeleteItem))).Methods("DELETE")
-}
\ No newline at end of file
+	sr.Handle("/{id}/image", auth(http.HandlerFunc(h.UploadItemImage))).Methods("PUT")
+	sr.Handle("/{id}/image", auth(http.HandlerFunc(h.DeleteItemImage))).Methods("DELETE")
+	sr.Handle("/{id}/availability", auth(http.HandlerFunc(h.SetItemAvailability))).Methods("PUT")
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gomisroca/gasthaus-backend/handlers"
+	"github.com/gomisroca/gasthaus-backend/internal/middleware"
+	"github.com/gorilla/mux"
+)
+
+func RegisterWebhookRoutes(r *mux.Router, h *handlers.WebhookHandler, jwtSecret string) {
+	sr := r.PathPrefix("/admin/webhooks").Subrouter()
+	auth := middleware.JWTAuth(jwtSecret)
+
+	sr.Handle("", auth(http.HandlerFunc(h.ListSubscriptions))).Methods("GET")
+	sr.Handle("", auth(http.HandlerFunc(h.CreateSubscription))).Methods("POST")
+	sr.Handle("/deliveries/{deliveryID}", auth(http.HandlerFunc(h.GetDelivery))).Methods("GET")
+	sr.Handle("/deliveries/{deliveryID}/redeliver", auth(http.HandlerFunc(h.Redeliver))).Methods("POST")
+	sr.Handle("/{id}", auth(http.HandlerFunc(h.GetSubscription))).Methods("GET")
+	sr.Handle("/{id}", auth(http.HandlerFunc(h.UpdateSubscription))).Methods("PUT")
+	sr.Handle("/{id}", auth(http.HandlerFunc(h.DeleteSubscription))).Methods("DELETE")
+	sr.Handle("/{id}/deliveries", auth(http.HandlerFunc(h.ListDeliveries))).Methods("GET")
+}